@@ -5,6 +5,7 @@ go 1.23.0
 require (
 	github.com/docker/docker v28.1.1+incompatible
 	github.com/joho/godotenv v1.5.1
+	github.com/klauspost/compress v1.18.0
 	github.com/prometheus/client_golang v1.22.0
 	github.com/rs/zerolog v1.32.0
 	github.com/spf13/pflag v1.0.6
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -13,7 +14,11 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/compression"
 	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/registry"
 )
 
 // Config represents the application configuration
@@ -43,6 +48,57 @@ type Config struct {
 	ConfigFilePath string
 	Version        string
 
+	// Registry provider settings
+	RegistryProvider  string // Provider of the target registry, inferred from its host when empty
+	AWSRegion         string // ECR region, taken from the registry host when empty
+	AWSProfile        string // Profile of the shared AWS credentials file
+	GCPKeyFile        string // Google service account key file for GCR and Artifact Registry
+	AzureTenant       string // AAD tenant of the Azure access token
+	AzureAccessToken  string // AAD access token exchanged for an ACR refresh token
+	AzureRefreshToken string // ACR refresh token
+
+	// RegistryOptions holds key=value settings for providers added with
+	// registry.Register
+	RegistryOptions []string
+
+	// Harbor project settings
+	HarborPublic       bool   // Create missing Harbor projects as public projects
+	HarborStorageLimit int64  // Storage quota of created Harbor projects in bytes, 0 for the Harbor default
+	HarborRobotFile    string // Harbor robot account file, replaces the username and password
+
+	// Transport settings
+	Transport string
+	Insecure  bool
+	Platforms []string
+
+	// CopyReferrers copies signatures, attestations, SBOMs and referrers,
+	// RequireReferrers fails images whose referrers can't be copied
+	CopyReferrers    bool
+	RequireReferrers bool
+
+	// ConvertLayers recompresses image layers to gzip or zstd when set
+	ConvertLayers string
+
+	// Cleanup settings for the local daemon
+	Cleanup       bool // Remove local source and target tags after a successful push
+	PruneDangling bool // Prune dangling images at the end of the run
+
+	// Pre-flight size check settings
+	Preflight    string // Action when the batch doesn't fit: refuse or trim, empty disables the check
+	MaxTotalSize int64  // Size budget of the batch in bytes, 0 for none
+
+	// Bandwidth settings, in bytes per second
+	MaxBandwidth      int64
+	RegistryBandwidth []string // host=rate entries, e.g. docker.io=10MB
+
+	// Cache settings
+	CacheDir     string
+	CacheMaxSize int64
+
+	// Bundle settings
+	Bundle     bool
+	BundleBase []string
+
 	// Telemetry settings
 	TelemetryEnabled bool
 	MetricsEnabled   bool
@@ -69,6 +125,8 @@ func DefaultConfig() *Config {
 		Force:            false,
 		DryRun:           false,
 		Profile:          "default",
+		Transport:        "daemon",
+		CacheMaxSize:     10 << 30,
 		TelemetryEnabled: true,
 		MetricsEnabled:   false,
 	}
@@ -113,6 +171,47 @@ func ParseConfig() (*Config, error) {
 	pflag.StringVar(&cfg.Profile, "profile", getEnv("PROFILE", cfg.Profile), "Configuration profile to use")
 	pflag.StringVar(&cfg.ConfigFilePath, "config", getEnv("CONFIG_FILE", ""), "Path to configuration file")
 
+	// Registry provider settings
+	pflag.StringVar(&cfg.RegistryProvider, "registry-provider", getEnv("REGISTRY_PROVIDER", cfg.RegistryProvider), "Target registry provider (dockerhub, ecr, gcr, acr, ghcr, harbor, custom), inferred from the repository host when empty; Harbor is inferred from the --harbor-* settings")
+	pflag.StringVar(&cfg.AWSRegion, "aws-region", getEnv("AWS_REGION", cfg.AWSRegion), "AWS region of an ECR registry, taken from its host when empty")
+	pflag.StringVar(&cfg.AWSProfile, "aws-profile", getEnv("AWS_PROFILE", cfg.AWSProfile), "Profile of the shared AWS credentials file for ECR")
+	pflag.StringVar(&cfg.GCPKeyFile, "gcp-key-file", getEnv("GOOGLE_APPLICATION_CREDENTIALS", cfg.GCPKeyFile), "Google service account key file for GCR and Artifact Registry")
+	pflag.StringVar(&cfg.AzureTenant, "azure-tenant", getEnv("AZURE_TENANT_ID", cfg.AzureTenant), "AAD tenant of the Azure access token")
+	pflag.StringVar(&cfg.AzureAccessToken, "azure-access-token", getEnv("AZURE_ACCESS_TOKEN", cfg.AzureAccessToken), "AAD access token exchanged for an ACR refresh token")
+	pflag.StringVar(&cfg.AzureRefreshToken, "azure-refresh-token", getEnv("AZURE_REFRESH_TOKEN", cfg.AzureRefreshToken), "ACR refresh token, e.g. from az acr login --expose-token")
+	pflag.StringSliceVar(&cfg.RegistryOptions, "registry-option", getEnvSlice("REGISTRY_OPTIONS", cfg.RegistryOptions), "Setting of a registry provider added with registry.Register as key=value, repeatable")
+	pflag.BoolVar(&cfg.HarborPublic, "harbor-public", getBoolEnv("HARBOR_PUBLIC", cfg.HarborPublic), "Create missing Harbor projects as public projects")
+	pflag.Var(newByteSizeValue(getEnvByteSize("HARBOR_STORAGE_LIMIT", cfg.HarborStorageLimit), &cfg.HarborStorageLimit), "harbor-storage-limit", "Storage quota of created Harbor projects, e.g. 100GB (0 for the Harbor default)")
+	pflag.StringVar(&cfg.HarborRobotFile, "harbor-robot-file", getEnv("HARBOR_ROBOT_FILE", cfg.HarborRobotFile), "Harbor robot account file, used instead of the username and password")
+
+	// Transport settings
+	pflag.StringVar(&cfg.Transport, "transport", getEnv("TRANSPORT", cfg.Transport), "Image transport (daemon, registry)")
+	pflag.BoolVar(&cfg.Insecure, "insecure", getBoolEnv("INSECURE_REGISTRY", cfg.Insecure), "Use plain HTTP for registry API calls")
+	pflag.StringSliceVar(&cfg.Platforms, "platforms", getEnvSlice("PLATFORMS", cfg.Platforms), "Platforms to copy from multi-arch images, e.g. linux/amd64,linux/arm64 (default all)")
+	pflag.BoolVar(&cfg.CopyReferrers, "copy-referrers", getBoolEnv("COPY_REFERRERS", cfg.CopyReferrers), "Copy cosign signatures, attestations, SBOMs and OCI referrers along with each image (registry transport)")
+	pflag.BoolVar(&cfg.RequireReferrers, "require-referrers", getBoolEnv("REQUIRE_REFERRERS", cfg.RequireReferrers), "Fail images whose signatures, attestations, SBOMs or referrers can't be copied, implies --copy-referrers")
+	pflag.StringVar(&cfg.ConvertLayers, "convert-layers", getEnv("CONVERT_LAYERS", cfg.ConvertLayers), "Recompress image layers while copying (gzip, zstd), changing image digests (registry transport)")
+
+	// Cleanup settings
+	pflag.BoolVar(&cfg.Cleanup, "cleanup", getBoolEnv("CLEANUP", cfg.Cleanup), "Remove pulled and tagged images from the local daemon after a successful push (daemon transport)")
+	pflag.BoolVar(&cfg.PruneDangling, "prune-dangling", getBoolEnv("PRUNE_DANGLING", cfg.PruneDangling), "Prune dangling images from the local daemon at the end of the run (daemon transport)")
+
+	// Pre-flight size check settings
+	pflag.StringVar(&cfg.Preflight, "preflight", getEnv("PREFLIGHT", cfg.Preflight), "Estimate the batch size before syncing and refuse or trim a batch that doesn't fit (refuse, trim)")
+	pflag.Var(newByteSizeValue(getEnvByteSize("MAX_TOTAL_SIZE", cfg.MaxTotalSize), &cfg.MaxTotalSize), "max-total-size", "Size budget of a batch, e.g. 50GB; enables the pre-flight check")
+
+	// Bandwidth settings
+	pflag.Var(newByteSizeValue(getEnvByteSize("MAX_BANDWIDTH", cfg.MaxBandwidth), &cfg.MaxBandwidth), "max-bandwidth", "Maximum transfer rate per second of all pulls and pushes together, e.g. 20MB (default unlimited)")
+	pflag.StringSliceVar(&cfg.RegistryBandwidth, "registry-bandwidth", getEnvSlice("REGISTRY_BANDWIDTH", cfg.RegistryBandwidth), "Maximum transfer rate per second by registry, e.g. docker.io=10MB,ghcr.io=5MB")
+
+	// Cache settings
+	pflag.StringVar(&cfg.CacheDir, "cache-dir", getEnv("CACHE_DIR", cfg.CacheDir), "Directory for the on-disk blob cache used by the registry transport (disabled when empty)")
+	pflag.Var(newByteSizeValue(getEnvByteSize("CACHE_MAX_SIZE", cfg.CacheMaxSize), &cfg.CacheMaxSize), "cache-max-size", "Maximum size of the blob cache, e.g. 512MB or 20GB")
+
+	// Bundle settings
+	pflag.BoolVar(&cfg.Bundle, "bundle", getBoolEnv("BUNDLE", cfg.Bundle), "Write a bundle record into oci: targets for later delta bundles")
+	pflag.StringSliceVar(&cfg.BundleBase, "bundle-base", getEnvSlice("BUNDLE_BASE", cfg.BundleBase), "Base bundle directories or records; exports leave their blobs out, imports read missing blobs from them")
+
 	// Telemetry settings
 	pflag.BoolVar(&cfg.TelemetryEnabled, "telemetry", getBoolEnv("TELEMETRY_ENABLED", cfg.TelemetryEnabled), "Enable telemetry collection")
 	pflag.BoolVar(&cfg.MetricsEnabled, "metrics", getBoolEnv("METRICS_ENABLED", cfg.MetricsEnabled), "Enable metrics collection")
@@ -201,6 +300,29 @@ func ParseConfig() (*Config, error) {
 		Bool("dryRun", cfg.DryRun).
 		Str("profile", cfg.Profile).
 		Str("logLevel", cfg.LogLevel).
+		Str("registryProvider", cfg.RegistryProvider).
+		Str("awsRegion", cfg.AWSRegion).
+		Str("awsProfile", cfg.AWSProfile).
+		Str("gcpKeyFile", cfg.GCPKeyFile).
+		Str("azureTenant", cfg.AzureTenant).
+		Bool("harborPublic", cfg.HarborPublic).
+		Int64("harborStorageLimit", cfg.HarborStorageLimit).
+		Str("harborRobotFile", cfg.HarborRobotFile).
+		Str("transport", cfg.Transport).
+		Strs("platforms", cfg.Platforms).
+		Bool("copyReferrers", cfg.CopyReferrers).
+		Bool("requireReferrers", cfg.RequireReferrers).
+		Str("convertLayers", cfg.ConvertLayers).
+		Bool("cleanup", cfg.Cleanup).
+		Bool("pruneDangling", cfg.PruneDangling).
+		Str("preflight", cfg.Preflight).
+		Int64("maxTotalSize", cfg.MaxTotalSize).
+		Int64("maxBandwidth", cfg.MaxBandwidth).
+		Strs("registryBandwidth", cfg.RegistryBandwidth).
+		Str("cacheDir", cfg.CacheDir).
+		Int64("cacheMaxSize", cfg.CacheMaxSize).
+		Bool("bundle", cfg.Bundle).
+		Strs("bundleBase", cfg.BundleBase).
 		Bool("telemetryEnabled", cfg.TelemetryEnabled).
 		Bool("metricsEnabled", cfg.MetricsEnabled).
 		Msg("Configuration loaded")
@@ -210,11 +332,11 @@ func ParseConfig() (*Config, error) {
 
 // Validate validates the configuration
 func (c *Config) Validate() error {
-	if c.Username == "" {
-		return errors.NewValidationError("config", "username is required", nil)
-	}
-	if c.Password == "" {
-		return errors.NewValidationError("config", "password is required", nil)
+	// Exporting to an archive doesn't log in anywhere
+	if !archive.IsLocation(c.Repository) {
+		if err := c.validateCredentials(); err != nil {
+			return err
+		}
 	}
 	if c.Content == "" {
 		return errors.NewValidationError("config", "content is required", nil)
@@ -254,9 +376,141 @@ func (c *Config) Validate() error {
 		)
 	}
 
+	// Validate transport, an empty value means the daemon transport
+	switch c.Transport {
+	case "", "daemon", "registry":
+	default:
+		return errors.NewValidationError(
+			"config",
+			fmt.Sprintf("invalid transport: %s (must be one of: daemon, registry)", c.Transport),
+			nil,
+		)
+	}
+
+	switch c.Preflight {
+	case "", "refuse", "trim":
+	default:
+		return errors.NewValidationError(
+			"config",
+			fmt.Sprintf("invalid preflight action: %s (must be one of: refuse, trim)", c.Preflight),
+			nil,
+		)
+	}
+
+	if c.MaxTotalSize < 0 {
+		return errors.NewValidationError(
+			"config",
+			fmt.Sprintf("invalid max total size: %d (must be >= 0)", c.MaxTotalSize),
+			nil,
+		)
+	}
+
+	if c.MaxBandwidth < 0 {
+		return errors.NewValidationError(
+			"config",
+			fmt.Sprintf("invalid max bandwidth: %d (must be >= 0)", c.MaxBandwidth),
+			nil,
+		)
+	}
+
+	if _, err := ParseRegistryBandwidth(c.RegistryBandwidth); err != nil {
+		return errors.NewValidationError("config", err.Error(), nil)
+	}
+
+	if _, err := ParseRegistryOptions(c.RegistryOptions); err != nil {
+		return errors.NewValidationError("config", err.Error(), nil)
+	}
+
+	if c.CacheMaxSize < 0 {
+		return errors.NewValidationError(
+			"config",
+			fmt.Sprintf("invalid cache max size: %d (must be >= 0)", c.CacheMaxSize),
+			nil,
+		)
+	}
+
+	if c.ConvertLayers != "" && !compression.IsSupported(c.ConvertLayers) {
+		return errors.NewValidationError(
+			"config",
+			fmt.Sprintf("invalid layer conversion: %s (must be one of: %s)", c.ConvertLayers, strings.Join(compression.Algorithms, ", ")),
+			nil,
+		)
+	}
+
+	// Validate platform filter entries
+	if _, err := oci.ParsePlatforms(c.Platforms); err != nil {
+		return errors.NewValidationError("config", err.Error(), nil)
+	}
+
+	return nil
+}
+
+// TargetProvider returns the provider of the target registry: the configured
+// one, or the one inferred from the repository host. Harbor can't be told
+// apart by its host, so Harbor settings select it for hosts no other
+// provider claims.
+func (c *Config) TargetProvider() registry.Provider {
+	if c.RegistryProvider != "" {
+		return registry.Provider(c.RegistryProvider)
+	}
+	provider := registry.Detect(c.Repository)
+	if provider == registry.Custom && (c.HarborRobotFile != "" || c.HarborPublic || c.HarborStorageLimit != 0) {
+		return registry.Harbor
+	}
+	return provider
+}
+
+// validateCredentials checks the target registry can be logged in to.
+// ECR and GCR look up cloud credentials themselves, ACR also signs in with
+// Azure tokens, Harbor with a robot account file, and other registries need
+// a username and password.
+func (c *Config) validateCredentials() error {
+	provider := c.TargetProvider()
+	if !registry.IsRegistered(provider) {
+		return errors.NewValidationError(
+			"config",
+			fmt.Sprintf("invalid registry provider: %s (must be one of: %s)", provider, strings.Join(registry.Providers(), ", ")),
+			nil,
+		)
+	}
+
+	switch provider {
+	case registry.ECR, registry.GCR:
+		return nil
+	case registry.ACR:
+		if c.AzureAccessToken != "" || c.AzureRefreshToken != "" {
+			return nil
+		}
+	case registry.Harbor:
+		if c.HarborRobotFile != "" {
+			return nil
+		}
+	}
+
+	if c.Username == "" {
+		return errors.NewValidationError("config", "username is required", nil)
+	}
+	if c.Password == "" {
+		return errors.NewValidationError("config", "password is required", nil)
+	}
 	return nil
 }
 
+// ParseRegistryOptions parses key=value registry provider settings. A later
+// entry for the same key wins.
+func ParseRegistryOptions(entries []string) (map[string]string, error) {
+	options := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid registry option %q (must be key=value)", entry)
+		}
+		options[key] = strings.TrimSpace(value)
+	}
+	return options, nil
+}
+
 // LoadFromFile loads configuration from a file
 func (c *Config) LoadFromFile(filePath string) error {
 	data, err := os.ReadFile(filePath)
@@ -380,6 +634,30 @@ func GetEnvDuration(key string, fallback time.Duration) time.Duration {
 	return fallback
 }
 
+// GetEnvSlice gets a comma-separated environment variable or returns a default value
+func GetEnvSlice(key string, fallback []string) []string {
+	if value, exists := os.LookupEnv(key); exists {
+		var result []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+		return result
+	}
+	return fallback
+}
+
+// GetEnvByteSize gets a size environment variable such as 512MB or returns a default value
+func GetEnvByteSize(key string, fallback int64) int64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if result, err := ParseByteSize(value); err == nil {
+			return result
+		}
+	}
+	return fallback
+}
+
 // GetBoolEnv gets a boolean environment variable or returns a default value
 func GetBoolEnv(key string, fallback bool) bool {
 	if value, exists := os.LookupEnv(key); exists {
@@ -406,6 +684,14 @@ func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	return GetEnvDuration(key, fallback)
 }
 
+func getEnvSlice(key string, fallback []string) []string {
+	return GetEnvSlice(key, fallback)
+}
+
+func getEnvByteSize(key string, fallback int64) int64 {
+	return GetEnvByteSize(key, fallback)
+}
+
 func getBoolEnv(key string, fallback bool) bool {
 	return GetBoolEnv(key, fallback)
 }
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// byteUnits maps size suffixes to their multiplier. Decimal and binary
+// suffixes are both treated as powers of 1024, as docker does.
+var byteUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size such as 1024, 512KB, 20MiB or 1.5G into bytes
+func ParseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	if value == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.multiplier
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+// FormatByteSize formats bytes with the largest binary unit that fits
+func FormatByteSize(size int64) string {
+	for _, unit := range byteUnits[4:8] {
+		if size >= unit.multiplier {
+			return strconv.FormatFloat(float64(size)/float64(unit.multiplier), 'f', -1, 64) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(size, 10) + "B"
+}
+
+// ParseRegistryBandwidth parses host=rate entries such as docker.io=10MB into
+// rates in bytes per second by registry host
+func ParseRegistryBandwidth(entries []string) (map[string]int64, error) {
+	rates := make(map[string]int64, len(entries))
+	for _, entry := range entries {
+		host, rate, ok := strings.Cut(entry, "=")
+		host = strings.TrimSpace(host)
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid registry bandwidth %q (must be host=rate)", entry)
+		}
+		size, err := ParseByteSize(rate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid registry bandwidth %q: %w", entry, err)
+		}
+		rates[host] = size
+	}
+	return rates, nil
+}
+
+// byteSizeValue is a pflag.Value for sizes written as 512MB or 20GB
+type byteSizeValue int64
+
+// newByteSizeValue sets p to value and returns it as a flag value
+func newByteSizeValue(value int64, p *int64) *byteSizeValue {
+	*p = value
+	return (*byteSizeValue)(p)
+}
+
+// Set implements pflag.Value
+func (b *byteSizeValue) Set(s string) error {
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = byteSizeValue(size)
+	return nil
+}
+
+// String implements pflag.Value
+func (b *byteSizeValue) String() string {
+	return FormatByteSize(int64(*b))
+}
+
+// Type implements pflag.Value
+func (b *byteSizeValue) Type() string {
+	return "size"
+}
@@ -4,6 +4,7 @@ import (
 	stdsync "sync"
 
 	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/archive"
 	"github.com/yugasun/hubsync/pkg/docker"
 	"github.com/yugasun/hubsync/pkg/errors"
 	"github.com/yugasun/hubsync/pkg/observability"
@@ -56,15 +57,19 @@ func (c *Container) Initialize(cfg *config.Config) error {
 		return err
 	}
 
-	// Initialize clients
-	if err := c.initializeDockerClient(); err != nil {
+	// Initialize clients, the Docker client may log pushes in through the
+	// registry client
+	if err := c.initializeRegistryClient(); err != nil {
 		return err
 	}
 
-	c.initializeRegistryClient()
+	if err := c.initializeDockerClient(); err != nil {
+		return err
+	}
 
 	// Initialize syncer
 	c.syncer = sync.NewSyncerV2(c.config, c.dockerClient, c.registryClient)
+	c.syncer.SetMetricsManager(c.metricsManager)
 
 	c.initialized = true
 
@@ -108,11 +113,18 @@ func (c *Container) initializeDockerClient() error {
 	dockerConfig := docker.ClientConfig{
 		Username:    c.config.Username,
 		Password:    c.config.Password,
-		Repository:  c.config.Repository,
+		Repository:  c.targetRegistry(),
 		RetryCount:  c.config.RetryCount,
 		RetryDelay:  c.config.RetryDelay,
 		PullTimeout: c.config.Timeout,
 		PushTimeout: c.config.Timeout,
+		Metrics:     c.metricsManager,
+		Bandwidth:   sync.NewBandwidthLimits(c.config),
+	}
+
+	// Registries with short-lived tokens log pushes in with a fresh one
+	if provider, ok := c.registryClient.(registry.LoginProvider); ok {
+		dockerConfig.Login = provider.Login
 	}
 
 	// Create Docker client
@@ -125,23 +137,51 @@ func (c *Container) initializeDockerClient() error {
 	return nil
 }
 
-// initializeRegistryClient initializes the registry client
-func (c *Container) initializeRegistryClient() {
-	// Create registry configuration
+// initializeRegistryClient initializes the client of the target registry,
+// picking the provider from configuration or from the registry host
+func (c *Container) initializeRegistryClient() error {
 	registryConfig := registry.RegistryConfig{
-		Provider:   registry.DockerHub, // Default to Docker Hub
-		URL:        c.config.Repository,
-		Username:   c.config.Username,
-		Password:   c.config.Password,
-		SkipVerify: false,
+		Provider:     c.config.TargetProvider(),
+		URL:          c.targetRegistry(),
+		Username:     c.config.Username,
+		Password:     c.config.Password,
+		AccessToken:  c.config.AzureAccessToken,
+		RefreshToken: c.config.AzureRefreshToken,
+		Insecure:     c.config.Insecure,
+		SkipVerify:   false,
+	}
+	extra, err := config.ParseRegistryOptions(c.config.RegistryOptions)
+	if err != nil {
+		return errors.NewConfigError("di", "invalid registry options", err)
+	}
+	options := registry.ProviderOptions{
+		ECR: registry.ECROptions{Region: c.config.AWSRegion, Profile: c.config.AWSProfile},
+		GCR: registry.GCROptions{KeyFile: c.config.GCPKeyFile},
+		ACR: registry.ACROptions{Tenant: c.config.AzureTenant},
+		Harbor: registry.HarborOptions{
+			Public:       c.config.HarborPublic,
+			StorageLimit: c.config.HarborStorageLimit,
+			RobotFile:    c.config.HarborRobotFile,
+		},
+		Extra: extra,
 	}
 
-	// Create appropriate registry client based on configuration
-	// For now, only Docker Hub is supported
-	// In the future, we can add more registry types based on URL or configuration
-	registryClient := registry.NewDockerHubRegistry(registryConfig)
+	registryClient, err := registry.NewRegistry(registryConfig, options)
+	if err != nil {
+		return errors.NewClientError("di", "failed to initialize registry client", err)
+	}
 
 	c.registryClient = registryClient
+	return nil
+}
+
+// targetRegistry returns the configured target registry, or an empty string
+// for Docker Hub and for on-disk archive targets
+func (c *Container) targetRegistry() string {
+	if archive.IsLocation(c.config.Repository) {
+		return ""
+	}
+	return c.config.Repository
 }
 
 func (c *Container) GetConfig() *config.Config {
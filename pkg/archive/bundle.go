@@ -0,0 +1,122 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+)
+
+// BundleRecordFile is the name of the bundle record inside a bundle layout
+const BundleRecordFile = "bundle.json"
+
+// BundleRecord lists the blobs stored in a bundle and every blob shipped in
+// the bundles it builds on, so the next delta can leave them all out
+type BundleRecord struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Blobs   []string  `json:"blobs"`   // Blobs stored in this bundle
+	Shipped []string  `json:"shipped"` // Blobs stored in this bundle or any of its bases
+}
+
+// ReadBundleRecord reads a bundle record from a record file or a bundle
+// directory. Layouts written without a record count as full bundles.
+func ReadBundleRecord(path string) (*BundleRecord, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.NewIOError("archive", fmt.Sprintf("bundle %s not found", path), err)
+	}
+
+	file := path
+	if info.IsDir() {
+		file = filepath.Join(path, BundleRecordFile)
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			layout, err := ReadLayout(path)
+			if err != nil {
+				return nil, err
+			}
+			blobs, err := layout.Blobs()
+			if err != nil {
+				return nil, err
+			}
+			return &BundleRecord{Version: 1, Blobs: blobs, Shipped: blobs}, nil
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.NewIOError("archive", "failed to read bundle record", err)
+	}
+	var record BundleRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, errors.NewValidationError("archive", fmt.Sprintf("invalid bundle record %s", file), err)
+	}
+	return &record, nil
+}
+
+// WriteBundleRecord records the blobs of the layout as a bundle built on
+// top of the shipped blobs of its bases
+func (l *Layout) WriteBundleRecord(shipped []string) (*BundleRecord, error) {
+	blobs, err := l.Blobs()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(map[string]bool, len(shipped)+len(blobs))
+	for _, digest := range shipped {
+		all[digest] = true
+	}
+	for _, digest := range blobs {
+		all[digest] = true
+	}
+
+	record := &BundleRecord{
+		Version: 1,
+		Created: time.Now().UTC(),
+		Blobs:   blobs,
+		Shipped: make([]string, 0, len(all)),
+	}
+	for digest := range all {
+		record.Shipped = append(record.Shipped, digest)
+	}
+	sort.Strings(record.Shipped)
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return nil, errors.NewOperationError("archive", "failed to encode bundle record", err)
+	}
+	if err := os.WriteFile(filepath.Join(l.dir, BundleRecordFile), data, 0o644); err != nil {
+		return nil, errors.NewIOError("archive", "failed to write bundle record", err)
+	}
+	return record, nil
+}
+
+// Blobs returns the digests of every blob in the layout, sorted
+func (l *Layout) Blobs() ([]string, error) {
+	var blobs []string
+	root := filepath.Join(l.dir, "blobs")
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, strings.Replace(filepath.ToSlash(rel), "/", ":", 1))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.NewIOError("archive", "failed to list blobs", err)
+	}
+
+	sort.Strings(blobs)
+	return blobs, nil
+}
@@ -0,0 +1,42 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+)
+
+// digestVerifier hashes content written to it and compares the result
+// with the expected digest. Only sha256 digests are checked.
+type digestVerifier struct {
+	expected string
+	hash     hash.Hash
+}
+
+// newDigestVerifier creates a verifier for the expected digest
+func newDigestVerifier(expected string) *digestVerifier {
+	return &digestVerifier{expected: expected, hash: sha256.New()}
+}
+
+// Write implements io.Writer
+func (v *digestVerifier) Write(p []byte) (int, error) {
+	return v.hash.Write(p)
+}
+
+// verify returns a verification error when the content doesn't match
+func (v *digestVerifier) verify() error {
+	if !strings.HasPrefix(v.expected, "sha256:") {
+		return nil
+	}
+	if actual := "sha256:" + hex.EncodeToString(v.hash.Sum(nil)); actual != v.expected {
+		return errors.NewVerificationError("archive",
+			fmt.Sprintf("content digest %s does not match %s", actual, v.expected), nil).
+			WithDetail("expected", v.expected).
+			WithDetail("actual", actual)
+	}
+	return nil
+}
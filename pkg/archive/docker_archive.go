@@ -0,0 +1,199 @@
+package archive
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// dockerManifestEntry is an image in the manifest.json of a docker save tarball
+type dockerManifestEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// DockerArchive writes a tarball that docker load understands. Content is
+// staged in an image layout next to the target file and packed on Close,
+// with a manifest.json listing every named single-platform image.
+type DockerArchive struct {
+	*Layout
+	path string
+}
+
+// CreateDockerArchive starts a new tarball at path, replacing any existing
+// file once the archive is closed
+func CreateDockerArchive(path string) (*DockerArchive, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.NewIOError("archive", "failed to create archive directory", err)
+	}
+	staging, err := os.MkdirTemp(dir, ".hubsync-archive-*")
+	if err != nil {
+		return nil, errors.NewIOError("archive", "failed to create staging directory", err)
+	}
+
+	layout, err := OpenLayout(staging)
+	if err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+
+	return &DockerArchive{Layout: layout, path: path}, nil
+}
+
+// Path returns the tarball path
+func (a *DockerArchive) Path() string {
+	return a.path
+}
+
+// Close packs the staged content into the tarball and removes the staging
+// directory
+func (a *DockerArchive) Close() error {
+	defer os.RemoveAll(a.Dir())
+
+	manifest, err := a.dockerManifest()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return errors.NewOperationError("archive", "failed to encode manifest.json", err)
+	}
+	if err := os.WriteFile(filepath.Join(a.Dir(), "manifest.json"), data, 0o644); err != nil {
+		return errors.NewIOError("archive", "failed to write manifest.json", err)
+	}
+
+	tmp := a.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return errors.NewIOError("archive", "failed to create archive", err)
+	}
+	defer os.Remove(tmp)
+
+	if err := writeTar(file, a.Dir()); err != nil {
+		file.Close()
+		return errors.NewIOError("archive", fmt.Sprintf("failed to write %s", a.path), err)
+	}
+	if err := file.Close(); err != nil {
+		return errors.NewIOError("archive", fmt.Sprintf("failed to write %s", a.path), err)
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		return errors.NewIOError("archive", fmt.Sprintf("failed to write %s", a.path), err)
+	}
+	return nil
+}
+
+// dockerManifest lists the named images the way docker save does, merging
+// names that point at the same manifest
+func (a *DockerArchive) dockerManifest() ([]dockerManifestEntry, error) {
+	var entries []dockerManifestEntry
+	byDigest := make(map[string]int)
+
+	for _, desc := range a.Images() {
+		ref := desc.Annotations[AnnotationRefName]
+		if i, ok := byDigest[desc.Digest]; ok {
+			entries[i].RepoTags = append(entries[i].RepoTags, ref)
+			continue
+		}
+
+		data, _, err := a.GetManifest(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := oci.ParseManifest(data)
+		if err != nil {
+			return nil, errors.NewValidationError("archive", fmt.Sprintf("%s is not a single-platform image", ref), err)
+		}
+
+		entry := dockerManifestEntry{
+			Config:   blobName(manifest.Config.Digest),
+			RepoTags: []string{ref},
+			Layers:   make([]string, 0, len(manifest.Layers)),
+		}
+		for _, layer := range manifest.Layers {
+			entry.Layers = append(entry.Layers, blobName(layer.Digest))
+		}
+
+		byDigest[desc.Digest] = len(entries)
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// blobName returns the path of a blob inside the tarball
+func blobName(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// writeTar writes the regular files under dir to w, skipping hidden files
+func writeTar(w io.Writer, dir string) error {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	tw := tar.NewWriter(w)
+	for _, path := range files {
+		if err := addTarFile(tw, dir, path); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// addTarFile appends a single file to the tarball
+func addTarFile(tw *tar.Writer, dir, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(rel)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(tw, file)
+	return err
+}
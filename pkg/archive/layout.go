@@ -0,0 +1,268 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// AnnotationRefName is the index annotation that names an image in a layout
+const AnnotationRefName = "org.opencontainers.image.ref.name"
+
+// layoutVersion is the content of the oci-layout marker file
+const layoutVersion = `{"imageLayoutVersion":"1.0.0"}`
+
+// Layout is an OCI image-layout directory. Blobs live under
+// blobs/<algorithm>/<hex> and index.json names the tagged images.
+type Layout struct {
+	dir   string
+	mutex sync.Mutex
+	index oci.Index
+}
+
+// OpenLayout opens an image layout, creating an empty one if dir doesn't exist
+func OpenLayout(dir string) (*Layout, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0o755); err != nil {
+		return nil, errors.NewIOError("archive", "failed to create image layout", err)
+	}
+
+	l := &Layout{
+		dir: dir,
+		index: oci.Index{
+			SchemaVersion: 2,
+			MediaType:     oci.MediaTypeOCIIndex,
+			Manifests:     []oci.Descriptor{},
+		},
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &l.index); err != nil {
+			return nil, errors.NewValidationError("archive", fmt.Sprintf("invalid index.json in %s", dir), err)
+		}
+	case os.IsNotExist(err):
+		if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(layoutVersion), 0o644); err != nil {
+			return nil, errors.NewIOError("archive", "failed to write oci-layout", err)
+		}
+		if err := l.writeIndex(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.NewIOError("archive", "failed to read index.json", err)
+	}
+
+	return l, nil
+}
+
+// ReadLayout opens an existing image layout
+func ReadLayout(dir string) (*Layout, error) {
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err != nil {
+		return nil, errors.NewIOError("archive", fmt.Sprintf("%s is not an OCI image layout", dir), err)
+	}
+	return OpenLayout(dir)
+}
+
+// Dir returns the layout directory
+func (l *Layout) Dir() string {
+	return l.dir
+}
+
+// blobPath returns the file that holds a blob
+func (l *Layout) blobPath(digest string) (string, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok || algorithm == "" || encoded == "" || strings.ContainsAny(digest, `/\.`) {
+		return "", errors.NewValidationError("archive", fmt.Sprintf("invalid digest %q", digest), nil)
+	}
+	return filepath.Join(l.dir, "blobs", algorithm, encoded), nil
+}
+
+// HasBlob reports whether the layout holds a blob
+func (l *Layout) HasBlob(digest string) bool {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// OpenBlob opens a blob and returns its size
+func (l *Layout) OpenBlob(digest string) (io.ReadCloser, int64, error) {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, errors.NewIOError("archive", fmt.Sprintf("blob %s not found in %s", digest, l.dir), err)
+		}
+		return nil, 0, errors.NewIOError("archive", "failed to open blob", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, errors.NewIOError("archive", "failed to stat blob", err)
+	}
+	return file, info.Size(), nil
+}
+
+// WriteBlob stores a blob after checking its content against the digest
+func (l *Layout) WriteBlob(desc oci.Descriptor, content io.Reader) error {
+	path, err := l.blobPath(desc.Digest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.NewIOError("archive", "failed to create blob directory", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return errors.NewIOError("archive", "failed to create blob file", err)
+	}
+	defer os.Remove(file.Name())
+
+	verifier := newDigestVerifier(desc.Digest)
+	if _, err := io.Copy(io.MultiWriter(file, verifier), content); err != nil {
+		file.Close()
+		return errors.NewIOError("archive", fmt.Sprintf("failed to write blob %s", desc.Digest), err)
+	}
+	if err := file.Close(); err != nil {
+		return errors.NewIOError("archive", fmt.Sprintf("failed to write blob %s", desc.Digest), err)
+	}
+	if err := verifier.verify(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return errors.NewIOError("archive", fmt.Sprintf("failed to store blob %s", desc.Digest), err)
+	}
+	return nil
+}
+
+// PutManifest stores a manifest blob and, when ref is not empty, names it
+// in index.json, replacing any image previously stored under that name
+func (l *Layout) PutManifest(ref, mediaType string, data []byte) (string, error) {
+	desc := oci.Descriptor{
+		MediaType: mediaType,
+		Digest:    oci.ComputeDigest(data),
+		Size:      int64(len(data)),
+	}
+	if !l.HasBlob(desc.Digest) {
+		if err := l.WriteBlob(desc, bytes.NewReader(data)); err != nil {
+			return "", err
+		}
+	}
+	if ref == "" {
+		return desc.Digest, nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	desc.Annotations = map[string]string{AnnotationRefName: ref}
+	if manifest, err := oci.ParseManifest(data); err == nil {
+		desc.ArtifactType = manifest.Type()
+	}
+	manifests := make([]oci.Descriptor, 0, len(l.index.Manifests)+1)
+	for _, existing := range l.index.Manifests {
+		if existing.Annotations[AnnotationRefName] != ref {
+			manifests = append(manifests, existing)
+		}
+	}
+	l.index.Manifests = append(manifests, desc)
+
+	if err := l.writeIndex(); err != nil {
+		return "", err
+	}
+	return desc.Digest, nil
+}
+
+// Resolve returns the descriptor of a manifest named ref, or of the manifest
+// with that digest. It returns false when the layout doesn't hold it.
+func (l *Layout) Resolve(ref string) (oci.Descriptor, bool) {
+	if strings.HasPrefix(ref, "sha256:") {
+		if !l.HasBlob(ref) {
+			return oci.Descriptor{}, false
+		}
+		return oci.Descriptor{Digest: ref}, true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, desc := range l.index.Manifests {
+		if desc.Annotations[AnnotationRefName] == ref {
+			return desc, true
+		}
+	}
+	return oci.Descriptor{}, false
+}
+
+// GetManifest reads a manifest by ref name or digest
+func (l *Layout) GetManifest(ref string) ([]byte, oci.Descriptor, error) {
+	desc, ok := l.Resolve(ref)
+	if !ok {
+		return nil, oci.Descriptor{}, errors.NewOperationError("archive",
+			fmt.Sprintf("manifest %s not found in %s", ref, l.dir), nil)
+	}
+
+	content, _, err := l.OpenBlob(desc.Digest)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, oci.Descriptor{}, errors.NewIOError("archive", "failed to read manifest", err)
+	}
+
+	desc.Size = int64(len(data))
+	if desc.MediaType == "" {
+		desc.MediaType = oci.DetectMediaType(data)
+	}
+	return data, desc, nil
+}
+
+// Images returns the descriptors of the named images in the layout
+func (l *Layout) Images() []oci.Descriptor {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	images := make([]oci.Descriptor, 0, len(l.index.Manifests))
+	for _, desc := range l.index.Manifests {
+		if desc.Annotations[AnnotationRefName] != "" {
+			images = append(images, desc)
+		}
+	}
+	return images
+}
+
+// writeIndex atomically replaces index.json. The caller must hold the mutex
+// unless the layout is not shared yet.
+func (l *Layout) writeIndex() error {
+	data, err := json.MarshalIndent(l.index, "", "  ")
+	if err != nil {
+		return errors.NewOperationError("archive", "failed to encode index.json", err)
+	}
+
+	tmp := filepath.Join(l.dir, ".index.json.tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return errors.NewIOError("archive", "failed to write index.json", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(l.dir, "index.json")); err != nil {
+		return errors.NewIOError("archive", "failed to write index.json", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Schemes of the on-disk locations hubsync can read and write
+const (
+	// SchemeOCI is an OCI image-layout directory
+	SchemeOCI = "oci"
+
+	// SchemeDockerArchive is a tarball compatible with docker save and docker load
+	SchemeDockerArchive = "docker-archive"
+)
+
+// Location addresses an image on disk in scheme:path[:ref] form, e.g.
+// oci:/mnt/export:mirror/nginx:latest or docker-archive:/mnt/images.tar
+type Location struct {
+	Scheme string
+	Path   string
+	Ref    string
+}
+
+// ParseLocation parses an on-disk location. It returns false when name is
+// not an archive location, i.e. a regular registry reference. The path must
+// start with /, . or ~, or follow scheme://, so that images named like a
+// scheme, e.g. oci:1.0, remain registry references.
+func ParseLocation(name string) (Location, bool) {
+	scheme, rest, ok := strings.Cut(name, ":")
+	if !ok || (scheme != SchemeOCI && scheme != SchemeDockerArchive) {
+		return Location{}, false
+	}
+
+	explicit := strings.HasPrefix(rest, "//")
+	if explicit {
+		rest = strings.TrimPrefix(rest, "//")
+	} else if !isPath(rest) {
+		return Location{}, false
+	}
+
+	loc := Location{Scheme: scheme, Path: rest}
+	if path, ref, ok := strings.Cut(rest, ":"); ok {
+		loc.Path = path
+		loc.Ref = ref
+	}
+	if loc.Path == "" {
+		return Location{}, false
+	}
+	if loc.Path == "~" || strings.HasPrefix(loc.Path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			loc.Path = filepath.Join(home, loc.Path[1:])
+		}
+	}
+	return loc, true
+}
+
+// isPath reports whether s starts like a file path rather than a tag, which
+// can't start with any of /, . or ~
+func isPath(s string) bool {
+	return strings.HasPrefix(s, "/") || strings.HasPrefix(s, ".") || strings.HasPrefix(s, "~")
+}
+
+// IsLocation reports whether name is an archive location
+func IsLocation(name string) bool {
+	_, ok := ParseLocation(name)
+	return ok
+}
+
+// WithRef returns the location with its ref replaced
+func (l Location) WithRef(ref string) Location {
+	l.Ref = ref
+	return l
+}
+
+// String returns the location in scheme:path[:ref] form, or scheme://path
+// for a path that doesn't start like one
+func (l Location) String() string {
+	s := l.Scheme + ":" + l.Path
+	if !isPath(l.Path) {
+		s = l.Scheme + "://" + l.Path
+	}
+	if l.Ref != "" {
+		s += ":" + l.Ref
+	}
+	return s
+}
+
+// SplitRef splits a ref such as mirror/nginx:latest or mirror/nginx@sha256:...
+// into name, tag and digest
+func SplitRef(ref string) (name, tag, digest string, err error) {
+	name = ref
+	if idx := strings.Index(name, "@"); idx >= 0 {
+		digest = name[idx+1:]
+		name = name[:idx]
+	}
+	if idx := strings.LastIndex(name, ":"); idx > strings.LastIndex(name, "/") {
+		tag = name[idx+1:]
+		name = name[:idx]
+	}
+	if name == "" {
+		return "", "", "", fmt.Errorf("invalid image reference %q", ref)
+	}
+	return name, tag, digest, nil
+}
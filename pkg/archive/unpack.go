@@ -0,0 +1,240 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// Media types of the content synthesized from legacy docker save tarballs
+const (
+	mediaTypeOCILayer     = "application/vnd.oci.image.layer.v1.tar"
+	mediaTypeOCILayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+// annotationContainerdName is the full image name docker save records in index.json
+const annotationContainerdName = "io.containerd.image.name"
+
+// UnpackedArchive is a docker-archive tarball unpacked into a temporary
+// image layout, with every image named after its RepoTags
+type UnpackedArchive struct {
+	*Layout
+}
+
+// UnpackDockerArchive unpacks a tarball written by docker save or by hubsync.
+// Tarballs that already contain an image layout keep their manifests as is;
+// older ones get an OCI manifest built from manifest.json.
+func UnpackDockerArchive(path string) (*UnpackedArchive, error) {
+	dir, err := os.MkdirTemp("", "hubsync-unpack-*")
+	if err != nil {
+		return nil, errors.NewIOError("archive", "failed to create unpack directory", err)
+	}
+
+	a, err := unpack(path, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return a, nil
+}
+
+// unpack extracts the tarball into dir and names its images
+func unpack(path, dir string) (*UnpackedArchive, error) {
+	if err := extractTar(path, dir); err != nil {
+		return nil, errors.NewIOError("archive", fmt.Sprintf("failed to unpack %s", path), err)
+	}
+
+	_, statErr := os.Stat(filepath.Join(dir, "index.json"))
+	hasLayout := statErr == nil
+
+	layout, err := OpenLayout(dir)
+	if err != nil {
+		return nil, err
+	}
+	a := &UnpackedArchive{Layout: layout}
+
+	if hasLayout {
+		if err := a.nameImages(); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, errors.NewValidationError("archive", fmt.Sprintf("%s has neither index.json nor manifest.json", path), err)
+	}
+	var entries []dockerManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.NewValidationError("archive", "invalid manifest.json", err)
+	}
+	for _, entry := range entries {
+		if err := a.importLegacyImage(entry); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Close removes the unpacked content
+func (a *UnpackedArchive) Close() error {
+	return os.RemoveAll(a.Dir())
+}
+
+// nameImages gives images named by docker save, which only records the tag
+// as ref name, their full name instead
+func (a *UnpackedArchive) nameImages() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	changed := false
+	for i, desc := range a.index.Manifests {
+		name := desc.Annotations[annotationContainerdName]
+		if name == "" {
+			continue
+		}
+		a.index.Manifests[i].Annotations[AnnotationRefName] = familiarName(name)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return a.writeIndex()
+}
+
+// familiarName shortens docker.io/library/nginx:latest to nginx:latest, the
+// way docker lists RepoTags
+func familiarName(name string) string {
+	name = strings.TrimPrefix(name, "docker.io/")
+	return strings.TrimPrefix(name, "library/")
+}
+
+// importLegacyImage builds an OCI manifest for an image listed in the
+// manifest.json of a legacy docker save tarball
+func (a *UnpackedArchive) importLegacyImage(entry dockerManifestEntry) error {
+	config, err := a.importFile(entry.Config, oci.MediaTypeOCIConfig)
+	if err != nil {
+		return err
+	}
+
+	manifest := oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeOCIManifest,
+		Config:        config,
+		Layers:        make([]oci.Descriptor, 0, len(entry.Layers)),
+	}
+	for _, name := range entry.Layers {
+		layer, err := a.importFile(name, "")
+		if err != nil {
+			return err
+		}
+		manifest.Layers = append(manifest.Layers, layer)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return errors.NewOperationError("archive", "failed to encode manifest", err)
+	}
+	for _, tag := range entry.RepoTags {
+		if _, err := a.PutManifest(tag, oci.MediaTypeOCIManifest, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importFile moves an unpacked file into the layout's blob store. An empty
+// media type is detected from the content as a plain or gzipped layer.
+func (a *UnpackedArchive) importFile(name, mediaType string) (oci.Descriptor, error) {
+	path := filepath.Join(a.Dir(), filepath.FromSlash(name))
+	file, err := os.Open(path)
+	if err != nil {
+		return oci.Descriptor{}, errors.NewIOError("archive", fmt.Sprintf("missing %s in archive", name), err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if mediaType == "" {
+		mediaType = mediaTypeOCILayer
+		if magic, _ := reader.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+			mediaType = mediaTypeOCILayerGzip
+		}
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return oci.Descriptor{}, errors.NewIOError("archive", fmt.Sprintf("failed to read %s", name), err)
+	}
+	desc := oci.Descriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		Size:      size,
+	}
+
+	if !a.HasBlob(desc.Digest) {
+		blobPath, err := a.blobPath(desc.Digest)
+		if err != nil {
+			return oci.Descriptor{}, err
+		}
+		if err := os.Link(path, blobPath); err != nil {
+			return oci.Descriptor{}, errors.NewIOError("archive", fmt.Sprintf("failed to store %s", name), err)
+		}
+	}
+	return desc, nil
+}
+
+// extractTar writes the regular files of a tarball below dir
+func extractTar(path, dir string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("unsafe path %q in archive", header.Name)
+		}
+
+		target := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package bandwidth
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket limiting a rate in bytes per second. It holds
+// one second worth of tokens, and waits take their tokens up front, so a
+// large read borrows against the future and the next one waits it off.
+// A nil Limiter doesn't limit.
+type Limiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a limiter for the given rate, or returns nil when the
+// rate is not positive
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &Limiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// Rate returns the limit in bytes per second, 0 for a nil limiter
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	return int64(l.rate)
+}
+
+// WaitN blocks until n bytes may pass or the context is done
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Nothing passed, give the tokens back
+		l.mutex.Lock()
+		l.tokens += float64(n)
+		l.mutex.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,145 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Total is the throughput key of all traffic together
+const Total = "total"
+
+// Limits holds the global bandwidth limit and the limits of single
+// registries, and measures the throughput going through them. A nil Limits
+// neither limits nor measures.
+type Limits struct {
+	global     *Limiter
+	registries map[string]*Limiter
+
+	mutex   sync.Mutex
+	counted map[string]int64 // Bytes since the last sample, by registry and Total
+	sampled time.Time
+}
+
+// NewLimits creates limits from a global rate and rates by registry host, in
+// bytes per second. Rates that are not positive don't limit.
+func NewLimits(global int64, registries map[string]int64) *Limits {
+	limits := &Limits{
+		global:     NewLimiter(global),
+		registries: make(map[string]*Limiter),
+		counted:    map[string]int64{Total: 0},
+		sampled:    time.Now(),
+	}
+	for host, rate := range registries {
+		if limiter := NewLimiter(rate); limiter != nil {
+			limits.registries[Normalize(host)] = limiter
+		}
+	}
+	return limits
+}
+
+// Normalize returns the key of a registry host, Docker Hub aliases and an
+// empty host all map to docker.io
+func Normalize(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "/"))
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	switch host {
+	case "", "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
+
+// Limited reports whether any limit is set
+func (l *Limits) Limited() bool {
+	return l != nil && (l.global != nil || len(l.registries) > 0)
+}
+
+// Wait counts n bytes exchanged with the registries and blocks until the
+// global limit and the limits of each registry let them pass
+func (l *Limits) Wait(ctx context.Context, n int, registries ...string) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	hosts := make([]string, 0, len(registries))
+	l.mutex.Lock()
+	l.counted[Total] += int64(n)
+	for _, registry := range registries {
+		host := Normalize(registry)
+		if slices.Contains(hosts, host) {
+			continue
+		}
+		hosts = append(hosts, host)
+		l.counted[host] += int64(n)
+	}
+	l.mutex.Unlock()
+
+	if err := l.global.WaitN(ctx, n); err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		if err := l.registries[host].WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reader returns a reader whose reads are charged to the limits of the
+// registries the stream goes through
+func (l *Limits) Reader(ctx context.Context, r io.Reader, registries ...string) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{ctx: ctx, reader: r, limits: l, registries: registries}
+}
+
+// Throughput returns the bytes per second moved since the previous call, by
+// registry host and in total. Registries that moved bytes before keep being
+// reported, at zero once they are idle.
+func (l *Limits) Throughput() map[string]float64 {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(l.sampled).Seconds()
+	l.sampled = now
+
+	rates := make(map[string]float64, len(l.counted))
+	for key, bytes := range l.counted {
+		if elapsed > 0 {
+			rates[key] = float64(bytes) / elapsed
+		} else {
+			rates[key] = 0
+		}
+		l.counted[key] = 0
+	}
+	return rates
+}
+
+// reader charges every read to the limits
+type reader struct {
+	ctx        context.Context
+	reader     io.Reader
+	limits     *Limits
+	registries []string
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limits.Wait(r.ctx, n, r.registries...); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
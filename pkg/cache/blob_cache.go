@@ -0,0 +1,340 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+)
+
+// staleTempAge is how long a temp file has to go unwritten before it counts
+// as left over from an interrupted write
+const staleTempAge = time.Hour
+
+// BlobCache is a content-addressed blob store on disk, shared across runs.
+// Blobs are kept under <dir>/blobs/<algorithm>/<hex> and evicted least
+// recently used first once the total size exceeds the limit.
+type BlobCache struct {
+	dir     string
+	maxSize int64
+
+	mutex   sync.Mutex
+	lru     *list.List               // front is most recently used
+	entries map[string]*list.Element // digest -> element holding *entry
+	size    int64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// Stats is a snapshot of cache usage
+type Stats struct {
+	Hits    int64 // Lookups served from disk
+	Misses  int64 // Lookups that went to the network
+	Entries int   // Blobs currently cached
+	Size    int64 // Bytes currently cached
+}
+
+// entry is a cached blob
+type entry struct {
+	digest string
+	size   int64
+}
+
+// NewBlobCache opens or creates a blob cache in dir. A maxSize of zero or
+// less means the cache is unbounded.
+func NewBlobCache(dir string, maxSize int64) (*BlobCache, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0o755); err != nil {
+		return nil, errors.NewIOError("cache", "failed to create cache directory", err)
+	}
+
+	c := &BlobCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.evict("")
+	c.mutex.Unlock()
+
+	log.Debug().
+		Str("dir", dir).
+		Int("entries", len(c.entries)).
+		Int64("size", c.size).
+		Int64("max_size", maxSize).
+		Msg("Blob cache opened")
+
+	return c, nil
+}
+
+// load indexes the blobs already on disk, oldest modification time last
+func (c *BlobCache) load() error {
+	type found struct {
+		entry
+		modTime time.Time
+	}
+	var blobs []found
+
+	root := filepath.Join(c.dir, "blobs")
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		// Temp files are never indexed. Leftovers from interrupted writes are
+		// removed once idle, a recent one may be another run writing it.
+		if strings.HasPrefix(d.Name(), ".") {
+			if time.Since(info.ModTime()) > staleTempAge {
+				_ = os.Remove(path)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		digest := strings.Replace(filepath.ToSlash(rel), "/", ":", 1)
+		blobs = append(blobs, found{entry{digest: digest, size: info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return errors.NewIOError("cache", "failed to index cache directory", err)
+	}
+
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].modTime.After(blobs[j].modTime) })
+	for _, b := range blobs {
+		e := b.entry
+		c.entries[e.digest] = c.lru.PushBack(&e)
+		c.size += e.size
+	}
+
+	return nil
+}
+
+// path returns the file that holds a blob
+func (c *BlobCache) path(digest string) (string, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok || algorithm == "" || encoded == "" || strings.ContainsAny(digest, `/\.`) {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return filepath.Join(c.dir, "blobs", algorithm, encoded), nil
+}
+
+// Open returns a cached blob and its size, counting the lookup as a hit or a
+// miss. It returns false when the blob is not cached.
+func (c *BlobCache) Open(digest string) (io.ReadCloser, int64, bool) {
+	c.mutex.Lock()
+	elem, ok := c.entries[digest]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mutex.Unlock()
+
+	if !ok {
+		c.misses.Add(1)
+		return nil, 0, false
+	}
+
+	path, err := c.path(digest)
+	if err != nil {
+		c.misses.Add(1)
+		return nil, 0, false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		// Removed behind our back, forget about it
+		c.remove(digest)
+		c.misses.Add(1)
+		return nil, 0, false
+	}
+
+	// Persist the access so LRU order survives restarts
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	c.hits.Add(1)
+	return file, elem.Value.(*entry).size, true
+}
+
+// Writer returns a writer that stores a blob once its content is verified.
+// It returns nil when the blob is already cached or larger than the cache.
+func (c *BlobCache) Writer(digest string, size int64) (*BlobWriter, error) {
+	if c.maxSize > 0 && size > c.maxSize {
+		return nil, nil
+	}
+
+	c.mutex.Lock()
+	_, cached := c.entries[digest]
+	c.mutex.Unlock()
+	if cached {
+		return nil, nil
+	}
+
+	// Only sha256 content can be verified before it is stored
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil, nil
+	}
+	path, err := c.path(digest)
+	if err != nil {
+		return nil, errors.NewValidationError("cache", "cannot cache blob", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.NewIOError("cache", "failed to create cache directory", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return nil, errors.NewIOError("cache", "failed to create cache file", err)
+	}
+
+	return &BlobWriter{
+		cache:  c,
+		digest: digest,
+		path:   path,
+		file:   file,
+		hash:   sha256.New(),
+	}, nil
+}
+
+// Stats returns a snapshot of cache usage
+func (c *BlobCache) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return Stats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: len(c.entries),
+		Size:    c.size,
+	}
+}
+
+// add records a committed blob and evicts older ones if needed
+func (c *BlobCache) add(digest string, size int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.entries[digest]; ok {
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[digest] = c.lru.PushFront(&entry{digest: digest, size: size})
+	c.size += size
+	c.evict(digest)
+}
+
+// remove forgets a blob without touching the disk
+func (c *BlobCache) remove(digest string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.entries[digest]; ok {
+		c.size -= elem.Value.(*entry).size
+		c.lru.Remove(elem)
+		delete(c.entries, digest)
+	}
+}
+
+// evict deletes least recently used blobs until the cache fits its limit,
+// never evicting keep. The caller must hold the mutex.
+func (c *BlobCache) evict(keep string) {
+	if c.maxSize <= 0 {
+		return
+	}
+
+	for elem := c.lru.Back(); elem != nil && c.size > c.maxSize; {
+		prev := elem.Prev()
+		e := elem.Value.(*entry)
+		if e.digest != keep {
+			if path, err := c.path(e.digest); err == nil {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					log.Warn().Err(err).Str("digest", e.digest).Msg("Failed to evict cached blob")
+				}
+			}
+			c.size -= e.size
+			c.lru.Remove(elem)
+			delete(c.entries, e.digest)
+			log.Debug().Str("digest", e.digest).Int64("size", e.size).Msg("Evicted cached blob")
+		}
+		elem = prev
+	}
+}
+
+// BlobWriter stores a single blob in the cache
+type BlobWriter struct {
+	cache  *BlobCache
+	digest string
+	path   string
+	file   *os.File
+	hash   hash.Hash
+	size   int64
+	err    error
+}
+
+// Write implements io.Writer. It never fails so that a full disk doesn't
+// interrupt the stream being cached, errors are reported by Commit instead.
+func (w *BlobWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		_, w.err = w.file.Write(p)
+		w.hash.Write(p)
+		w.size += int64(len(p))
+	}
+	return len(p), nil
+}
+
+// Commit verifies the written content against the digest and makes it
+// available to readers
+func (w *BlobWriter) Commit() error {
+	if w.err != nil {
+		w.Abort()
+		return errors.NewIOError("cache", "failed to write cache file", w.err)
+	}
+	if err := w.file.Close(); err != nil {
+		_ = os.Remove(w.file.Name())
+		return errors.NewIOError("cache", "failed to write cache file", err)
+	}
+
+	if actual := "sha256:" + hex.EncodeToString(w.hash.Sum(nil)); actual != w.digest {
+		_ = os.Remove(w.file.Name())
+		return errors.NewVerificationError("cache",
+			fmt.Sprintf("cached content digest %s does not match %s", actual, w.digest), nil)
+	}
+
+	if err := os.Rename(w.file.Name(), w.path); err != nil {
+		_ = os.Remove(w.file.Name())
+		return errors.NewIOError("cache", "failed to store cache file", err)
+	}
+
+	w.cache.add(w.digest, w.size)
+	return nil
+}
+
+// Abort discards the written content
+func (w *BlobWriter) Abort() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
@@ -0,0 +1,113 @@
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+)
+
+// Compression algorithms layers can be converted to
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Algorithms lists every supported compression algorithm
+var Algorithms = []string{Gzip, Zstd}
+
+// Layer media types by compression
+const (
+	MediaTypeOCILayer        = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeOCILayerGzip    = "application/vnd.oci.image.layer.v1.tar+gzip"
+	MediaTypeOCILayerZstd    = "application/vnd.oci.image.layer.v1.tar+zstd"
+	MediaTypeDockerLayer     = "application/vnd.docker.image.rootfs.diff.tar"
+	MediaTypeDockerLayerGzip = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// IsSupported reports whether layers can be converted to the algorithm
+func IsSupported(algorithm string) bool {
+	return algorithm == Gzip || algorithm == Zstd
+}
+
+// Detect returns the compression of a layer media type, or "" when the
+// layer is not a compressed image layer that can be converted
+func Detect(mediaType string) string {
+	switch mediaType {
+	case MediaTypeOCILayerGzip, MediaTypeDockerLayerGzip:
+		return Gzip
+	case MediaTypeOCILayerZstd:
+		return Zstd
+	}
+	return ""
+}
+
+// LayerMediaType returns the OCI media type of a layer compressed with the
+// algorithm. Docker manifests have no zstd layer type, so converted images
+// always use OCI media types.
+func LayerMediaType(algorithm string) string {
+	if algorithm == Zstd {
+		return MediaTypeOCILayerZstd
+	}
+	return MediaTypeOCILayerGzip
+}
+
+// OCILayerMediaType maps Docker layer media types to their OCI equivalent
+func OCILayerMediaType(mediaType string) string {
+	switch mediaType {
+	case MediaTypeDockerLayerGzip:
+		return MediaTypeOCILayerGzip
+	case MediaTypeDockerLayer:
+		return MediaTypeOCILayer
+	}
+	return mediaType
+}
+
+// Recompress reads src compressed with one algorithm and writes it to dst
+// compressed with another
+func Recompress(dst io.Writer, src io.Reader, from, to string) error {
+	var reader io.Reader
+	switch from {
+	case Gzip:
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return errors.NewValidationError("compression", "invalid gzip stream", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case Zstd:
+		zr, err := zstd.NewReader(src)
+		if err != nil {
+			return errors.NewValidationError("compression", "invalid zstd stream", err)
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return errors.NewValidationError("compression", fmt.Sprintf("unsupported compression %q", from), nil)
+	}
+
+	var writer io.WriteCloser
+	switch to {
+	case Gzip:
+		writer = gzip.NewWriter(dst)
+	case Zstd:
+		zw, err := zstd.NewWriter(dst)
+		if err != nil {
+			return errors.NewOperationError("compression", "failed to create zstd encoder", err)
+		}
+		writer = zw
+	default:
+		return errors.NewValidationError("compression", fmt.Sprintf("unsupported compression %q", to), nil)
+	}
+
+	if _, err := io.Copy(writer, reader); err != nil {
+		return errors.NewIOError("compression", fmt.Sprintf("failed to convert %s to %s", from, to), err)
+	}
+	if err := writer.Close(); err != nil {
+		return errors.NewIOError("compression", fmt.Sprintf("failed to finish %s stream", to), err)
+	}
+	return nil
+}
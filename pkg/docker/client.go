@@ -6,28 +6,58 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
 	"github.com/rs/zerolog/log"
 
+	"github.com/yugasun/hubsync/pkg/bandwidth"
 	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
 )
 
 // ClientInterface defines the interface for Docker operations
 type ClientInterface interface {
-	PullImage(ctx context.Context, imageName string) error
+	PullImage(ctx context.Context, imageName string) (*Progress, error)
 	TagImage(ctx context.Context, source, target string) error
-	PushImage(ctx context.Context, imageName string) error
+	PushImage(ctx context.Context, imageName string) (*Progress, error)
 	VerifyCredentials(ctx context.Context) error
 	GetImageInfo(ctx context.Context, imageName string) (*ImageReference, error)
+	RemoveImage(ctx context.Context, imageName string) error
 	Close() error
 }
 
-// Ensure Client implements ClientInterface
-var _ ClientInterface = (*Client)(nil)
+// ImagePruner is implemented by clients that can prune dangling images
+type ImagePruner interface {
+	// PruneDanglingImages removes the untagged images left in the local daemon
+	PruneDanglingImages(ctx context.Context) (*PruneReport, error)
+}
+
+// DaemonInspector is implemented by clients that can describe their daemon
+type DaemonInspector interface {
+	// DaemonInfo returns the data root and platform of the daemon
+	DaemonInfo(ctx context.Context) (*DaemonInfo, error)
+}
+
+// BandwidthLimited is implemented by clients whose pulls and pushes are
+// charged to bandwidth limits
+type BandwidthLimited interface {
+	// Bandwidth returns the limits pulls and pushes are charged to
+	Bandwidth() *bandwidth.Limits
+}
+
+// Ensure Client implements ClientInterface, ImagePruner, DaemonInspector and
+// BandwidthLimited
+var (
+	_ ClientInterface  = (*Client)(nil)
+	_ ImagePruner      = (*Client)(nil)
+	_ DaemonInspector  = (*Client)(nil)
+	_ BandwidthLimited = (*Client)(nil)
+)
 
 // NewClient creates a new Docker client with the given configuration
 func NewClient(cfg ClientConfig) (*Client, error) {
@@ -75,12 +105,19 @@ func (c *Client) VerifyCredentials(ctx context.Context) error {
 	return nil
 }
 
-// PerformWithRetry performs an operation with retry logic
+// PerformWithRetry performs an operation with retry logic and returns the
+// progress decoded from its output. Errors reported in the output fail the
+// attempt like errors returned by the operation.
 func (c *Client) performWithRetry(ctx context.Context, imageName, operationType string, timeout time.Duration,
 	operation func(opCtx context.Context) (io.ReadCloser, error),
-) error {
+) (*Progress, error) {
 	log.Debug().Str("image", imageName).Msgf("%sing image", operationType)
 
+	registry := oci.DockerHubDomain
+	if ref, err := oci.ParseReference(imageName); err == nil {
+		registry = ref.Registry
+	}
+
 	var lastErr error
 	for attempt := 0; attempt <= c.Config.RetryCount; attempt++ {
 		if attempt > 0 {
@@ -104,7 +141,7 @@ func (c *Client) performWithRetry(ctx context.Context, imageName, operationType
 			select {
 			case <-time.After(backoffDelay):
 			case <-ctx.Done():
-				return errors.NewContextError("docker", fmt.Sprintf("context cancelled during %s retry wait", operationType), ctx.Err())
+				return nil, errors.NewContextError("docker", fmt.Sprintf("context cancelled during %s retry wait", operationType), ctx.Err())
 			}
 		}
 
@@ -113,14 +150,20 @@ func (c *Client) performWithRetry(ctx context.Context, imageName, operationType
 		output, err := operation(opCtx)
 
 		if err == nil {
-			defer output.Close()
 			// We need to read the output to completion or the operation may hang
-			if _, err := io.Copy(io.Discard, output); err != nil {
+			var progress *Progress
+			progress, err = ReadProgress(opCtx, output, imageName, registry, c.Config.Bandwidth)
+			output.Close()
+			if err == nil {
 				cancel()
-				return errors.NewIOError("docker", fmt.Sprintf("error reading %s output", operationType), err)
+				log.Debug().Str("image", imageName).Str("progress", progress.String()).Msgf("%s completed", operationType)
+				c.recordLayers(strings.ToLower(operationType), progress)
+				return progress, nil
+			}
+			if !errors.IsOperationError(err) {
+				cancel()
+				return progress, errors.NewIOError("docker", fmt.Sprintf("error reading %s output", operationType), err)
 			}
-			cancel()
-			return nil
 		}
 
 		cancel()
@@ -128,15 +171,29 @@ func (c *Client) performWithRetry(ctx context.Context, imageName, operationType
 		log.Warn().Err(err).Str("image", imageName).Int("attempt", attempt+1).Msgf("%s attempt failed", operationType)
 	}
 
-	return errors.NewOperationError(
+	return nil, errors.NewOperationError(
 		"docker",
 		fmt.Sprintf("failed to %s image after %d attempts", operationType, c.Config.RetryCount+1),
 		lastErr,
 	)
 }
 
+// recordLayers records the layers of a finished pull or push in the metrics
+func (c *Client) recordLayers(operation string, progress *Progress) {
+	if c.Config.Metrics == nil {
+		return
+	}
+	for _, layer := range progress.Layers {
+		result := "moved"
+		if layer.Skipped() {
+			result = "skipped"
+		}
+		c.Config.Metrics.RecordDaemonLayer(operation, result, layer.Moved)
+	}
+}
+
 // PullImage pulls a Docker image with retry logic
-func (c *Client) PullImage(ctx context.Context, imageName string) error {
+func (c *Client) PullImage(ctx context.Context, imageName string) (*Progress, error) {
 	return c.performWithRetry(ctx, imageName, "Pull", c.Config.PullTimeout, func(opCtx context.Context) (io.ReadCloser, error) {
 		// DO NOT add auth config to the pull options
 		return c.DockerClient.ImagePull(opCtx, imageName, image.PullOptions{})
@@ -154,14 +211,81 @@ func (c *Client) TagImage(ctx context.Context, source, target string) error {
 }
 
 // PushImage pushes a Docker image with retry logic
-func (c *Client) PushImage(ctx context.Context, imageName string) error {
+func (c *Client) PushImage(ctx context.Context, imageName string) (*Progress, error) {
+	authStr, err := c.pushAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	return c.performWithRetry(ctx, imageName, "Push", c.Config.PushTimeout, func(opCtx context.Context) (io.ReadCloser, error) {
 		return c.DockerClient.ImagePush(opCtx, imageName, image.PushOptions{
-			RegistryAuth: c.AuthStr,
+			RegistryAuth: authStr,
 		})
 	})
 }
 
+// pushAuth returns the auth string of a push, asking the login function for
+// fresh credentials when one is set
+func (c *Client) pushAuth(ctx context.Context) (string, error) {
+	if c.Config.Login == nil {
+		return c.AuthStr, nil
+	}
+
+	username, password, err := c.Config.Login(ctx)
+	if err != nil {
+		return "", errors.NewAuthError("docker", "failed to get registry credentials", err)
+	}
+	authStr, err := getAuthString(registry.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: c.AuthConfig.ServerAddress,
+	})
+	if err != nil {
+		return "", errors.NewClientError("docker", "failed to create auth string", err)
+	}
+	return authStr, nil
+}
+
+// RemoveImage removes an image tag from the local daemon. Layers are
+// deleted once no other tag references them.
+func (c *Client) RemoveImage(ctx context.Context, imageName string) error {
+	log.Debug().Str("image", imageName).Msg("Removing image")
+
+	if _, err := c.DockerClient.ImageRemove(ctx, imageName, image.RemoveOptions{PruneChildren: true}); err != nil {
+		return errors.NewOperationError("docker", "failed to remove image", err).WithDetail("image", imageName)
+	}
+	return nil
+}
+
+// PruneDanglingImages removes the untagged images left behind in the local
+// daemon, e.g. by tags that moved to a newer image
+func (c *Client) PruneDanglingImages(ctx context.Context) (*PruneReport, error) {
+	log.Debug().Msg("Pruning dangling images")
+
+	report, err := c.DockerClient.ImagesPrune(ctx, filters.NewArgs(filters.Arg("dangling", "true")))
+	if err != nil {
+		return nil, errors.NewOperationError("docker", "failed to prune dangling images", err)
+	}
+	return &PruneReport{
+		ImagesDeleted:  len(report.ImagesDeleted),
+		SpaceReclaimed: int64(report.SpaceReclaimed),
+	}, nil
+}
+
+// DaemonInfo returns the directory the daemon stores images in and the
+// platform of the images it pulls, which may differ from the platform
+// hubsync runs on when the daemon is remote
+func (c *Client) DaemonInfo(ctx context.Context) (*DaemonInfo, error) {
+	info, err := c.DockerClient.Info(ctx)
+	if err != nil {
+		return nil, errors.NewClientError("docker", "failed to read daemon info", err)
+	}
+	return &DaemonInfo{
+		DataRoot: info.DockerRootDir,
+		Platform: oci.DaemonPlatform(info.OSType, info.Architecture),
+	}, nil
+}
+
 // GetImageInfo retrieves information about a Docker image
 func (c *Client) GetImageInfo(ctx context.Context, imageName string) (*ImageReference, error) {
 	// Implementation will parse the image name and return ImageReference
@@ -171,6 +295,11 @@ func (c *Client) GetImageInfo(ctx context.Context, imageName string) (*ImageRefe
 	}, nil
 }
 
+// Bandwidth returns the limits pulls and pushes are charged to
+func (c *Client) Bandwidth() *bandwidth.Limits {
+	return c.Config.Bandwidth
+}
+
 // Close closes the Docker client
 func (c *Client) Close() error {
 	if c.DockerClient != nil {
@@ -1,10 +1,15 @@
 package docker
 
 import (
+	"context"
 	"time"
 
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+
+	"github.com/yugasun/hubsync/pkg/bandwidth"
+	"github.com/yugasun/hubsync/pkg/observability"
+	"github.com/yugasun/hubsync/pkg/oci"
 )
 
 // ClientConfig holds configuration for a Docker client
@@ -19,8 +24,15 @@ type ClientConfig struct {
 	APIVersion  string
 	TLSVerify   bool
 	CertPath    string
+	Metrics     *observability.MetricsManager // Records layer progress, nil for none
+	Bandwidth   *bandwidth.Limits             // Limits pulls and pushes are charged to, nil for none
+	Login       LoginFunc                     // Looks up push credentials before every push, overriding Username and Password
 }
 
+// LoginFunc returns the current username and password of a registry that
+// hands out short-lived tokens
+type LoginFunc func(ctx context.Context) (username, password string, err error)
+
 // Client represents a Docker client with all necessary operations
 type Client struct {
 	DockerClient *client.Client
@@ -41,6 +53,18 @@ func DefaultClientConfig() ClientConfig {
 	}
 }
 
+// DaemonInfo describes the Docker daemon a client talks to
+type DaemonInfo struct {
+	DataRoot string       // Directory the daemon stores images in
+	Platform oci.Platform // Platform of the images the daemon pulls
+}
+
+// PruneReport sums up a prune of dangling images
+type PruneReport struct {
+	ImagesDeleted  int   // Number of images and layers deleted
+	SpaceReclaimed int64 // Disk space freed in bytes
+}
+
 // ImageReference represents a Docker image reference
 type ImageReference struct {
 	Registry   string
@@ -49,6 +73,7 @@ type ImageReference struct {
 	Tag        string
 	Digest     string
 	FullName   string
+	Platforms  []string // os/arch[/variant] entries to copy from a multi-platform image, empty means all
 }
 
 // SyncOperation represents a sync operation between source and target images
@@ -0,0 +1,214 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/bandwidth"
+	"github.com/yugasun/hubsync/pkg/errors"
+)
+
+// Layer statuses reported by the daemon while pulling and pushing
+const (
+	statusDownloading      = "Downloading"
+	statusDownloadComplete = "Download complete"
+	statusPullComplete     = "Pull complete"
+	statusAlreadyExists    = "Already exists"
+	statusPushing          = "Pushing"
+	statusPushed           = "Pushed"
+	statusLayerExists      = "Layer already exists"
+	statusMountedFrom      = "Mounted from"
+)
+
+// message is one entry of a pull or push output stream, in the jsonmessage
+// format of the Docker API
+type message struct {
+	Status   string `json:"status"`
+	ID       string `json:"id"`
+	Progress *struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+	ErrorMessage string          `json:"error"`
+	Aux          json.RawMessage `json:"aux"`
+}
+
+// LayerProgress is how far a layer got in a pull or push
+type LayerProgress struct {
+	ID     string // Short layer ID shown by the daemon
+	Status string // Last status, e.g. Pull complete or Layer already exists
+	Moved  int64  // Bytes downloaded or uploaded
+	Size   int64  // Size of the layer, 0 when the daemon didn't report it
+}
+
+// Skipped reports whether the layer was already present and not moved
+func (l *LayerProgress) Skipped() bool {
+	return l.Status == statusAlreadyExists || l.Status == statusLayerExists ||
+		strings.HasPrefix(l.Status, statusMountedFrom)
+}
+
+// Progress sums up the output stream of a pull or push
+type Progress struct {
+	Digest string           // Manifest digest reported by the daemon, empty when none
+	Layers []*LayerProgress // Layers in the order the daemon first reported them
+	layers map[string]*LayerProgress
+	image  string
+}
+
+// Size returns the total size of the layers whose size was reported
+func (p *Progress) Size() int64 {
+	var size int64
+	for _, layer := range p.Layers {
+		size += layer.Size
+	}
+	return size
+}
+
+// BytesMoved returns the bytes downloaded or uploaded over all layers
+func (p *Progress) BytesMoved() int64 {
+	var moved int64
+	for _, layer := range p.Layers {
+		moved += layer.Moved
+	}
+	return moved
+}
+
+// SkippedLayers returns the number of layers that were already present
+func (p *Progress) SkippedLayers() int {
+	skipped := 0
+	for _, layer := range p.Layers {
+		if layer.Skipped() {
+			skipped++
+		}
+	}
+	return skipped
+}
+
+// String summarizes the progress for logs
+func (p *Progress) String() string {
+	return fmt.Sprintf("%d layers, %d skipped, %d of %d bytes moved",
+		len(p.Layers), p.SkippedLayers(), p.BytesMoved(), p.Size())
+}
+
+// ReadProgress decodes a pull or push output stream to its end. Layer
+// progress is charged to the limits of the registry as it comes in, and
+// holding back the stream slows the daemon down. An error entry in the
+// stream fails the read.
+func ReadProgress(ctx context.Context, output io.Reader, imageName, registry string, limits *bandwidth.Limits) (*Progress, error) {
+	progress := &Progress{layers: make(map[string]*LayerProgress), image: imageName}
+	decoder := json.NewDecoder(output)
+	for {
+		var msg message
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return progress, nil
+			}
+			return progress, errors.NewIOError("docker", "failed to decode progress stream", err)
+		}
+
+		if msg.Error != nil || msg.ErrorMessage != "" {
+			text := msg.ErrorMessage
+			if msg.Error != nil && msg.Error.Message != "" {
+				text = msg.Error.Message
+			}
+			return progress, errors.NewOperationError("docker", text, nil)
+		}
+
+		if digest := messageDigest(msg); digest != "" {
+			progress.Digest = digest
+		}
+		if msg.ID == "" {
+			continue
+		}
+
+		moved := progress.update(msg)
+		if moved > 0 {
+			if err := limits.Wait(ctx, int(moved), registry); err != nil {
+				return progress, errors.NewContextError("docker", "context cancelled while limiting bandwidth", err)
+			}
+		}
+	}
+}
+
+// update applies a layer message and returns the bytes it moved
+func (p *Progress) update(msg message) int64 {
+	layer, ok := p.layers[msg.ID]
+	if !ok {
+		// Tags and digests share the stream with layers, only track layers
+		if !isLayerStatus(msg.Status) {
+			return 0
+		}
+		layer = &LayerProgress{ID: msg.ID}
+		p.layers[msg.ID] = layer
+		p.Layers = append(p.Layers, layer)
+	}
+
+	var moved int64
+	switch {
+	case msg.Status == statusDownloading || msg.Status == statusPushing:
+		if msg.Progress != nil {
+			if msg.Progress.Total > 0 {
+				layer.Size = msg.Progress.Total
+			}
+			if msg.Progress.Current > layer.Moved {
+				moved = msg.Progress.Current - layer.Moved
+				layer.Moved = msg.Progress.Current
+			}
+		}
+	case msg.Status == statusDownloadComplete || msg.Status == statusPushed:
+		// The last progress update may fall short of the whole layer
+		if layer.Size > layer.Moved {
+			moved = layer.Size - layer.Moved
+			layer.Moved = layer.Size
+		}
+	}
+
+	// Progress updates repeat, log each status once
+	if layer.Status != msg.Status {
+		layer.Status = msg.Status
+		log.Debug().
+			Str("image", p.image).
+			Str("layer", layer.ID).
+			Str("status", layer.Status).
+			Int64("size", layer.Size).
+			Msg("Layer progress")
+	}
+	return moved
+}
+
+// isLayerStatus reports whether a status is about a layer
+func isLayerStatus(status string) bool {
+	switch status {
+	case "Pulling fs layer", "Waiting", "Verifying Checksum", "Extracting", "Preparing",
+		statusDownloading, statusDownloadComplete, statusPullComplete, statusAlreadyExists,
+		statusPushing, statusPushed, statusLayerExists:
+		return true
+	}
+	return strings.HasPrefix(status, statusMountedFrom) || strings.HasPrefix(status, "Retrying")
+}
+
+// messageDigest returns the manifest digest a message reports. Pulls end
+// with a "Digest: sha256:..." status, pushes with an aux entry.
+func messageDigest(msg message) string {
+	if digest, ok := strings.CutPrefix(msg.Status, "Digest: "); ok {
+		return digest
+	}
+	if len(msg.Aux) > 0 {
+		var aux struct {
+			Digest string `json:"Digest"`
+		}
+		if err := json.Unmarshal(msg.Aux, &aux); err == nil {
+			return aux.Digest
+		}
+	}
+	return ""
+}
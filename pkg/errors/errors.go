@@ -30,6 +30,12 @@ const (
 	// ContextError represents context-related errors
 	ContextError ErrorType = "context"
 
+	// VerificationError represents content that does not match its expected digest
+	VerificationError ErrorType = "verification"
+
+	// QuotaError represents a registry refusing content over its storage quota
+	QuotaError ErrorType = "quota"
+
 	// SystemError represents system-level errors
 	SystemError ErrorType = "system"
 
@@ -146,6 +152,28 @@ func NewContextError(domain, message string, cause error) *DomainError {
 	}
 }
 
+// NewVerificationError creates a new verification error
+func NewVerificationError(domain, message string, cause error) *DomainError {
+	return &DomainError{
+		Type:      VerificationError,
+		Domain:    domain,
+		Message:   message,
+		Cause:     cause,
+		Timestamp: time.Now(),
+	}
+}
+
+// NewQuotaError creates a new storage quota error
+func NewQuotaError(domain, message string, cause error) *DomainError {
+	return &DomainError{
+		Type:      QuotaError,
+		Domain:    domain,
+		Message:   message,
+		Cause:     cause,
+		Timestamp: time.Now(),
+	}
+}
+
 // NewSystemError creates a new system-level error
 func NewSystemError(domain, message string, cause error) *DomainError {
 	return &DomainError{
@@ -200,6 +228,16 @@ func IsContextError(err error) bool {
 	return IsErrorOfType(err, ContextError)
 }
 
+// IsVerificationError checks if an error is a verification error
+func IsVerificationError(err error) bool {
+	return IsErrorOfType(err, VerificationError)
+}
+
+// IsQuotaError checks if an error is a storage quota error
+func IsQuotaError(err error) bool {
+	return IsErrorOfType(err, QuotaError)
+}
+
 // IsSystemError checks if an error is a system error
 func IsSystemError(err error) bool {
 	return IsErrorOfType(err, SystemError)
@@ -56,6 +56,20 @@ func (m *MetricsManager) initializeDefaultMetrics() {
 	// Create a counter for sync operations
 	m.CreateCounter("sync_operations_total", "Total count of sync operations", []string{"source", "target", "status"})
 
+	// Create a counter for post-push digest verification outcomes
+	m.CreateCounter("digest_verifications_total", "Total count of target digest verifications", []string{"status"})
+
+	// Create blob cache metrics
+	m.CreateCounter("blob_cache_lookups_total", "Total count of blob cache lookups", []string{"result"})
+	m.CreateGauge("blob_cache_size_bytes", "Current size of the blob cache in bytes", nil)
+
+	// Create daemon pull and push layer metrics
+	m.CreateCounter("daemon_layers_total", "Total count of layers pulled or pushed through the daemon", []string{"operation", "result"})
+	m.CreateCounter("daemon_bytes_total", "Total bytes pulled or pushed through the daemon", []string{"operation"})
+
+	// Create a gauge for the current transfer rate
+	m.CreateGauge("transfer_throughput_bytes_per_second", "Current transfer rate in bytes per second", []string{"registry"})
+
 	// Create a histogram for operation durations
 	m.CreateHistogram(
 		"operation_duration_seconds",
@@ -354,6 +368,56 @@ func (m *MetricsManager) RecordSyncOperation(source, target, status string) {
 	m.IncrementCounter("sync_operations_total", 1, source, target, status)
 }
 
+// RecordDigestVerification records the outcome of a target digest verification
+func (m *MetricsManager) RecordDigestVerification(status string) {
+	if !m.enabled {
+		return
+	}
+
+	m.IncrementCounter("digest_verifications_total", 1, status)
+}
+
+// RecordBlobCache records blob cache hits, misses and its current size
+func (m *MetricsManager) RecordBlobCache(hits, misses, size int64) {
+	if !m.enabled {
+		return
+	}
+
+	m.IncrementCounter("blob_cache_lookups_total", float64(hits), "hit")
+	m.IncrementCounter("blob_cache_lookups_total", float64(misses), "miss")
+	m.SetGauge("blob_cache_size_bytes", float64(size))
+}
+
+// RecordDaemonLayer records a layer pulled or pushed through the daemon, the
+// result is moved or skipped
+func (m *MetricsManager) RecordDaemonLayer(operation, result string, bytes int64) {
+	if !m.enabled {
+		return
+	}
+
+	m.IncrementCounter("daemon_layers_total", 1, operation, result)
+	m.IncrementCounter("daemon_bytes_total", float64(bytes), operation)
+}
+
+// RecordImageSize records the size of a synchronized image
+func (m *MetricsManager) RecordImageSize(image string, size int64) {
+	if !m.enabled {
+		return
+	}
+
+	m.ObserveSummary("image_size_bytes", float64(size), image)
+}
+
+// RecordThroughput records the current transfer rate of a registry, or of
+// all registries together
+func (m *MetricsManager) RecordThroughput(registry string, bytesPerSecond float64) {
+	if !m.enabled {
+		return
+	}
+
+	m.SetGauge("transfer_throughput_bytes_per_second", bytesPerSecond, registry)
+}
+
 // Close releases resources associated with metrics manager
 func (m *MetricsManager) Close() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -0,0 +1,275 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+)
+
+// Credentials holds the username and password used for a registry host
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialFunc returns the credentials to use for a registry host.
+// An empty Credentials value means anonymous access.
+type CredentialFunc func(host string) Credentials
+
+// StaticCredentials returns a CredentialFunc that uses the given credentials
+// for the listed hosts and anonymous access for everything else
+func StaticCredentials(creds Credentials, hosts ...string) CredentialFunc {
+	return func(host string) Credentials {
+		for _, h := range hosts {
+			if h == host {
+				return creds
+			}
+		}
+		return Credentials{}
+	}
+}
+
+// TokenFunc returns a bearer token and its expiry for a registry host and
+// scope, for registries that hand out tokens through their own exchange. An
+// empty token falls back to the realm of the challenge.
+type TokenFunc func(ctx context.Context, host, scope string) (string, time.Time, error)
+
+// challenge is a parsed WWW-Authenticate header
+type challenge struct {
+	scheme string
+	params map[string]string
+}
+
+// tokenEntry is a cached bearer token
+type tokenEntry struct {
+	token   string
+	expires time.Time
+}
+
+// authenticator answers WWW-Authenticate challenges and caches the results
+type authenticator struct {
+	client      *http.Client
+	credentials CredentialFunc
+	tokenFunc   TokenFunc
+	mutex       sync.Mutex
+	challenges  map[string]challenge
+	tokens      map[string]tokenEntry
+}
+
+// newAuthenticator creates a new authenticator
+func newAuthenticator(client *http.Client, credentials CredentialFunc, tokenFunc TokenFunc) *authenticator {
+	if credentials == nil {
+		credentials = func(string) Credentials { return Credentials{} }
+	}
+	return &authenticator{
+		client:      client,
+		credentials: credentials,
+		tokenFunc:   tokenFunc,
+		challenges:  make(map[string]challenge),
+		tokens:      make(map[string]tokenEntry),
+	}
+}
+
+// authorize adds the Authorization header for a host and scope if one is known
+func (a *authenticator) authorize(req *http.Request, host, scope string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	ch, ok := a.challenges[host]
+	if !ok {
+		return
+	}
+
+	switch ch.scheme {
+	case "basic":
+		creds := a.credentials(host)
+		if creds.Username != "" {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+	case "bearer":
+		if entry, ok := a.tokens[host+" "+scope]; ok && time.Now().Before(entry.expires) {
+			req.Header.Set("Authorization", "Bearer "+entry.token)
+			return
+		}
+		// A push token for the same repository also grants pull
+		if strings.HasSuffix(scope, ":pull") {
+			if entry, ok := a.tokens[host+" "+scope+",push"]; ok && time.Now().Before(entry.expires) {
+				req.Header.Set("Authorization", "Bearer "+entry.token)
+			}
+		}
+	}
+}
+
+// handleChallenge processes the WWW-Authenticate header of a 401 response so
+// that the next call to authorize for the same host and scope succeeds
+func (a *authenticator) handleChallenge(ctx context.Context, resp *http.Response, host, scope string) error {
+	ch, ok := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !ok {
+		return errors.NewAuthError("oci", fmt.Sprintf("unsupported authentication challenge from %s", host), nil)
+	}
+
+	a.mutex.Lock()
+	a.challenges[host] = ch
+	a.mutex.Unlock()
+
+	if ch.scheme == "basic" {
+		if a.credentials(host).Username == "" {
+			return errors.NewAuthError("oci", fmt.Sprintf("registry %s requires credentials", host), nil)
+		}
+		return nil
+	}
+
+	entry, err := a.token(ctx, host, ch, scope)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	a.tokens[host+" "+scope] = entry
+	a.mutex.Unlock()
+
+	return nil
+}
+
+// token gets a bearer token from the token function, or else from the realm
+func (a *authenticator) token(ctx context.Context, host string, ch challenge, scope string) (tokenEntry, error) {
+	if a.tokenFunc != nil {
+		token, expires, err := a.tokenFunc(ctx, host, scope)
+		if err != nil {
+			return tokenEntry{}, err
+		}
+		if token != "" {
+			return tokenEntry{token: token, expires: expires}, nil
+		}
+	}
+	return a.fetchToken(ctx, host, ch, scope)
+}
+
+// fetchToken requests a bearer token from the realm named in the challenge
+func (a *authenticator) fetchToken(ctx context.Context, host string, ch challenge, scope string) (tokenEntry, error) {
+	realm := ch.params["realm"]
+	if realm == "" {
+		return tokenEntry{}, errors.NewAuthError("oci", fmt.Sprintf("bearer challenge from %s has no realm", host), nil)
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return tokenEntry{}, errors.NewAuthError("oci", "invalid token realm", err)
+	}
+
+	query := tokenURL.Query()
+	if service := ch.params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	for _, s := range strings.Fields(scope) {
+		query.Add("scope", s)
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return tokenEntry{}, errors.NewOperationError("oci", "failed to create token request", err)
+	}
+
+	if creds := a.credentials(host); creds.Username != "" {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return tokenEntry{}, errors.NewOperationError("oci", "failed to execute token request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return tokenEntry{}, errors.NewAuthError("oci",
+			fmt.Sprintf("token request to %s failed with status %d: %s", tokenURL.Host, resp.StatusCode, strings.TrimSpace(string(body))), nil)
+	}
+
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return tokenEntry{}, errors.NewOperationError("oci", "failed to decode token response", err)
+	}
+
+	token := tokenResp.Token
+	if token == "" {
+		token = tokenResp.AccessToken
+	}
+	if token == "" {
+		return tokenEntry{}, errors.NewAuthError("oci", fmt.Sprintf("token response from %s contained no token", tokenURL.Host), nil)
+	}
+
+	// The distribution spec defaults to 60 seconds when expires_in is omitted
+	expiresIn := 60
+	if tokenResp.ExpiresIn > 0 {
+		expiresIn = tokenResp.ExpiresIn
+	}
+
+	log.Debug().
+		Str("host", host).
+		Str("scope", scope).
+		Int("expires_in", expiresIn).
+		Msg("Obtained registry token")
+
+	// Refresh a little early so in-flight requests don't race the expiry
+	return tokenEntry{
+		token:   token,
+		expires: time.Now().Add(time.Duration(expiresIn)*time.Second - 5*time.Second),
+	}, nil
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// Bearer realm="https://auth.example.com/token",service="registry.example.com"
+func parseChallenge(header string) (challenge, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return challenge{}, false
+	}
+
+	scheme, rest, _ := strings.Cut(header, " ")
+	ch := challenge{
+		scheme: strings.ToLower(scheme),
+		params: make(map[string]string),
+	}
+	if ch.scheme != "basic" && ch.scheme != "bearer" {
+		return challenge{}, false
+	}
+
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		key, value, found := strings.Cut(rest, "=")
+		if !found {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				ch.params[key] = value[1:]
+				break
+			}
+			ch.params[key] = value[1 : end+1]
+			rest = strings.TrimPrefix(strings.TrimSpace(value[end+2:]), ",")
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			ch.params[key] = strings.TrimSpace(value)
+		}
+	}
+
+	return ch, true
+}
@@ -0,0 +1,138 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+)
+
+// catalogScope is the token scope for listing the repositories of a registry
+const catalogScope = "registry:catalog:*"
+
+// Ping checks that host serves the distribution API, answering its
+// authentication challenge so that later requests are authorized
+func (c *Client) Ping(ctx context.Context, host string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(host, "/v2/"), nil)
+	if err != nil {
+		return errors.NewOperationError("oci", "failed to create ping request", err)
+	}
+
+	resp, err := c.do(req, host, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errors.NewAuthError("oci", fmt.Sprintf("registry %s rejected the credentials", host), responseError(resp))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.NewOperationError("oci", fmt.Sprintf("registry %s is not available", host), responseError(resp))
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Catalog lists the repositories of a registry, following every page
+func (c *Client) Catalog(ctx context.Context, host string) ([]string, error) {
+	var repositories []string
+	err := c.paginate(ctx, host, "/v2/_catalog", catalogScope, func(resp *http.Response) error {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			return errors.NewValidationError("oci", "invalid catalog response", err)
+		}
+		repositories = append(repositories, page.Repositories...)
+		return nil
+	})
+	return repositories, err
+}
+
+// Tags lists the tags of a repository, following every page
+func (c *Client) Tags(ctx context.Context, ref Reference) ([]string, error) {
+	var tags []string
+	err := c.paginate(ctx, ref.APIHost(), fmt.Sprintf("/v2/%s/tags/list", ref.Repository), pullScope(ref.Repository), func(resp *http.Response) error {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			return errors.NewValidationError("oci", "invalid tag list response", err)
+		}
+		tags = append(tags, page.Tags...)
+		return nil
+	})
+	return tags, err
+}
+
+// paginate gets path and the pages linked from it with rel="next", passing
+// each response to read
+func (c *Client) paginate(ctx context.Context, host, path, scope string, read func(*http.Response) error) error {
+	next, err := url.Parse(c.url(host, path))
+	if err != nil {
+		return errors.NewValidationError("oci", "invalid registry URL", err)
+	}
+
+	for next != nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next.String(), nil)
+		if err != nil {
+			return errors.NewOperationError("oci", "failed to create list request", err)
+		}
+
+		resp, err := c.do(req, host, scope)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return errors.NewOperationError("oci", fmt.Sprintf("failed to list %s", path), responseError(resp))
+		}
+
+		err = read(resp)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		next, err = nextLink(next, resp.Header.Get("Link"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextLink returns the rel="next" target of a Link header, resolved against
+// the URL of the current page, or nil on the last page
+func nextLink(current *url.URL, header string) (*url.URL, error) {
+	for _, link := range strings.Split(header, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+		if !ok || !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		isNext := false
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "rel") && strings.Trim(value, `"`) == "next" {
+				isNext = true
+			}
+		}
+		if !isNext {
+			continue
+		}
+
+		next, err := current.Parse(strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">"))
+		if err != nil {
+			return nil, errors.NewValidationError("oci", "invalid next page link", err)
+		}
+		// A link to another host would receive the credentials of this one
+		if next.Host != current.Host {
+			return nil, errors.NewValidationError("oci", fmt.Sprintf("next page link points to another host: %s", next.Host), nil)
+		}
+		return next, nil
+	}
+	return nil, nil
+}
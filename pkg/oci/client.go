@@ -0,0 +1,475 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+)
+
+// manifestAccept is the Accept header sent with manifest requests
+var manifestAccept = strings.Join(ManifestMediaTypes, ", ")
+
+// ClientConfig holds configuration for a distribution API client
+type ClientConfig struct {
+	PlainHTTP   bool           // Use http instead of https for every registry
+	SkipVerify  bool           // Skip TLS certificate verification
+	Timeout     time.Duration  // Overall timeout per HTTP request, zero for none
+	Credentials CredentialFunc // Credentials lookup by registry host
+	Tokens      TokenFunc      // Bearer token lookup by host and scope, nil to use the challenge realm
+	UserAgent   string
+}
+
+// Client talks to registries through the OCI Distribution HTTP API
+type Client struct {
+	httpClient *http.Client
+	config     ClientConfig
+	auth       *authenticator
+}
+
+// ResponseError is returned when a registry answers with an unexpected status
+type ResponseError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+// Error implements the error interface
+func (e *ResponseError) Error() string {
+	msg := fmt.Sprintf("%s %s: unexpected status %d", e.Method, e.URL, e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// IsNotFound reports whether err is a registry 404 response
+func IsNotFound(err error) bool {
+	var respErr *ResponseError
+	return stderrors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// NewClient creates a new distribution API client
+func NewClient(cfg ClientConfig) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.SkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 -- explicitly requested by configuration
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "hubsync"
+	}
+
+	httpClient := &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+	}
+
+	return &Client{
+		httpClient: httpClient,
+		config:     cfg,
+		auth:       newAuthenticator(httpClient, cfg.Credentials, cfg.Tokens),
+	}
+}
+
+// pullScope returns the token scope for reading a repository
+func pullScope(repository string) string {
+	return "repository:" + repository + ":pull"
+}
+
+// pushScope returns the token scope for writing a repository
+func pushScope(repository string) string {
+	return "repository:" + repository + ":pull,push"
+}
+
+// url builds an API URL for a registry host
+func (c *Client) url(host, path string) string {
+	scheme := "https"
+	if c.config.PlainHTTP {
+		scheme = "http"
+	}
+	return scheme + "://" + host + path
+}
+
+// do sends a request, answering an authentication challenge once if needed
+func (c *Client) do(req *http.Request, host, scope string) (*http.Response, error) {
+	req.Header.Set("User-Agent", c.config.UserAgent)
+	c.auth.authorize(req, host, scope)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.NewOperationError("oci", fmt.Sprintf("%s %s failed", req.Method, req.URL.Redacted()), err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	// Only requests with a replayable body can be retried after a challenge
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	resp.Body.Close()
+	if err := c.auth.handleChallenge(req.Context(), resp, host, scope); err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, errors.NewIOError("oci", "failed to rewind request body", err)
+		}
+		retry.Body = body
+	}
+	retry.Header.Del("Authorization")
+	c.auth.authorize(retry, host, scope)
+
+	resp, err = c.httpClient.Do(retry)
+	if err != nil {
+		return nil, errors.NewOperationError("oci", fmt.Sprintf("%s %s failed", req.Method, req.URL.Redacted()), err)
+	}
+	return resp, nil
+}
+
+// responseError builds a ResponseError from a response and closes its body
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	respErr := &ResponseError{
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.Redacted(),
+		StatusCode: resp.StatusCode,
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8192))
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read error response body")
+		return respErr
+	}
+
+	var envelope struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && len(envelope.Errors) > 0 {
+		respErr.Code = envelope.Errors[0].Code
+		respErr.Message = envelope.Errors[0].Message
+	} else if len(body) > 0 {
+		respErr.Message = strings.TrimSpace(string(body))
+	}
+
+	return respErr
+}
+
+// GetManifest fetches a manifest and returns its raw bytes and descriptor
+func (c *Client) GetManifest(ctx context.Context, ref Reference) ([]byte, Descriptor, error) {
+	host := ref.APIHost()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.url(host, fmt.Sprintf("/v2/%s/manifests/%s", ref.Repository, ref.Reference())), nil)
+	if err != nil {
+		return nil, Descriptor{}, errors.NewOperationError("oci", "failed to create manifest request", err)
+	}
+	req.Header.Set("Accept", manifestAccept)
+
+	resp, err := c.do(req, host, pullScope(ref.Repository))
+	if err != nil {
+		return nil, Descriptor{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, Descriptor{}, errors.NewOperationError("oci",
+			fmt.Sprintf("failed to get manifest for %s", ref), responseError(resp))
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, Descriptor{}, errors.NewIOError("oci", "failed to read manifest", err)
+	}
+
+	desc := Descriptor{
+		MediaType: contentType(resp.Header.Get("Content-Type")),
+		Digest:    ComputeDigest(data),
+		Size:      int64(len(data)),
+	}
+	if !IsIndexMediaType(desc.MediaType) && !IsManifestMediaType(desc.MediaType) {
+		if detected := DetectMediaType(data); detected != "" {
+			desc.MediaType = detected
+		}
+	}
+
+	if ref.Digest != "" && ref.Digest != desc.Digest {
+		return nil, Descriptor{}, errors.NewValidationError("oci",
+			fmt.Sprintf("manifest digest mismatch for %s: got %s", ref, desc.Digest), nil)
+	}
+
+	return data, desc, nil
+}
+
+// HeadManifest resolves a manifest reference without downloading the body.
+// It returns false when the manifest does not exist.
+func (c *Client) HeadManifest(ctx context.Context, ref Reference) (Descriptor, bool, error) {
+	host := ref.APIHost()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead,
+		c.url(host, fmt.Sprintf("/v2/%s/manifests/%s", ref.Repository, ref.Reference())), nil)
+	if err != nil {
+		return Descriptor{}, false, errors.NewOperationError("oci", "failed to create manifest request", err)
+	}
+	req.Header.Set("Accept", manifestAccept)
+
+	resp, err := c.do(req, host, pullScope(ref.Repository))
+	if err != nil {
+		return Descriptor{}, false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return Descriptor{}, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Descriptor{}, false, errors.NewOperationError("oci",
+			fmt.Sprintf("failed to resolve manifest for %s", ref), responseError(resp))
+	}
+	resp.Body.Close()
+
+	return Descriptor{
+		MediaType: contentType(resp.Header.Get("Content-Type")),
+		Digest:    resp.Header.Get("Docker-Content-Digest"),
+		Size:      resp.ContentLength,
+	}, true, nil
+}
+
+// ResolveDigest returns the digest of a manifest reference. Registries that
+// omit the digest header on HEAD get the manifest hashed instead. It returns
+// false when the manifest does not exist.
+func (c *Client) ResolveDigest(ctx context.Context, ref Reference) (string, bool, error) {
+	desc, exists, err := c.HeadManifest(ctx, ref)
+	if err != nil || !exists {
+		return "", false, err
+	}
+	if desc.Digest == "" {
+		if _, desc, err = c.GetManifest(ctx, ref); err != nil {
+			return "", false, err
+		}
+	}
+	return desc.Digest, true, nil
+}
+
+// PutManifest uploads a manifest under the reference's tag or digest and
+// returns the digest reported by the registry
+func (c *Client) PutManifest(ctx context.Context, ref Reference, mediaType string, data []byte) (string, error) {
+	host := ref.APIHost()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
+		c.url(host, fmt.Sprintf("/v2/%s/manifests/%s", ref.Repository, ref.Reference())), bytes.NewReader(data))
+	if err != nil {
+		return "", errors.NewOperationError("oci", "failed to create manifest upload request", err)
+	}
+	req.Header.Set("Content-Type", mediaType)
+
+	resp, err := c.do(req, host, pushScope(ref.Repository))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", errors.NewOperationError("oci",
+			fmt.Sprintf("failed to put manifest for %s", ref), responseError(resp))
+	}
+	resp.Body.Close()
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = ComputeDigest(data)
+	}
+	return digest, nil
+}
+
+// HeadBlob reports whether a blob exists in the repository
+func (c *Client) HeadBlob(ctx context.Context, ref Reference, digest string) (bool, error) {
+	return c.headBlob(ctx, ref, digest, pullScope(ref.Repository))
+}
+
+// CheckBlobForPush reports whether a blob exists in a repository that is
+// about to be pushed to. It authenticates with the push scope so the same
+// token serves the upload that usually follows.
+func (c *Client) CheckBlobForPush(ctx context.Context, ref Reference, digest string) (bool, error) {
+	return c.headBlob(ctx, ref, digest, pushScope(ref.Repository))
+}
+
+// headBlob checks for a blob using the given token scope
+func (c *Client) headBlob(ctx context.Context, ref Reference, digest, scope string) (bool, error) {
+	host := ref.APIHost()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead,
+		c.url(host, fmt.Sprintf("/v2/%s/blobs/%s", ref.Repository, digest)), nil)
+	if err != nil {
+		return false, errors.NewOperationError("oci", "failed to create blob request", err)
+	}
+
+	resp, err := c.do(req, host, scope)
+	if err != nil {
+		return false, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		resp.Body.Close()
+		return true, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return false, nil
+	default:
+		return false, errors.NewOperationError("oci",
+			fmt.Sprintf("failed to check blob %s", digest), responseError(resp))
+	}
+}
+
+// GetBlob opens a blob for reading. The caller must close the returned reader.
+func (c *Client) GetBlob(ctx context.Context, ref Reference, digest string) (io.ReadCloser, int64, error) {
+	host := ref.APIHost()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.url(host, fmt.Sprintf("/v2/%s/blobs/%s", ref.Repository, digest)), nil)
+	if err != nil {
+		return nil, 0, errors.NewOperationError("oci", "failed to create blob request", err)
+	}
+
+	resp, err := c.do(req, host, pullScope(ref.Repository))
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, errors.NewOperationError("oci",
+			fmt.Sprintf("failed to get blob %s", digest), responseError(resp))
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// PushBlob uploads a blob to the repository with a monolithic upload
+func (c *Client) PushBlob(ctx context.Context, ref Reference, desc Descriptor, content io.Reader) error {
+	location, err := c.startUpload(ctx, ref, nil)
+	if err != nil {
+		return err
+	}
+	return c.completeUpload(ctx, ref, location, desc, content)
+}
+
+// MountBlob asks the registry to link a blob from another repository on the
+// same registry into the target repository. It returns false when the
+// registry declined the mount, in which case the blob must be uploaded.
+func (c *Client) MountBlob(ctx context.Context, ref Reference, fromRepository, digest string) (bool, error) {
+	host := ref.APIHost()
+	query := url.Values{}
+	query.Set("mount", digest)
+	query.Set("from", fromRepository)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.url(host, fmt.Sprintf("/v2/%s/blobs/uploads/?%s", ref.Repository, query.Encode())), nil)
+	if err != nil {
+		return false, errors.NewOperationError("oci", "failed to create mount request", err)
+	}
+
+	resp, err := c.do(req, host, pushScope(ref.Repository)+" "+pullScope(fromRepository))
+	if err != nil {
+		return false, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		resp.Body.Close()
+		return true, nil
+	case http.StatusAccepted:
+		// The registry opened a regular upload session instead, leave it to expire
+		resp.Body.Close()
+		return false, nil
+	default:
+		return false, errors.NewOperationError("oci",
+			fmt.Sprintf("failed to mount blob %s from %s", digest, fromRepository), responseError(resp))
+	}
+}
+
+// startUpload opens an upload session and returns its location. Extra query
+// parameters are added to the POST request.
+func (c *Client) startUpload(ctx context.Context, ref Reference, query url.Values) (*url.URL, error) {
+	host := ref.APIHost()
+	uploadURL := c.url(host, fmt.Sprintf("/v2/%s/blobs/uploads/", ref.Repository))
+	if len(query) > 0 {
+		uploadURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, nil)
+	if err != nil {
+		return nil, errors.NewOperationError("oci", "failed to create upload request", err)
+	}
+
+	resp, err := c.do(req, host, pushScope(ref.Repository))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, errors.NewOperationError("oci",
+			fmt.Sprintf("failed to start blob upload to %s", ref.Repository), responseError(resp))
+	}
+	resp.Body.Close()
+
+	location, err := resp.Location()
+	if err != nil {
+		return nil, errors.NewOperationError("oci", "registry returned no upload location", err)
+	}
+	return location, nil
+}
+
+// completeUpload sends the blob content to an upload session
+func (c *Client) completeUpload(ctx context.Context, ref Reference, location *url.URL, desc Descriptor, content io.Reader) error {
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location.String(), content)
+	if err != nil {
+		return errors.NewOperationError("oci", "failed to create upload request", err)
+	}
+	req.ContentLength = desc.Size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.do(req, ref.APIHost(), pushScope(ref.Repository))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return errors.NewOperationError("oci",
+			fmt.Sprintf("failed to upload blob %s", desc.Digest), responseError(resp))
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Close releases idle connections held by the client
+func (c *Client) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// contentType strips parameters from a Content-Type header value
+func contentType(header string) string {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return header
+	}
+	return mediaType
+}
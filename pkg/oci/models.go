@@ -0,0 +1,179 @@
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Media types understood by the distribution client
+const (
+	// MediaTypeDockerManifest is the Docker image manifest, schema 2
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// MediaTypeDockerManifestList is the Docker multi-platform manifest list
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// MediaTypeOCIManifest is the OCI image manifest
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+
+	// MediaTypeOCIIndex is the OCI image index
+	MediaTypeOCIIndex = "application/vnd.oci.image.index.v1+json"
+
+	// MediaTypeOCIArtifactManifest is the artifact manifest of the OCI 1.1
+	// release candidates, still served by some registries
+	MediaTypeOCIArtifactManifest = "application/vnd.oci.artifact.manifest.v1+json"
+)
+
+// Config media types of runnable container images
+const (
+	MediaTypeDockerConfig = "application/vnd.docker.container.image.v1+json"
+	MediaTypeOCIConfig    = "application/vnd.oci.image.config.v1+json"
+)
+
+// ManifestMediaTypes lists every manifest media type hubsync can copy,
+// indexes first so registries return the multi-platform form when available
+var ManifestMediaTypes = []string{
+	MediaTypeOCIIndex,
+	MediaTypeDockerManifestList,
+	MediaTypeOCIManifest,
+	MediaTypeDockerManifest,
+	MediaTypeOCIArtifactManifest,
+}
+
+// Descriptor describes a piece of content addressed by its digest
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	URLs         []string          `json:"urls,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+}
+
+// Platform describes the platform a manifest in an index targets
+type Platform struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+}
+
+// String returns the platform in os/arch[/variant] form
+func (p *Platform) String() string {
+	if p == nil {
+		return ""
+	}
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// Manifest is a single-platform image manifest (Docker schema 2 or OCI), or
+// an OCI artifact manifest
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Blobs         []Descriptor      `json:"blobs,omitempty"` // Content of artifact manifests
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Content returns every blob the manifest references: its config, if it
+// has one, and its layers or artifact blobs
+func (m *Manifest) Content() []Descriptor {
+	content := make([]Descriptor, 0, 1+len(m.Layers)+len(m.Blobs))
+	if m.Config.Digest != "" {
+		content = append(content, m.Config)
+	}
+	content = append(content, m.Layers...)
+	return append(content, m.Blobs...)
+}
+
+// Type returns the artifact type of a manifest that is not a container
+// image: its artifactType, or else its config media type. Images return "".
+func (m *Manifest) Type() string {
+	if m.ArtifactType != "" {
+		return m.ArtifactType
+	}
+	switch m.Config.MediaType {
+	case "", MediaTypeDockerConfig, MediaTypeOCIConfig:
+		return ""
+	}
+	return m.Config.MediaType
+}
+
+// Index is a multi-platform manifest list or OCI image index
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Manifests     []Descriptor      `json:"manifests"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// IsIndexMediaType reports whether the media type is a manifest list or image index
+func IsIndexMediaType(mediaType string) bool {
+	return mediaType == MediaTypeDockerManifestList || mediaType == MediaTypeOCIIndex
+}
+
+// IsManifestMediaType reports whether the media type is a single-platform manifest
+func IsManifestMediaType(mediaType string) bool {
+	return mediaType == MediaTypeDockerManifest || mediaType == MediaTypeOCIManifest ||
+		mediaType == MediaTypeOCIArtifactManifest
+}
+
+// ParseManifest decodes a single-platform image manifest
+func ParseManifest(data []byte) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// ParseIndex decodes a manifest list or image index
+func ParseIndex(data []byte) (*Index, error) {
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to decode index: %w", err)
+	}
+	return &index, nil
+}
+
+// DetectMediaType returns the media type declared inside a manifest body.
+// It is used when a registry answers with a generic Content-Type.
+func DetectMediaType(data []byte) string {
+	var probe struct {
+		MediaType string            `json:"mediaType"`
+		Manifests []json.RawMessage `json:"manifests"`
+		Config    json.RawMessage   `json:"config"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return ""
+	}
+	if probe.MediaType != "" {
+		return probe.MediaType
+	}
+	if probe.Manifests != nil {
+		return MediaTypeOCIIndex
+	}
+	if probe.Config != nil {
+		return MediaTypeOCIManifest
+	}
+	return ""
+}
+
+// ComputeDigest returns the sha256 digest of data in algorithm:hex form
+func ComputeDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,162 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Annotations buildx sets on attestation manifests inside an index
+const (
+	annotationReferenceType   = "vnd.docker.reference.type"
+	annotationReferenceDigest = "vnd.docker.reference.digest"
+)
+
+// ParsePlatform parses a platform in os/arch[/variant] form, e.g. linux/arm64/v8
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Platform{}, fmt.Errorf("invalid platform %q: expected os/arch[/variant]", s)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return Platform{}, fmt.Errorf("invalid platform %q: expected os/arch[/variant]", s)
+		}
+	}
+
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// ParsePlatforms parses a list of platforms, ignoring empty entries
+func ParsePlatforms(specs []string) ([]Platform, error) {
+	platforms := make([]Platform, 0, len(specs))
+	for _, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		p, err := ParsePlatform(spec)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, p)
+	}
+	return platforms, nil
+}
+
+// DaemonPlatform returns the image platform of a Docker daemon from the OS
+// type and the machine architecture its info reports, e.g. linux and x86_64
+// for linux/amd64 or armv7l for linux/arm/v7
+func DaemonPlatform(osType, machine string) Platform {
+	p := Platform{OS: osType, Architecture: machine}
+	switch machine {
+	case "x86_64", "x86-64":
+		p.Architecture = "amd64"
+	case "aarch64":
+		p.Architecture = "arm64"
+	case "i386", "i686":
+		p.Architecture = "386"
+	case "armv5l", "armv6l", "armv7l":
+		p.Architecture = "arm"
+		p.Variant = "v" + machine[4:5]
+	}
+	return p
+}
+
+// Matches reports whether p satisfies want. An empty variant in want matches
+// any variant, so linux/arm64 selects linux/arm64/v8 as well.
+func (p *Platform) Matches(want Platform) bool {
+	if p == nil {
+		return false
+	}
+	if p.OS != want.OS || p.Architecture != want.Architecture {
+		return false
+	}
+	return want.Variant == "" || p.Variant == want.Variant
+}
+
+// FilterIndex returns a copy of an index that only lists the manifests for the
+// wanted platforms, along with the platform manifests that were removed.
+// Entries without a platform are kept, attestation manifests follow the image
+// they describe. Fields other than manifests are preserved as-is.
+func FilterIndex(data []byte, platforms []Platform) ([]byte, []Descriptor, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode index: %w", err)
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw["manifests"], &entries); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode index manifests: %w", err)
+	}
+
+	descriptors := make([]Descriptor, len(entries))
+	for i, entry := range entries {
+		if err := json.Unmarshal(entry, &descriptors[i]); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode index manifest: %w", err)
+		}
+	}
+
+	// First pass decides which platform manifests stay
+	selected := make(map[string]bool)
+	for _, desc := range descriptors {
+		if isAttestation(desc) {
+			continue
+		}
+		if desc.Platform == nil || MatchesAny(desc.Platform, platforms) {
+			selected[desc.Digest] = true
+		}
+	}
+
+	kept := make([]json.RawMessage, 0, len(entries))
+	var removed []Descriptor
+	for i, desc := range descriptors {
+		keep := selected[desc.Digest]
+		if isAttestation(desc) {
+			keep = selected[desc.Annotations[annotationReferenceDigest]]
+		}
+		switch {
+		case keep:
+			kept = append(kept, entries[i])
+		case !isAttestation(desc):
+			removed = append(removed, desc)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, removed, fmt.Errorf("no manifest in the index matches the requested platforms")
+	}
+	if len(removed) == 0 {
+		return data, nil, nil
+	}
+
+	manifests, err := json.Marshal(kept)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode index manifests: %w", err)
+	}
+	raw["manifests"] = manifests
+
+	filtered, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode index: %w", err)
+	}
+	return filtered, removed, nil
+}
+
+// MatchesAny reports whether p satisfies one of the wanted platforms
+func MatchesAny(p *Platform, platforms []Platform) bool {
+	for _, want := range platforms {
+		if p.Matches(want) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAttestation reports whether a descriptor is a buildx attestation manifest
+func isAttestation(desc Descriptor) bool {
+	return desc.Annotations[annotationReferenceType] == "attestation-manifest"
+}
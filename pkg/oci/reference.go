@@ -0,0 +1,103 @@
+package oci
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DockerHubDomain is the canonical domain of Docker Hub image references
+	DockerHubDomain = "docker.io"
+
+	// dockerHubAPIHost is the host serving the Docker Hub distribution API
+	dockerHubAPIHost = "registry-1.docker.io"
+)
+
+// Reference is a fully qualified image reference
+type Reference struct {
+	Registry   string // Registry host, e.g. docker.io or ghcr.io
+	Repository string // Repository path inside the registry, e.g. library/nginx
+	Tag        string // Tag, may be empty when a digest is given
+	Digest     string // Digest, may be empty when a tag is given
+}
+
+// ParseReference parses an image name such as nginx, ghcr.io/org/app:v1 or
+// quay.io/org/app@sha256:... into a normalized Reference. Docker Hub short
+// names are expanded to docker.io/library/<name> and a missing tag defaults
+// to latest.
+func ParseReference(name string) (Reference, error) {
+	var ref Reference
+	if name == "" {
+		return ref, fmt.Errorf("empty image reference")
+	}
+
+	remainder := name
+	if idx := strings.Index(remainder, "@"); idx >= 0 {
+		ref.Digest = remainder[idx+1:]
+		remainder = remainder[:idx]
+		if !strings.Contains(ref.Digest, ":") {
+			return ref, fmt.Errorf("invalid digest in reference %q", name)
+		}
+	}
+
+	// A tag separator is a colon after the last slash
+	if idx := strings.LastIndex(remainder, ":"); idx > strings.LastIndex(remainder, "/") {
+		ref.Tag = remainder[idx+1:]
+		remainder = remainder[:idx]
+	}
+
+	// The first path component is a registry host if it looks like one
+	parts := strings.SplitN(remainder, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Registry = parts[0]
+		ref.Repository = parts[1]
+	} else {
+		ref.Registry = DockerHubDomain
+		ref.Repository = remainder
+	}
+
+	if ref.Registry == "index.docker.io" || ref.Registry == dockerHubAPIHost {
+		ref.Registry = DockerHubDomain
+	}
+	if ref.Registry == DockerHubDomain && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+
+	if ref.Repository == "" {
+		return ref, fmt.Errorf("missing repository in reference %q", name)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	return ref, nil
+}
+
+// Reference returns the digest if set, otherwise the tag. It is the value
+// used in /v2/<name>/manifests/<reference> requests.
+func (r Reference) Reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// APIHost returns the host that serves the distribution API for the registry
+func (r Reference) APIHost() string {
+	if r.Registry == DockerHubDomain {
+		return dockerHubAPIHost
+	}
+	return r.Registry
+}
+
+// String returns the reference in registry/repository[:tag][@digest] form
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+)
+
+// CosignTagSuffixes are the tag suffixes cosign stores signatures,
+// attestations and SBOMs under, next to the digest of the image they describe
+var CosignTagSuffixes = []string{"sig", "att", "sbom"}
+
+// CosignTag returns the cosign tag for an image digest, e.g. sha256-<hex>.sig
+func CosignTag(digest, suffix string) string {
+	return ReferrersTag(digest) + "." + suffix
+}
+
+// ReferrersTag returns the tag of the referrers tag schema fallback, which
+// holds an index of the referrers of a digest on registries without the
+// referrers API
+func ReferrersTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1)
+}
+
+// Referrers lists the manifests whose subject is digest through the OCI 1.1
+// referrers API. It returns false when the registry doesn't support the API.
+func (c *Client) Referrers(ctx context.Context, ref Reference, digest string) ([]Descriptor, bool, error) {
+	host := ref.APIHost()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.url(host, fmt.Sprintf("/v2/%s/referrers/%s", ref.Repository, digest)), nil)
+	if err != nil {
+		return nil, false, errors.NewOperationError("oci", "failed to create referrers request", err)
+	}
+	req.Header.Set("Accept", MediaTypeOCIIndex)
+
+	resp, err := c.do(req, host, pullScope(ref.Repository))
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, errors.NewOperationError("oci",
+			fmt.Sprintf("failed to list referrers of %s in %s", digest, ref.Repository), responseError(resp))
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, errors.NewIOError("oci", "failed to read referrers", err)
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, false, errors.NewValidationError("oci", "invalid referrers response", err)
+	}
+
+	return index.Manifests, true, nil
+}
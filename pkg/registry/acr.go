@@ -0,0 +1,276 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+const (
+	// acrRefreshUsername is the registry username that takes an ACR refresh token as password
+	acrRefreshUsername = "00000000-0000-0000-0000-000000000000"
+
+	// acrTokenRefresh is how long before expiry an ACR token is renewed
+	acrTokenRefresh = 5 * time.Minute
+
+	// acrTokenTTL is assumed for access tokens whose expiry can't be read
+	acrTokenTTL = 10 * time.Minute
+)
+
+// ACROptions holds the Azure settings of an ACR registry
+type ACROptions struct {
+	Tenant string // AAD tenant of the access token, optional
+}
+
+// acrToken is a cached ACR access token
+type acrToken struct {
+	token   string
+	expires time.Time
+}
+
+// ACRRegistry implements the RegistryInterface for Azure Container Registry.
+// An AAD access token is exchanged for an ACR refresh token, which in turn
+// is traded for access tokens per scope; admin credentials are sent as is.
+type ACRRegistry struct {
+	*GenericRegistry
+	options        ACROptions
+	client         *http.Client
+	mutex          sync.Mutex
+	refreshToken   string
+	refreshExpires time.Time
+	tokens         map[string]acrToken
+}
+
+// Ensure ACRRegistry implements RegistryInterface and LoginProvider
+var (
+	_ RegistryInterface = (*ACRRegistry)(nil)
+	_ LoginProvider     = (*ACRRegistry)(nil)
+)
+
+// NewACRRegistry creates a new client for the registry at config.URL, e.g.
+// myregistry.azurecr.io. It signs in with config.RefreshToken,
+// config.AccessToken (an AAD token) or the admin username and password.
+func NewACRRegistry(config RegistryConfig, options ACROptions) *ACRRegistry {
+	r := &ACRRegistry{
+		options:      options,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		refreshToken: config.RefreshToken,
+		tokens:       make(map[string]acrToken),
+	}
+	r.refreshExpires = jwtExpiry(config.RefreshToken)
+	r.GenericRegistry = newGenericRegistry(config, r.credentials, r.accessToken)
+	return r
+}
+
+// credentials returns the refresh token login, or the admin credentials
+func (r *ACRRegistry) credentials() oci.Credentials {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.refreshToken != "" {
+		return oci.Credentials{Username: acrRefreshUsername, Password: r.refreshToken}
+	}
+	return oci.Credentials{Username: r.config.Username, Password: r.config.Password}
+}
+
+// endpoint returns the URL of an authentication endpoint of the registry
+func (r *ACRRegistry) endpoint(path string) string {
+	scheme := "https"
+	if r.config.Insecure {
+		scheme = "http"
+	}
+	return scheme + "://" + oci.Reference{Registry: r.Host()}.APIHost() + path
+}
+
+// refresh exchanges the AAD access token for a refresh token when there is
+// none or it is about to expire. The caller must hold the mutex.
+func (r *ACRRegistry) refresh(ctx context.Context) error {
+	if r.config.AccessToken == "" {
+		if r.refreshToken == "" && r.config.Username == "" {
+			return errors.NewAuthError("registry", "no ACR credentials, set an AAD access token, a refresh token or the admin username and password", nil)
+		}
+		return nil
+	}
+	if r.refreshToken != "" && (r.refreshExpires.IsZero() || time.Until(r.refreshExpires) > acrTokenRefresh) {
+		return nil
+	}
+	if !r.config.TokenExpiration.IsZero() && time.Now().After(r.config.TokenExpiration) {
+		return errors.NewAuthError("registry",
+			fmt.Sprintf("the AAD access token expired at %s", r.config.TokenExpiration.Format(time.RFC3339)), nil)
+	}
+
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {r.Host()},
+		"access_token": {r.config.AccessToken},
+	}
+	if r.options.Tenant != "" {
+		form.Set("tenant", r.options.Tenant)
+	}
+
+	var exchangeResp struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := r.post(ctx, "/oauth2/exchange", form, &exchangeResp); err != nil {
+		return err
+	}
+	if exchangeResp.RefreshToken == "" {
+		return errors.NewAuthError("registry", "exchange response contained no refresh token", nil)
+	}
+
+	r.refreshToken = exchangeResp.RefreshToken
+	r.refreshExpires = jwtExpiry(r.refreshToken)
+
+	log.Debug().
+		Str("registry", r.Host()).
+		Time("expires", r.refreshExpires).
+		Msg("Exchanged AAD token for an ACR refresh token")
+	return nil
+}
+
+// accessToken returns a cached or new access token for a scope of the
+// registry. It is the token function of the distribution client.
+func (r *ACRRegistry) accessToken(ctx context.Context, host, scope string) (string, time.Time, error) {
+	if host != (oci.Reference{Registry: r.Host()}).APIHost() {
+		return "", time.Time{}, nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if entry, ok := r.tokens[scope]; ok && time.Until(entry.expires) > acrTokenRefresh {
+		return entry.token, renewAt(entry.expires), nil
+	}
+	if err := r.refresh(ctx); err != nil {
+		return "", time.Time{}, err
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if r.refreshToken != "" {
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"service":       {r.Host()},
+			"refresh_token": {r.refreshToken},
+		}
+		for _, s := range strings.Fields(scope) {
+			form.Add("scope", s)
+		}
+		if err := r.post(ctx, "/oauth2/token", form, &tokenResp); err != nil {
+			return "", time.Time{}, err
+		}
+	} else if err := r.adminToken(ctx, scope, &tokenResp); err != nil {
+		return "", time.Time{}, err
+	}
+	if tokenResp.AccessToken == "" {
+		return "", time.Time{}, errors.NewAuthError("registry", "token response contained no access token", nil)
+	}
+
+	expires := jwtExpiry(tokenResp.AccessToken)
+	if expires.IsZero() {
+		expires = time.Now().Add(acrTokenTTL)
+	}
+	r.tokens[scope] = acrToken{token: tokenResp.AccessToken, expires: expires}
+
+	log.Debug().
+		Str("registry", r.Host()).
+		Str("scope", scope).
+		Time("expires", expires).
+		Msg("Obtained ACR access token")
+	return tokenResp.AccessToken, renewAt(expires), nil
+}
+
+// renewAt returns when a token expiring at expires is renewed, early unless
+// it is too short-lived for that
+func renewAt(expires time.Time) time.Time {
+	if early := expires.Add(-acrTokenRefresh); early.After(time.Now()) {
+		return early
+	}
+	return expires
+}
+
+// adminToken gets an access token for a scope with the admin credentials
+func (r *ACRRegistry) adminToken(ctx context.Context, scope string, out interface{}) error {
+	query := url.Values{"service": {r.Host()}}
+	for _, s := range strings.Fields(scope) {
+		query.Add("scope", s)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.endpoint("/oauth2/token")+"?"+query.Encode(), nil)
+	if err != nil {
+		return errors.NewOperationError("registry", "failed to create token request", err)
+	}
+	req.SetBasicAuth(r.config.Username, r.config.Password)
+	return r.do(req, out)
+}
+
+// post sends a form to an authentication endpoint and decodes the response
+func (r *ACRRegistry) post(ctx context.Context, path string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint(path), strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.NewOperationError("registry", "failed to create token request", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r.do(req, out)
+}
+
+// do executes a token request and decodes the response
+func (r *ACRRegistry) do(req *http.Request, out interface{}) error {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return errors.NewOperationError("registry", "failed to execute token request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return errors.NewAuthError("registry",
+			fmt.Sprintf("%s on %s failed with status %d: %s", req.URL.Path, r.Host(), resp.StatusCode, strings.TrimSpace(string(body))), nil)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.NewOperationError("registry", "failed to decode token response", err)
+	}
+	return nil
+}
+
+// jwtExpiry reads the exp claim of a JWT, zero when there is none
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// Login returns the refresh token login, or the admin credentials
+func (r *ACRRegistry) Login(ctx context.Context) (string, string, error) {
+	r.mutex.Lock()
+	err := r.refresh(ctx)
+	r.mutex.Unlock()
+	if err != nil {
+		return "", "", err
+	}
+	creds := r.credentials()
+	return creds.Username, creds.Password, nil
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/yugasun/hubsync/pkg/docker"
 	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
 )
 
 const (
@@ -26,6 +27,7 @@ const (
 type DockerHubRegistry struct {
 	config       RegistryConfig
 	client       *http.Client
+	distribution *oci.Client
 	authToken    string
 	tokenExpires time.Time
 }
@@ -35,14 +37,34 @@ var _ RegistryInterface = (*DockerHubRegistry)(nil)
 
 // NewDockerHubRegistry creates a new Docker Hub registry client
 func NewDockerHubRegistry(config RegistryConfig) *DockerHubRegistry {
+	// Credentials only apply to the configured registry, others are read anonymously
+	host := oci.Reference{Registry: oci.DockerHubDomain}.APIHost()
+	if config.URL != "" {
+		host = config.URL
+	}
+
 	return &DockerHubRegistry{
 		config: config,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		distribution: oci.NewClient(oci.ClientConfig{
+			PlainHTTP:  config.Insecure,
+			SkipVerify: config.SkipVerify,
+			Timeout:    30 * time.Second,
+			Credentials: oci.StaticCredentials(
+				oci.Credentials{Username: config.Username, Password: config.Password},
+				host,
+			),
+		}),
 	}
 }
 
+// Host returns docker.io, the registry whose manifests the client reads
+func (r *DockerHubRegistry) Host() string {
+	return oci.DockerHubDomain
+}
+
 // Auth authenticates with Docker Hub
 func (r *DockerHubRegistry) Auth(ctx context.Context) error {
 	// Return if we have a valid token
@@ -297,7 +319,8 @@ func (r *DockerHubRegistry) GetImageManifest(ctx context.Context, repository str
 	}
 
 	req.Header.Set("Authorization", "Bearer "+r.authToken)
-	req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	// Accept manifest lists and OCI indexes so multi-platform images resolve
+	req.Header.Set("Accept", strings.Join(oci.ManifestMediaTypes, ", "))
 
 	resp, err := r.client.Do(req)
 	if err != nil {
@@ -325,6 +348,17 @@ func (r *DockerHubRegistry) GetImageManifest(ctx context.Context, repository str
 	return manifest, nil
 }
 
+// GetImageDigest resolves the manifest digest of an image on any registry
+// through the distribution API
+func (r *DockerHubRegistry) GetImageDigest(ctx context.Context, imageRef *docker.ImageReference) (string, bool, error) {
+	ref, err := oci.ParseReference(imageRef.FullName)
+	if err != nil {
+		return "", false, errors.NewValidationError("registry", "invalid image reference", err)
+	}
+
+	return r.distribution.ResolveDigest(ctx, ref)
+}
+
 // ValidateImage checks if an image exists in the registry
 func (r *DockerHubRegistry) ValidateImage(ctx context.Context, imageRef *docker.ImageReference) (bool, error) {
 	repository := imageRef.Repository
@@ -359,5 +393,5 @@ func (r *DockerHubRegistry) ValidateImage(ctx context.Context, imageRef *docker.
 // Close releases resources associated with the registry client
 func (r *DockerHubRegistry) Close() error {
 	r.client.CloseIdleConnections()
-	return nil
+	return r.distribution.Close()
 }
@@ -0,0 +1,255 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+const (
+	// ecrTargetPrefix prefixes the X-Amz-Target of every ECR API action
+	ecrTargetPrefix = "AmazonEC2ContainerRegistry_V20150921."
+
+	// ecrTokenRefresh is how long before expiry an ECR token is renewed.
+	// Tokens last 12 hours, so a long batch still gets a fresh one.
+	ecrTokenRefresh = 30 * time.Minute
+)
+
+// ECROptions holds the AWS settings of an ECR registry
+type ECROptions struct {
+	Region          string         // AWS region, taken from the registry host when empty
+	Endpoint        string         // ECR API endpoint, derived from the region when empty
+	Credentials     AWSCredentials // Static keys, the environment and shared file are used when empty
+	Profile         string         // Shared credentials file profile, AWS_PROFILE or default when empty
+	CredentialsFile string         // Shared credentials file, ~/.aws/credentials when empty
+}
+
+// ECRRegistry implements the RegistryInterface for Amazon Elastic Container
+// Registry, logging in with tokens from the ECR API
+type ECRRegistry struct {
+	*GenericRegistry
+	options  ECROptions
+	client   *http.Client
+	mutex    sync.Mutex
+	password string
+	expires  time.Time
+}
+
+// Ensure ECRRegistry implements RegistryInterface, RepositoryCreator and LoginProvider
+var (
+	_ RegistryInterface = (*ECRRegistry)(nil)
+	_ RepositoryCreator = (*ECRRegistry)(nil)
+	_ LoginProvider     = (*ECRRegistry)(nil)
+)
+
+// NewECRRegistry creates a new ECR registry client for the registry at
+// config.URL, e.g. 123456789012.dkr.ecr.us-east-1.amazonaws.com
+func NewECRRegistry(config RegistryConfig, options ECROptions) *ECRRegistry {
+	r := &ECRRegistry{
+		options: options,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+	r.GenericRegistry = newGenericRegistry(config, r.credentials, nil)
+
+	if r.options.Region == "" {
+		r.options.Region = ecrRegion(r.Host())
+	}
+	if r.options.Endpoint == "" {
+		suffix := "amazonaws.com"
+		if strings.HasSuffix(r.Host(), ".amazonaws.com.cn") {
+			suffix = "amazonaws.com.cn"
+		}
+		r.options.Endpoint = fmt.Sprintf("https://api.ecr.%s.%s", r.options.Region, suffix)
+	}
+	return r
+}
+
+// ecrRegion returns the region of an ECR registry host such as
+// <account>.dkr.ecr.<region>.amazonaws.com, falling back to the environment
+func ecrRegion(host string) string {
+	parts := strings.Split(host, ".")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "ecr" && i > 0 && parts[i-1] == "dkr" {
+			return parts[i+1]
+		}
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// credentials returns the registry login, getting a new token first when
+// there is none or it is about to expire. Requests carry no credentials when
+// that fails, Login reports why.
+func (r *ECRRegistry) credentials() oci.Credentials {
+	// Tokens are cached, this only waits on a refresh
+	username, password, err := r.Login(context.Background())
+	if err != nil {
+		log.Warn().Err(err).Str("registry", r.Host()).Msg("Failed to get an ECR authorization token")
+		return oci.Credentials{}
+	}
+	return oci.Credentials{Username: username, Password: password}
+}
+
+// refresh gets a new registry token when there is none or it is about to expire
+func (r *ECRRegistry) refresh(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.password != "" && time.Until(r.expires) > ecrTokenRefresh {
+		return nil
+	}
+
+	var resp struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+	if err := r.call(ctx, "GetAuthorizationToken", struct{}{}, &resp); err != nil {
+		return err
+	}
+	if len(resp.AuthorizationData) == 0 {
+		return errors.NewAuthError("registry", "ECR returned no authorization data", nil)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(resp.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return errors.NewAuthError("registry", "invalid ECR authorization token", err)
+	}
+	_, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return errors.NewAuthError("registry", "invalid ECR authorization token", nil)
+	}
+
+	r.password = password
+	r.expires = time.Unix(int64(resp.AuthorizationData[0].ExpiresAt), 0)
+
+	log.Debug().
+		Str("registry", r.Host()).
+		Time("expires", r.expires).
+		Msg("Obtained ECR authorization token")
+	return nil
+}
+
+// call sends a signed ECR API action and decodes its response into out
+func (r *ECRRegistry) call(ctx context.Context, action string, in, out interface{}) error {
+	if r.options.Region == "" {
+		return errors.NewConfigError("registry", "no AWS region for "+r.Host()+", set AWS_REGION", nil)
+	}
+	creds, err := loadAWSCredentials(r.options.Credentials, r.options.Profile, r.options.CredentialsFile)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return errors.NewOperationError("registry", "failed to marshal ECR request", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.options.Endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return errors.NewOperationError("registry", "failed to create ECR request", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", ecrTargetPrefix+action)
+	signV4(req, body, creds, r.options.Region, "ecr", time.Now())
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return errors.NewOperationError("registry", "failed to execute ECR "+action+" request", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.NewIOError("registry", "failed to read ECR response", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ecrError(action, resp.StatusCode, data)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return errors.NewOperationError("registry", "failed to decode ECR "+action+" response", err)
+	}
+	return nil
+}
+
+// ecrError builds the error of a failed ECR API action. The exception type
+// is kept as the "type" detail.
+func ecrError(action string, status int, body []byte) error {
+	var apiErr struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &apiErr)
+	// The type may be qualified, e.g. com.amazonaws.ecr#RepositoryNotFoundException
+	if idx := strings.LastIndex(apiErr.Type, "#"); idx >= 0 {
+		apiErr.Type = apiErr.Type[idx+1:]
+	}
+
+	msg := fmt.Sprintf("ECR %s failed with status %d", action, status)
+	if apiErr.Type != "" {
+		msg += ": " + apiErr.Type
+	}
+	if apiErr.Message != "" {
+		msg += ": " + apiErr.Message
+	}
+
+	var err *errors.DomainError
+	if status == http.StatusUnauthorized || status == http.StatusForbidden || strings.Contains(apiErr.Type, "Signature") ||
+		apiErr.Type == "UnrecognizedClientException" || apiErr.Type == "AccessDeniedException" {
+		err = errors.NewAuthError("registry", msg, nil)
+	} else {
+		err = errors.NewOperationError("registry", msg, nil)
+	}
+	return err.WithDetail("type", apiErr.Type)
+}
+
+// Login returns the AWS user and the password of the current token
+func (r *ECRRegistry) Login(ctx context.Context) (string, string, error) {
+	if err := r.refresh(ctx); err != nil {
+		return "", "", err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return "AWS", r.password, nil
+}
+
+// EnsureRepository creates the repository of an image in the registry if it
+// doesn't exist yet, ECR doesn't create repositories on push. Images of
+// other registries are ignored.
+func (r *ECRRegistry) EnsureRepository(ctx context.Context, imageRef *docker.ImageReference) error {
+	ref, err := oci.ParseReference(imageRef.FullName)
+	if err != nil {
+		return errors.NewValidationError("registry", "invalid image reference", err)
+	}
+	if ref.Registry != r.Host() {
+		return nil
+	}
+
+	var out json.RawMessage
+	err = r.call(ctx, "CreateRepository", map[string]string{"repositoryName": ref.Repository}, &out)
+	if err == nil {
+		log.Info().Str("repository", ref.Repository).Str("registry", r.Host()).Msg("Created ECR repository")
+		return nil
+	}
+	if domainErr, ok := err.(*errors.DomainError); ok && domainErr.Details["type"] == "RepositoryAlreadyExistsException" {
+		return nil
+	}
+	return err
+}
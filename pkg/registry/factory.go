@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// ProviderOptions holds the provider-specific settings of a registry
+type ProviderOptions struct {
+	ECR    ECROptions
+	GCR    GCROptions
+	ACR    ACROptions
+	Harbor HarborOptions
+
+	// Extra holds the settings of providers added with Register, by key
+	Extra map[string]string
+}
+
+// Factory creates the client of a registry provider
+type Factory func(config RegistryConfig, options ProviderOptions) (RegistryInterface, error)
+
+// Matcher reports whether a registry host belongs to a provider
+type Matcher func(host string) bool
+
+// matcher pairs a provider with the hosts it is inferred for
+type matcher struct {
+	provider Provider
+	match    Matcher
+}
+
+var (
+	factoriesMutex sync.RWMutex
+	factories      = map[Provider]Factory{}
+	matchers       []matcher
+)
+
+func init() {
+	dockerHub := func(config RegistryConfig, _ ProviderOptions) (RegistryInterface, error) {
+		return NewDockerHubRegistry(config), nil
+	}
+	generic := func(config RegistryConfig, _ ProviderOptions) (RegistryInterface, error) {
+		return NewGenericRegistry(config), nil
+	}
+
+	Register(DockerHub, dockerHub, func(host string) bool { return host == oci.DockerHubDomain })
+	Register(DockerIO, dockerHub, nil)
+	Register(ECR, func(config RegistryConfig, options ProviderOptions) (RegistryInterface, error) {
+		return NewECRRegistry(config, options.ECR), nil
+	}, isECRHost)
+	Register(GCR, func(config RegistryConfig, options ProviderOptions) (RegistryInterface, error) {
+		return NewGCRRegistry(config, options.GCR), nil
+	}, func(host string) bool {
+		return host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || IsArtifactRegistryHost(host)
+	})
+	Register(ACR, func(config RegistryConfig, options ProviderOptions) (RegistryInterface, error) {
+		return NewACRRegistry(config, options.ACR), nil
+	}, func(host string) bool {
+		return strings.HasSuffix(host, ".azurecr.io") || strings.HasSuffix(host, ".azurecr.cn") || strings.HasSuffix(host, ".azurecr.us")
+	})
+	Register(GHCR, generic, func(host string) bool { return host == "ghcr.io" })
+	// Harbor can't be told apart by its host, and creates projects, so it is
+	// only used when configured or picked for the Harbor settings
+	Register(Harbor, func(config RegistryConfig, options ProviderOptions) (RegistryInterface, error) {
+		return NewHarborRegistry(config, options.Harbor)
+	}, nil)
+	Register(Custom, generic, nil)
+}
+
+// Register adds a registry provider, or replaces the factory of an existing
+// one. When match is not nil, registries whose host it matches use the
+// provider unless another one is configured; the latest registration wins.
+func Register(provider Provider, factory Factory, match Matcher) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	factories[provider] = factory
+	if match != nil {
+		matchers = append([]matcher{{provider: provider, match: match}}, matchers...)
+	}
+}
+
+// IsRegistered reports whether a provider has a factory
+func IsRegistered(provider Provider) bool {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	_, ok := factories[provider]
+	return ok
+}
+
+// Providers returns the names of the registered providers, sorted
+func Providers() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for provider := range factories {
+		names = append(names, string(provider))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Detect infers the provider of a registry from its URL, e.g.
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com or ghcr.io/org. An empty URL
+// is Docker Hub, and unknown hosts are custom registries.
+func Detect(registryURL string) Provider {
+	host, _ := parseRegistryURL(registryURL)
+
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	for _, m := range matchers {
+		if m.match(host) {
+			return m.provider
+		}
+	}
+	return Custom
+}
+
+// NewRegistry creates the client of config.Provider, or of the provider
+// detected from config.URL when none is set
+func NewRegistry(config RegistryConfig, options ProviderOptions) (RegistryInterface, error) {
+	if config.Provider == "" {
+		config.Provider = Detect(config.URL)
+	}
+
+	factoriesMutex.RLock()
+	factory, ok := factories[config.Provider]
+	factoriesMutex.RUnlock()
+	if !ok {
+		return nil, errors.NewConfigError("registry", fmt.Sprintf(
+			"unknown registry provider: %s (must be one of: %s)", config.Provider, strings.Join(Providers(), ", ")), nil)
+	}
+	return factory(config, options)
+}
+
+// parseRegistryURL returns the host of a registry URL, which may carry an
+// http:// or https:// scheme and a path, and whether it asks for plain HTTP
+func parseRegistryURL(registryURL string) (string, bool) {
+	host, plainHTTP := strings.CutPrefix(registryURL, "http://")
+	host, _, _ = strings.Cut(strings.TrimPrefix(host, "https://"), "/")
+	host = strings.ToLower(host)
+	if host == "" || host == "index.docker.io" || host == "registry-1.docker.io" {
+		host = oci.DockerHubDomain
+	}
+	return host, plainHTTP
+}
+
+// isECRHost reports whether host is an ECR registry, e.g.
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com
+func isECRHost(host string) bool {
+	return strings.Contains(host, ".dkr.ecr.") &&
+		(strings.HasSuffix(host, ".amazonaws.com") || strings.HasSuffix(host, ".amazonaws.com.cn"))
+}
@@ -0,0 +1,278 @@
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+const (
+	// gcrUsername is the registry username that takes an OAuth2 access token as password
+	gcrUsername = "oauth2accesstoken"
+
+	// gcrTokenURL is the default Google OAuth2 token endpoint
+	gcrTokenURL = "https://oauth2.googleapis.com/token"
+
+	// gcrScope grants access to Container Registry and Artifact Registry
+	gcrScope = "https://www.googleapis.com/auth/cloud-platform"
+
+	// gcrTokenRefresh is how long before expiry an access token is renewed
+	gcrTokenRefresh = 5 * time.Minute
+
+	// artifactRegistrySuffix ends the hosts of Artifact Registry, e.g. us-docker.pkg.dev
+	artifactRegistrySuffix = "-docker.pkg.dev"
+)
+
+// GCROptions holds the Google Cloud settings of a GCR or Artifact Registry
+type GCROptions struct {
+	Key      []byte // Service account JSON key, read from KeyFile when empty
+	KeyFile  string // Service account key file, GOOGLE_APPLICATION_CREDENTIALS when empty
+	TokenURL string // OAuth2 token endpoint, the one in the key when empty
+}
+
+// serviceAccountKey is the part of a service account JSON key used to sign in
+type serviceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// GCRRegistry implements the RegistryInterface for Google Container Registry
+// and Artifact Registry, signing in with a service account key
+type GCRRegistry struct {
+	*GenericRegistry
+	options GCROptions
+	client  *http.Client
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Ensure GCRRegistry implements RegistryInterface, RepositoryCreator and LoginProvider
+var (
+	_ RegistryInterface = (*GCRRegistry)(nil)
+	_ RepositoryCreator = (*GCRRegistry)(nil)
+	_ LoginProvider     = (*GCRRegistry)(nil)
+)
+
+// NewGCRRegistry creates a new client for the registry at config.URL, e.g.
+// gcr.io or us-docker.pkg.dev/project/repository
+func NewGCRRegistry(config RegistryConfig, options GCROptions) *GCRRegistry {
+	r := &GCRRegistry{
+		options: options,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+	r.GenericRegistry = newGenericRegistry(config, r.credentials, nil)
+	return r
+}
+
+// IsArtifactRegistryHost reports whether host is an Artifact Registry host
+func IsArtifactRegistryHost(host string) bool {
+	return strings.HasSuffix(host, artifactRegistrySuffix)
+}
+
+// credentials returns the registry login, getting a new access token first
+// when there is none or it is about to expire. Requests carry no credentials
+// when that fails, Login reports why.
+func (r *GCRRegistry) credentials() oci.Credentials {
+	// Tokens are cached, this only waits on a refresh
+	username, password, err := r.Login(context.Background())
+	if err != nil {
+		log.Warn().Err(err).Str("registry", r.Host()).Msg("Failed to get a Google access token")
+		return oci.Credentials{}
+	}
+	return oci.Credentials{Username: username, Password: password}
+}
+
+// loadKey returns the configured service account key
+func (r *GCRRegistry) loadKey() (*serviceAccountKey, error) {
+	data := r.options.Key
+	if len(data) == 0 {
+		path := r.options.KeyFile
+		if path == "" {
+			path = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		}
+		if path == "" {
+			return nil, errors.NewConfigError("registry", "no service account key, set a key file or GOOGLE_APPLICATION_CREDENTIALS", nil)
+		}
+
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, errors.NewConfigError("registry", "failed to read service account key", err)
+		}
+	}
+
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, errors.NewConfigError("registry", "invalid service account key", err)
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, errors.NewConfigError("registry", "the key is not a service account key", nil)
+	}
+	return &key, nil
+}
+
+// refresh gets a new access token when there is none or it is about to expire
+func (r *GCRRegistry) refresh(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.token != "" && time.Until(r.expires) > gcrTokenRefresh {
+		return nil
+	}
+
+	key, err := r.loadKey()
+	if err != nil {
+		return err
+	}
+	tokenURL := r.options.TokenURL
+	if tokenURL == "" {
+		tokenURL = key.TokenURI
+	}
+	if tokenURL == "" {
+		tokenURL = gcrTokenURL
+	}
+
+	assertion, err := signAssertion(key, tokenURL, time.Now())
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.NewOperationError("registry", "failed to create token request", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return errors.NewOperationError("registry", "failed to execute token request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return errors.NewAuthError("registry",
+			fmt.Sprintf("token request for %s failed with status %d: %s", key.ClientEmail, resp.StatusCode, strings.TrimSpace(string(body))), nil)
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return errors.NewOperationError("registry", "failed to decode token response", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return errors.NewAuthError("registry", "token response contained no access token", nil)
+	}
+
+	r.token = tokenResp.AccessToken
+	r.expires = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+
+	log.Debug().
+		Str("registry", r.Host()).
+		Str("account", key.ClientEmail).
+		Time("expires", r.expires).
+		Msg("Obtained Google access token")
+	return nil
+}
+
+// signAssertion builds the RS256 JWT a service account trades for an access token
+func signAssertion(key *serviceAccountKey, audience string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", errors.NewConfigError("registry", "service account private key is not PEM encoded", nil)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", errors.NewConfigError("registry", "invalid service account private key", err)
+		}
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.NewConfigError("registry", "service account private key is not an RSA key", nil)
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": key.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": gcrScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", errors.NewOperationError("registry", "failed to sign token request", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Login returns oauth2accesstoken and the current access token
+func (r *GCRRegistry) Login(ctx context.Context) (string, string, error) {
+	if err := r.refresh(ctx); err != nil {
+		return "", "", err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return gcrUsername, r.token, nil
+}
+
+// EnsureRepository checks that an image of the registry follows its layout:
+// gcr.io/PROJECT/IMAGE, or LOCATION-docker.pkg.dev/PROJECT/REPOSITORY/IMAGE
+// for Artifact Registry, whose repositories must be created beforehand.
+// Images of other registries are ignored.
+func (r *GCRRegistry) EnsureRepository(ctx context.Context, imageRef *docker.ImageReference) error {
+	ref, err := oci.ParseReference(imageRef.FullName)
+	if err != nil {
+		return errors.NewValidationError("registry", "invalid image reference", err)
+	}
+	if ref.Registry != r.Host() {
+		return nil
+	}
+
+	parts := strings.Count(ref.Repository, "/") + 1
+	if IsArtifactRegistryHost(ref.Registry) && parts < 3 {
+		return errors.NewValidationError("registry", fmt.Sprintf(
+			"%s is not an Artifact Registry image, use %s/PROJECT/REPOSITORY as the target repository or PROJECT/REPOSITORY as the namespace",
+			imageRef.FullName, ref.Registry), nil)
+	}
+	if parts < 2 {
+		return errors.NewValidationError("registry", fmt.Sprintf(
+			"%s names no project, use %s/PROJECT as the target repository or PROJECT as the namespace",
+			imageRef.FullName, ref.Registry), nil)
+	}
+	return nil
+}
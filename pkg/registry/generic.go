@@ -0,0 +1,165 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// GenericRegistry implements the RegistryInterface for any registry that
+// serves the OCI Distribution API
+type GenericRegistry struct {
+	config       RegistryConfig
+	host         string
+	distribution *oci.Client
+}
+
+// Ensure GenericRegistry implements RegistryInterface and ManifestFetcher
+var (
+	_ RegistryInterface = (*GenericRegistry)(nil)
+	_ ManifestFetcher   = (*GenericRegistry)(nil)
+)
+
+// NewGenericRegistry creates a new client for the registry at config.URL,
+// which may carry an http:// or https:// scheme
+func NewGenericRegistry(config RegistryConfig) *GenericRegistry {
+	creds := oci.Credentials{Username: config.Username, Password: config.Password}
+	return newGenericRegistry(config, func() oci.Credentials { return creds }, nil)
+}
+
+// newGenericRegistry creates a client that looks up the credentials of the
+// registry on every request, so providers can hand out short-lived tokens.
+// Providers with their own token exchange also pass a token function.
+func newGenericRegistry(config RegistryConfig, credentials func() oci.Credentials, tokens oci.TokenFunc) *GenericRegistry {
+	// The URL may carry a path, e.g. us-docker.pkg.dev/project/repository
+	host, plainHTTP := parseRegistryURL(config.URL)
+	if plainHTTP {
+		config.Insecure = true
+	}
+
+	// Credentials only apply to the configured registry, others are read anonymously
+	apiHost := oci.Reference{Registry: host}.APIHost()
+	return &GenericRegistry{
+		config: config,
+		host:   host,
+		distribution: oci.NewClient(oci.ClientConfig{
+			PlainHTTP:  config.Insecure,
+			SkipVerify: config.SkipVerify,
+			Timeout:    30 * time.Second,
+			Credentials: func(h string) oci.Credentials {
+				if h != apiHost {
+					return oci.Credentials{}
+				}
+				return credentials()
+			},
+			Tokens: tokens,
+		}),
+	}
+}
+
+// Host returns the registry host the client talks to
+func (r *GenericRegistry) Host() string {
+	return r.host
+}
+
+// reference builds a reference to repository in the registry, where
+// reference is a tag or a digest
+func (r *GenericRegistry) reference(repository, reference string) oci.Reference {
+	ref := oci.Reference{Registry: r.host, Repository: repository}
+	if strings.Contains(reference, ":") {
+		ref.Digest = reference
+	} else {
+		ref.Tag = reference
+	}
+	if ref.Registry == oci.DockerHubDomain && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	return ref
+}
+
+// Auth checks the registry is reachable and accepts the credentials
+func (r *GenericRegistry) Auth(ctx context.Context) error {
+	return r.distribution.Ping(ctx, oci.Reference{Registry: r.host}.APIHost())
+}
+
+// ListImages lists the repositories of the registry in the given namespace,
+// or every repository when namespace is empty
+func (r *GenericRegistry) ListImages(ctx context.Context, namespace string) ([]string, error) {
+	repositories, err := r.distribution.Catalog(ctx, oci.Reference{Registry: r.host}.APIHost())
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		return repositories, nil
+	}
+
+	images := make([]string, 0, len(repositories))
+	for _, repository := range repositories {
+		if strings.HasPrefix(repository, namespace+"/") {
+			images = append(images, repository)
+		}
+	}
+	return images, nil
+}
+
+// GetImageTags gets all tags of a repository in the registry
+func (r *GenericRegistry) GetImageTags(ctx context.Context, repository string) ([]string, error) {
+	return r.distribution.Tags(ctx, r.reference(repository, "latest"))
+}
+
+// GetImageManifest gets the manifest of a repository by tag or digest
+func (r *GenericRegistry) GetImageManifest(ctx context.Context, repository string, reference string) ([]byte, error) {
+	data, _, err := r.distribution.GetManifest(ctx, r.reference(repository, reference))
+	return data, err
+}
+
+// GetImageDigest resolves the manifest digest of an image on any registry
+// through the distribution API
+func (r *GenericRegistry) GetImageDigest(ctx context.Context, imageRef *docker.ImageReference) (string, bool, error) {
+	ref, err := oci.ParseReference(imageRef.FullName)
+	if err != nil {
+		return "", false, errors.NewValidationError("registry", "invalid image reference", err)
+	}
+
+	return r.distribution.ResolveDigest(ctx, ref)
+}
+
+// FetchManifest reads the manifest of an image on any registry through the
+// distribution API
+func (r *GenericRegistry) FetchManifest(ctx context.Context, imageRef *docker.ImageReference) ([]byte, error) {
+	ref, err := oci.ParseReference(imageRef.FullName)
+	if err != nil {
+		return nil, errors.NewValidationError("registry", "invalid image reference", err)
+	}
+
+	data, _, err := r.distribution.GetManifest(ctx, ref)
+	return data, err
+}
+
+// ValidateImage checks if an image exists in the registry it names
+func (r *GenericRegistry) ValidateImage(ctx context.Context, imageRef *docker.ImageReference) (bool, error) {
+	ref, err := oci.ParseReference(imageRef.FullName)
+	if err != nil {
+		return false, errors.NewValidationError("registry", "invalid image reference", err)
+	}
+
+	log.Debug().
+		Str("registry", ref.Registry).
+		Str("repository", ref.Repository).
+		Str("reference", ref.Reference()).
+		Msg("Validating image existence")
+
+	_, exists, err := r.distribution.HeadManifest(ctx, ref)
+	return exists, err
+}
+
+// Close releases resources associated with the registry client
+func (r *GenericRegistry) Close() error {
+	return r.distribution.Close()
+}
@@ -0,0 +1,284 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+const (
+	// harborAPI is the path of the Harbor v2 API
+	harborAPI = "/api/v2.0"
+
+	// harborRobotPrefix starts the names of Harbor robot accounts
+	harborRobotPrefix = "robot$"
+)
+
+// HarborOptions holds the Harbor settings of a registry
+type HarborOptions struct {
+	Public       bool   // Create missing projects as public projects
+	StorageLimit int64  // Storage quota of created projects in bytes, -1 for none, 0 for the Harbor default
+	RobotFile    string // Robot account file exported from Harbor, replaces the username and password
+}
+
+// harborRobot is a robot account file exported from Harbor
+type harborRobot struct {
+	Name      string `json:"name"`
+	Secret    string `json:"secret"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// HarborRegistry implements the RegistryInterface for Harbor, creating the
+// projects images are pushed to
+type HarborRegistry struct {
+	*GenericRegistry
+	options  HarborOptions
+	client   *http.Client
+	username string
+	password string
+	mutex    sync.Mutex
+	projects map[string]bool
+}
+
+// Ensure HarborRegistry implements RegistryInterface, RepositoryCreator,
+// LoginProvider and ErrorClassifier
+var (
+	_ RegistryInterface = (*HarborRegistry)(nil)
+	_ RepositoryCreator = (*HarborRegistry)(nil)
+	_ LoginProvider     = (*HarborRegistry)(nil)
+	_ ErrorClassifier   = (*HarborRegistry)(nil)
+)
+
+// NewHarborRegistry creates a new client for the Harbor registry at
+// config.URL, signing in with the robot account file when one is set
+func NewHarborRegistry(config RegistryConfig, options HarborOptions) (*HarborRegistry, error) {
+	r := &HarborRegistry{
+		options:  options,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		username: config.Username,
+		password: config.Password,
+		projects: make(map[string]bool),
+	}
+	if options.RobotFile != "" {
+		robot, err := loadHarborRobot(options.RobotFile)
+		if err != nil {
+			return nil, err
+		}
+		r.username, r.password = robot.Name, robot.Secret
+	}
+
+	creds := oci.Credentials{Username: r.username, Password: r.password}
+	r.GenericRegistry = newGenericRegistry(config, func() oci.Credentials { return creds }, nil)
+	return r, nil
+}
+
+// IsRobotAccount reports whether username names a Harbor robot account
+func IsRobotAccount(username string) bool {
+	return strings.HasPrefix(username, harborRobotPrefix)
+}
+
+// loadHarborRobot reads a robot account file and checks it hasn't expired
+func loadHarborRobot(path string) (*harborRobot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.NewConfigError("registry", "failed to read robot account file", err)
+	}
+
+	var robot harborRobot
+	if err := json.Unmarshal(data, &robot); err != nil {
+		return nil, errors.NewConfigError("registry", "invalid robot account file", err)
+	}
+	if robot.Name == "" || robot.Secret == "" {
+		return nil, errors.NewConfigError("registry", "the robot account file has no name or secret", nil)
+	}
+	if robot.ExpiresAt > 0 && time.Now().After(time.Unix(robot.ExpiresAt, 0)) {
+		return nil, errors.NewAuthError("registry", fmt.Sprintf(
+			"robot account %s expired at %s", robot.Name, time.Unix(robot.ExpiresAt, 0).Format(time.RFC3339)), nil)
+	}
+	return &robot, nil
+}
+
+// Login returns the robot account, or the configured username and password
+func (r *HarborRegistry) Login(ctx context.Context) (string, string, error) {
+	return r.username, r.password, nil
+}
+
+// EnsureRepository creates the Harbor project of an image when it doesn't
+// exist. Images of other registries are ignored.
+func (r *HarborRegistry) EnsureRepository(ctx context.Context, imageRef *docker.ImageReference) error {
+	ref, err := oci.ParseReference(imageRef.FullName)
+	if err != nil {
+		return errors.NewValidationError("registry", "invalid image reference", err)
+	}
+	if ref.Registry != r.Host() {
+		return nil
+	}
+
+	project, _, ok := strings.Cut(ref.Repository, "/")
+	if !ok {
+		return errors.NewValidationError("registry", fmt.Sprintf(
+			"%s names no Harbor project, use %s/PROJECT as the target repository or PROJECT as the namespace",
+			imageRef.FullName, ref.Registry), nil)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.projects[project] {
+		return nil
+	}
+
+	exists, err := r.projectExists(ctx, project)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := r.createProject(ctx, project); err != nil {
+			return err
+		}
+	}
+	r.projects[project] = true
+	return nil
+}
+
+// projectExists checks whether a Harbor project exists
+func (r *HarborRegistry) projectExists(ctx context.Context, project string) (bool, error) {
+	resp, err := r.api(ctx, http.MethodHead, "/projects?project_name="+url.QueryEscape(project), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return false, errors.NewAuthError("registry",
+			fmt.Sprintf("%s may not look up Harbor project %s", r.username, project), harborError(resp))
+	default:
+		return false, errors.NewOperationError("registry",
+			fmt.Sprintf("failed to look up Harbor project %s", project), harborError(resp))
+	}
+}
+
+// createProject creates a Harbor project with the configured visibility and quota
+func (r *HarborRegistry) createProject(ctx context.Context, project string) error {
+	body := map[string]interface{}{
+		"project_name": project,
+		"metadata":     map[string]string{"public": strconv.FormatBool(r.options.Public)},
+	}
+	if r.options.StorageLimit != 0 {
+		body["storage_limit"] = r.options.StorageLimit
+	}
+
+	resp, err := r.api(ctx, http.MethodPost, "/projects", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		log.Info().
+			Str("registry", r.Host()).
+			Str("project", project).
+			Bool("public", r.options.Public).
+			Int64("storage_limit", r.options.StorageLimit).
+			Msg("Created Harbor project")
+		return nil
+	case http.StatusConflict:
+		// Created by someone else in the meantime
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		msg := fmt.Sprintf("%s may not create Harbor project %s", r.username, project)
+		if IsRobotAccount(r.username) {
+			msg += ", create it in Harbor first or use a system robot account that may create projects"
+		}
+		return errors.NewAuthError("registry", msg, harborError(resp)).WithDetail("project", project)
+	default:
+		return errors.NewOperationError("registry",
+			fmt.Sprintf("failed to create Harbor project %s", project), harborError(resp)).
+			WithDetail("project", project)
+	}
+}
+
+// api sends a request to the Harbor API of the registry
+func (r *HarborRegistry) api(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	scheme := "https"
+	if r.config.Insecure {
+		scheme = "http"
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.NewOperationError("registry", "failed to encode Harbor request", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, scheme+"://"+oci.Reference{Registry: r.Host()}.APIHost()+harborAPI+path, reader)
+	if err != nil {
+		return nil, errors.NewOperationError("registry", "failed to create Harbor request", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, errors.NewOperationError("registry", "failed to execute Harbor request", err)
+	}
+	return resp, nil
+}
+
+// harborError reads the error message of a Harbor API response
+func harborError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var envelope struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && len(envelope.Errors) > 0 {
+		return fmt.Errorf("status %d %s: %s", resp.StatusCode, envelope.Errors[0].Code, envelope.Errors[0].Message)
+	}
+	return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// ClassifyError reports pushes Harbor refused over a project storage quota
+// as quota errors, both from the registry API and from the Docker daemon
+func (r *HarborRegistry) ClassifyError(err error) error {
+	if err == nil || errors.IsQuotaError(err) {
+		return err
+	}
+
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, "quota exceeded") && !strings.Contains(msg, "exceed the configured upper limit") {
+		return err
+	}
+	return errors.NewQuotaError("registry", "Harbor project storage quota exceeded", err).
+		WithDetail("registry", r.Host())
+}
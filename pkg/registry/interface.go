@@ -26,6 +26,12 @@ const (
 	// ACR represents Azure's Container Registry
 	ACR Provider = "acr"
 
+	// GHCR represents the GitHub Container Registry
+	GHCR Provider = "ghcr"
+
+	// Harbor represents a Harbor registry
+	Harbor Provider = "harbor"
+
 	// Custom represents a custom registry
 	Custom Provider = "custom"
 )
@@ -57,9 +63,45 @@ type RegistryInterface interface {
 	// GetImageManifest gets the image manifest
 	GetImageManifest(ctx context.Context, repository string, reference string) ([]byte, error)
 
+	// GetImageDigest resolves the manifest digest of an image reference.
+	// It returns false when the image does not exist.
+	GetImageDigest(ctx context.Context, imageRef *docker.ImageReference) (string, bool, error)
+
 	// ValidateImage checks if an image exists in the registry
 	ValidateImage(ctx context.Context, imageRef *docker.ImageReference) (bool, error)
 
 	// Close releases any resources associated with the registry
 	Close() error
 }
+
+// RepositoryCreator is implemented by registries that need repositories to
+// be prepared before images can be pushed to them
+type RepositoryCreator interface {
+	// EnsureRepository makes sure an image can be pushed to its repository,
+	// creating the repository when the registry allows it. Images of other
+	// registries are ignored.
+	EnsureRepository(ctx context.Context, imageRef *docker.ImageReference) error
+}
+
+// LoginProvider is implemented by registries whose push credentials come
+// from the provider, e.g. short-lived tokens obtained from a provider API
+type LoginProvider interface {
+	// Login returns the current username and password for pushes,
+	// refreshing the token when it is about to expire
+	Login(ctx context.Context) (username, password string, err error)
+}
+
+// ManifestFetcher is implemented by registries that read manifests from any
+// registry an image reference names
+type ManifestFetcher interface {
+	// FetchManifest returns the manifest an image reference names
+	FetchManifest(ctx context.Context, imageRef *docker.ImageReference) ([]byte, error)
+}
+
+// ErrorClassifier is implemented by registries that recognize their own
+// failures, such as a full storage quota, in transfer errors
+type ErrorClassifier interface {
+	// ClassifyError returns a typed error for a failure the registry
+	// recognizes, or err unchanged
+	ClassifyError(err error) error
+}
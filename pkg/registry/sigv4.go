@@ -0,0 +1,174 @@
+package registry
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+)
+
+// AWSCredentials are the keys AWS API requests are signed with
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Set for temporary credentials only
+}
+
+// loadAWSCredentials returns static credentials when both keys are set, or
+// else looks them up in the environment and then in the shared credentials
+// file, like the AWS CLI does
+func loadAWSCredentials(static AWSCredentials, profile, file string) (AWSCredentials, error) {
+	if static.AccessKeyID != "" && static.SecretAccessKey != "" {
+		return static, nil
+	}
+
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return AWSCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	if file == "" {
+		file = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return AWSCredentials{}, errors.NewAuthError("registry", "no AWS credentials found", err)
+		}
+		file = filepath.Join(home, ".aws", "credentials")
+	}
+
+	creds, err := readAWSCredentialsFile(file, profile)
+	if err != nil {
+		return AWSCredentials{}, errors.NewAuthError("registry", "no AWS credentials found in static keys, environment or "+file, err)
+	}
+	return creds, nil
+}
+
+// readAWSCredentialsFile reads the keys of a profile from a shared
+// credentials file in INI format
+func readAWSCredentialsFile(path, profile string) (AWSCredentials, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	defer file.Close()
+
+	var creds AWSCredentials
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return AWSCredentials{}, err
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return AWSCredentials{}, fmt.Errorf("profile %s has no access keys", profile)
+	}
+	return creds, nil
+}
+
+// signV4 signs a request with AWS Signature Version 4. Every header already
+// set on the request is signed, along with the host and date.
+func signV4(req *http.Request, body []byte, creds AWSCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package sync
+
+import "syscall"
+
+// freeSpace returns the bytes available to unprivileged users in the file
+// system holding path
+func freeSpace(path string) (int64, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, false
+	}
+	// Bsize is an int64 on linux and a uint32 on darwin
+	return int64(stat.Bavail) * int64(stat.Bsize), true
+}
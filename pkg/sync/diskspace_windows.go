@@ -0,0 +1,6 @@
+package sync
+
+// freeSpace is not implemented on Windows, the free space check is skipped
+func freeSpace(string) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,294 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/registry"
+	"github.com/yugasun/hubsync/pkg/sync/strategies"
+	"github.com/yugasun/hubsync/pkg/transfer"
+)
+
+// Pre-flight actions taken when a batch doesn't fit
+const (
+	PreflightRefuse = "refuse"
+	PreflightTrim   = "trim"
+)
+
+// ImageEstimate is the estimated transfer size of one image of a batch
+type ImageEstimate struct {
+	Source string // Source image name
+	Size   int64  // Bytes not already counted for an earlier image of the batch
+	Known  bool   // Whether the size could be estimated
+}
+
+// PreflightReport is the outcome of the pre-flight size check
+type PreflightReport struct {
+	Images    []ImageEstimate
+	TotalSize int64           // Estimated size of the images with a known size
+	Unknown   int             // Number of images whose size is unknown
+	Limit     int64           // Bytes the batch may take, 0 when unlimited
+	LimitedBy string          // What sets the limit, e.g. the size budget or free space
+	Trimmed   []ImageEstimate // Images left out of the batch to fit the limit
+	FreeSpace int64           // Free space at FreePath, 0 when unknown
+	FreePath  string          // Directory the images are stored in, empty when none
+}
+
+// preflight estimates the transfer size of the batch from the source
+// manifests and compares it with the size budget and the free space where
+// the images are stored. A batch that doesn't fit is refused, or trimmed to
+// the images that fit in order.
+func (s *SyncerV2) preflight(ctx context.Context, operations []*strategies.SyncOperation, daemon *docker.DaemonInfo) ([]*strategies.SyncOperation, error) {
+	action := s.config.Preflight
+	if action == "" && s.config.MaxTotalSize > 0 {
+		action = PreflightRefuse
+	}
+	if action == "" {
+		return operations, nil
+	}
+
+	// Blobs shared by images of the batch count once, for the first image
+	// that has them
+	report := &PreflightReport{}
+	blobs := make([]map[string]int64, len(operations))
+	seen := make(map[string]bool)
+	readers := make(map[string]registry.RegistryInterface)
+	defer func() {
+		for _, reader := range readers {
+			reader.Close()
+		}
+	}()
+	for i, op := range operations {
+		estimate := ImageEstimate{Source: op.Source.FullName}
+		imageBlobs, err := s.estimateImage(ctx, op, daemon, readers)
+		if err != nil {
+			log.Warn().Err(err).Str("source", op.Source.FullName).Msg("Failed to estimate image size")
+			report.Unknown++
+		} else {
+			blobs[i] = imageBlobs
+			size := unseenSize(imageBlobs, seen)
+			markSeen(imageBlobs, seen)
+			estimate.Size = size
+			estimate.Known = true
+			report.TotalSize += size
+			log.Debug().Str("source", op.Source.FullName).Int64("size", size).Msg("Estimated image size")
+		}
+		report.Images = append(report.Images, estimate)
+	}
+
+	report.Limit = s.config.MaxTotalSize
+	if report.Limit > 0 {
+		report.LimitedBy = "size budget"
+	}
+	report.FreePath = s.storagePath(daemon)
+	if report.FreePath != "" {
+		if free, ok := freeSpace(report.FreePath); ok {
+			report.FreeSpace = free
+			if report.Limit == 0 || free < report.Limit {
+				report.Limit = free
+				report.LimitedBy = "free space in " + report.FreePath
+			}
+		}
+	}
+	s.preflightReport = report
+
+	log.Info().
+		Int("images", len(report.Images)).
+		Int("unknown", report.Unknown).
+		Int64("estimated_size", report.TotalSize).
+		Int64("limit", report.Limit).
+		Str("limited_by", report.LimitedBy).
+		Msg("Pre-flight size check")
+
+	if report.Limit == 0 || report.TotalSize <= report.Limit {
+		return operations, nil
+	}
+
+	if action != PreflightTrim {
+		return nil, errors.NewValidationError("sync", fmt.Sprintf(
+			"estimated transfer size %s exceeds the %s of %s",
+			config.FormatByteSize(report.TotalSize), report.LimitedBy, config.FormatByteSize(report.Limit)), nil).
+			WithDetail("images", len(report.Images))
+	}
+
+	// Keep images in order while they fit, images of unknown size can't be
+	// left out on an estimate. Sizes are counted again against the kept
+	// images only, blobs shared with a trimmed image still have to move.
+	kept := make([]*strategies.SyncOperation, 0, len(operations))
+	keptBlobs := make(map[string]bool)
+	var total int64
+	for i, op := range operations {
+		estimate := report.Images[i]
+		if !estimate.Known {
+			kept = append(kept, op)
+			continue
+		}
+		estimate.Size = unseenSize(blobs[i], keptBlobs)
+		if total+estimate.Size > report.Limit {
+			report.Trimmed = append(report.Trimmed, estimate)
+			log.Warn().
+				Str("source", estimate.Source).
+				Int64("size", estimate.Size).
+				Msg("Trimmed image from the batch to fit the size limit")
+			continue
+		}
+		markSeen(blobs[i], keptBlobs)
+		total += estimate.Size
+		kept = append(kept, op)
+	}
+	if len(kept) == 0 {
+		return nil, errors.NewValidationError("sync", fmt.Sprintf(
+			"no image fits the %s of %s", report.LimitedBy, config.FormatByteSize(report.Limit)), nil)
+	}
+	return kept, nil
+}
+
+// manifestReader returns the client reading the manifests of a registry:
+// the registry client when it serves that host, an anonymous one otherwise
+func (s *SyncerV2) manifestReader(host string, readers map[string]registry.RegistryInterface) registry.RegistryInterface {
+	clientHost := oci.DockerHubDomain
+	if hosted, ok := s.registryClient.(interface{ Host() string }); ok {
+		clientHost = hosted.Host()
+	}
+	if host == clientHost {
+		return s.registryClient
+	}
+
+	reader, ok := readers[host]
+	if !ok {
+		reader = registry.NewGenericRegistry(registry.RegistryConfig{URL: host, Insecure: s.config.Insecure})
+		readers[host] = reader
+	}
+	return reader
+}
+
+// estimateImage returns the sizes of the config and layer blobs of the
+// platforms of an image that will be copied, by digest
+func (s *SyncerV2) estimateImage(ctx context.Context, op *strategies.SyncOperation, daemon *docker.DaemonInfo, readers map[string]registry.RegistryInterface) (map[string]int64, error) {
+	blobs := make(map[string]int64)
+
+	// Archives are read from disk, nothing is downloaded
+	if archive.IsLocation(op.Source.FullName) {
+		return blobs, nil
+	}
+
+	ref, err := oci.ParseReference(op.Source.FullName)
+	if err != nil {
+		return nil, err
+	}
+	reader := s.manifestReader(ref.Registry, readers)
+
+	data, err := reader.GetImageManifest(ctx, ref.Repository, ref.Reference())
+	if err != nil {
+		return nil, err
+	}
+	if !oci.IsIndexMediaType(oci.DetectMediaType(data)) {
+		return blobs, addManifestBlobs(data, blobs)
+	}
+
+	index, err := oci.ParseIndex(data)
+	if err != nil {
+		return nil, err
+	}
+	platforms, err := s.estimatePlatforms(op, daemon)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range index.Manifests {
+		if child.Platform != nil && len(platforms) > 0 && !oci.MatchesAny(child.Platform, platforms) {
+			continue
+		}
+		childData, err := reader.GetImageManifest(ctx, ref.Repository, child.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if err := addManifestBlobs(childData, blobs); err != nil {
+			return nil, err
+		}
+	}
+	return blobs, nil
+}
+
+// estimatePlatforms returns the platforms of an index that will be copied:
+// the filter of the image, or the daemon's own platform, which is the only
+// one it pulls. None means every platform.
+func (s *SyncerV2) estimatePlatforms(op *strategies.SyncOperation, daemon *docker.DaemonInfo) ([]oci.Platform, error) {
+	if s.config.Transport == transfer.TransportRegistry {
+		return oci.ParsePlatforms(op.Source.Platforms)
+	}
+	if daemon == nil {
+		return nil, errors.NewClientError("sync", "the platform of the Docker daemon is unknown", nil)
+	}
+	return []oci.Platform{daemon.Platform}, nil
+}
+
+// daemonInfo reads the data root and platform of the Docker daemon when the
+// daemon transport is used, nil when they are unknown
+func (s *SyncerV2) daemonInfo(ctx context.Context) *docker.DaemonInfo {
+	if s.config.Transport == transfer.TransportRegistry {
+		return nil
+	}
+
+	inspector, ok := s.dockerClient.(docker.DaemonInspector)
+	if !ok {
+		log.Warn().Msg("The Docker client can't describe its daemon, its platform and data root are unknown")
+		return nil
+	}
+
+	info, err := inspector.DaemonInfo(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read the Docker daemon info, its platform and data root are unknown")
+		return nil
+	}
+	return info
+}
+
+// storagePath returns the directory pulled images are stored in: the Docker
+// data root for the daemon transport, the blob cache for the registry one
+func (s *SyncerV2) storagePath(daemon *docker.DaemonInfo) string {
+	if s.config.Transport == transfer.TransportRegistry {
+		return s.config.CacheDir
+	}
+	if daemon == nil {
+		return ""
+	}
+	return daemon.DataRoot
+}
+
+// addManifestBlobs adds the blobs of a manifest to blobs
+func addManifestBlobs(data []byte, blobs map[string]int64) error {
+	manifest, err := oci.ParseManifest(data)
+	if err != nil {
+		return err
+	}
+	for _, blob := range manifest.Content() {
+		blobs[blob.Digest] = blob.Size
+	}
+	return nil
+}
+
+// unseenSize sums the blobs that are not in seen
+func unseenSize(blobs map[string]int64, seen map[string]bool) int64 {
+	var size int64
+	for digest, blobSize := range blobs {
+		if !seen[digest] {
+			size += blobSize
+		}
+	}
+	return size
+}
+
+// markSeen adds the blobs to seen
+func markSeen(blobs map[string]int64, seen map[string]bool) {
+	for digest := range blobs {
+		seen[digest] = true
+	}
+}
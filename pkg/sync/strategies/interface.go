@@ -4,6 +4,9 @@ import (
 	"context"
 
 	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/registry"
+	"github.com/yugasun/hubsync/pkg/transfer"
 )
 
 // SyncStrategy defines the interface for different synchronization strategies
@@ -22,44 +25,101 @@ type SyncOperation struct {
 	ValidateDst bool
 	Force       bool
 	DryRun      bool
+
+	// Platform is the only platform of a multi-platform source the transport
+	// pushes, nil when the whole index is copied
+	Platform *oci.Platform
 }
 
-// SyncResult represents the result of a synchronization operation
+// ResultStatus is the outcome of a synchronization operation
+type ResultStatus string
+
+const (
+	// StatusSucceeded means the image was transferred to the target
+	StatusSucceeded ResultStatus = "succeeded"
+
+	// StatusFailed means the transfer failed
+	StatusFailed ResultStatus = "failed"
+
+	// StatusSkipped means the target already matched the source
+	StatusSkipped ResultStatus = "skipped"
+)
+
+// SyncResult represents the result of a synchronization operation.
+// Success is true for both succeeded and skipped operations.
 type SyncResult struct {
 	Operation    *SyncOperation
+	Status       ResultStatus
 	Success      bool
 	Error        error
-	Duration     int64 // Duration in milliseconds
-	ImageSize    int64 // Size in bytes
-	BytesMoved   int64
-	StartTime    int64 // Unix timestamp
-	EndTime      int64 // Unix timestamp
+	Duration     int64  // Duration in milliseconds
+	SourceDigest string // Resolved digest of the source manifest
+	TargetDigest string // Digest of the manifest pushed to the target
+	ChecksumOK   bool   // Target digest was read back and matched the source
+	ImageSize    int64  // Size in bytes
+	BytesMoved   int64  // Bytes transferred to the target
+	BytesSkipped int64  // Bytes already present in the target
+	BlobsMounted int    // Blobs mounted from another repository
+	StartTime    int64  // Unix timestamp
+	EndTime      int64  // Unix timestamp
 	DetailedLogs []string
+
+	// FilteredPlatforms lists the platforms left out of a multi-platform copy
+	FilteredPlatforms []string
+
+	// Conversions maps recompressed source layers to the converted layers
+	Conversions []transfer.LayerConversion
+
+	// ArtifactType is set when the source is an OCI artifact, not an image
+	ArtifactType string
+
+	// Artifacts lists the signatures, attestations, SBOMs and referrers
+	// copied along with the image
+	Artifacts []transfer.Artifact
+}
+
+// applyReport copies the outcome of a transfer to a result, except for its
+// logs, which each strategy prefixes its own way
+func applyReport(result *SyncResult, report *transfer.Report) {
+	result.ImageSize = report.ImageSize
+	result.BytesMoved = report.BytesMoved
+	result.BytesSkipped = report.BytesSkipped
+	result.BlobsMounted = report.BlobsMounted
+	result.FilteredPlatforms = report.FilteredPlatforms
+	result.ArtifactType = report.ArtifactType
+	result.Conversions = report.Conversions
+	result.Artifacts = report.Artifacts
+	result.SourceDigest = report.SourceDigest
+	result.TargetDigest = report.TargetDigest
+	result.ChecksumOK = report.ChecksumOK
 }
 
 // StrategyFactory creates synchronization strategies
 type StrategyFactory struct {
-	dockerClient docker.ClientInterface
-	concurrency  int
-	validateDst  bool
-	force        bool
-	dryRun       bool
+	engine         transfer.Engine
+	registryClient registry.RegistryInterface
+	concurrency    int
+	validateDst    bool
+	force          bool
+	dryRun         bool
 }
 
 // NewStrategyFactory creates a new strategy factory
 func NewStrategyFactory(
-	dockerClient docker.ClientInterface,
+	engine transfer.Engine,
+	registryClient registry.RegistryInterface,
 	concurrency int,
 	validateDst bool,
 	force bool,
 	dryRun bool,
 ) *StrategyFactory {
 	return &StrategyFactory{
-		dockerClient: dockerClient,
-		concurrency:  concurrency,
-		validateDst:  validateDst,
-		force:        force,
-		dryRun:       dryRun,
+		engine:         engine,
+		registryClient: registryClient,
+		concurrency:    concurrency,
+		validateDst:    validateDst,
+		force:          force,
+		dryRun:         dryRun,
 	}
 }
 
@@ -67,8 +127,8 @@ func NewStrategyFactory(
 func (f *StrategyFactory) CreateStrategy(strategyName string) SyncStrategy {
 	switch strategyName {
 	case "parallel":
-		return NewParallelStrategy(f.dockerClient, f.concurrency)
+		return NewParallelStrategy(f.engine, f.registryClient, f.concurrency)
 	default:
-		return NewStandardStrategy(f.dockerClient)
+		return NewStandardStrategy(f.engine, f.registryClient)
 	}
 }
@@ -8,29 +8,32 @@ import (
 
 	"github.com/rs/zerolog/log"
 
-	"github.com/yugasun/hubsync/pkg/docker"
 	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/registry"
+	"github.com/yugasun/hubsync/pkg/transfer"
 )
 
 // ParallelStrategy implements a concurrent synchronization strategy
 type ParallelStrategy struct {
-	dockerClient docker.ClientInterface
-	concurrency  int
+	engine         transfer.Engine
+	registryClient registry.RegistryInterface
+	concurrency    int
 }
 
 // Ensure ParallelStrategy implements SyncStrategy
 var _ SyncStrategy = (*ParallelStrategy)(nil)
 
 // NewParallelStrategy creates a new parallel sync strategy
-func NewParallelStrategy(dockerClient docker.ClientInterface, concurrency int) *ParallelStrategy {
+func NewParallelStrategy(engine transfer.Engine, registryClient registry.RegistryInterface, concurrency int) *ParallelStrategy {
 	// Default to 4 concurrent operations if not specified
 	if concurrency <= 0 {
 		concurrency = 4
 	}
 
 	return &ParallelStrategy{
-		dockerClient: dockerClient,
-		concurrency:  concurrency,
+		engine:         engine,
+		registryClient: registryClient,
+		concurrency:    concurrency,
 	}
 }
 
@@ -119,17 +122,26 @@ func (s *ParallelStrategy) Execute(ctx context.Context, operations []*SyncOperat
 	results := make([]*SyncResult, 0, len(operations))
 	successCount := 0
 	failureCount := 0
+	skippedCount := 0
 
 	for result := range resultChan {
 		results = append(results, result)
 
-		if result.Success {
+		if result.Status == StatusSkipped {
+			skippedCount++
+			log.Info().
+				Str("source", result.Operation.Source.FullName).
+				Str("target", result.Operation.Target.FullName).
+				Str("digest", result.TargetDigest).
+				Msg("Image already up to date, skipped")
+		} else if result.Success {
 			successCount++
 			log.Info().
 				Str("source", result.Operation.Source.FullName).
 				Str("target", result.Operation.Target.FullName).
 				Int64("duration_ms", result.Duration).
 				Int64("bytes", result.BytesMoved).
+				Int64("bytes_skipped", result.BytesSkipped).
 				Int("success_count", successCount).
 				Int("failure_count", failureCount).
 				Msg("Image sync successful")
@@ -155,6 +167,7 @@ func (s *ParallelStrategy) Execute(ctx context.Context, operations []*SyncOperat
 		Int("total", len(results)).
 		Int("success", successCount).
 		Int("failure", failureCount).
+		Int("skipped", skippedCount).
 		Msg("Parallel sync completed")
 
 	return results, nil
@@ -164,6 +177,7 @@ func (s *ParallelStrategy) Execute(ctx context.Context, operations []*SyncOperat
 func (s *ParallelStrategy) executeSingleOperation(ctx context.Context, op *SyncOperation, workerId int) *SyncResult {
 	result := &SyncResult{
 		Operation: op,
+		Status:    StatusFailed,
 		StartTime: time.Now().Unix(),
 		Success:   false,
 	}
@@ -180,56 +194,47 @@ func (s *ParallelStrategy) executeSingleOperation(ctx context.Context, op *SyncO
 	if op.DryRun {
 		logMsg := fmt.Sprintf("Dry run: would sync from %s to %s", op.Source.FullName, op.Target.FullName)
 		result.DetailedLogs = append(result.DetailedLogs, workerPrefix+logMsg)
+		result.Status = StatusSucceeded
 		result.Success = true
 		return result
 	}
 
-	// Step 1: Pull the source image
-	result.DetailedLogs = append(result.DetailedLogs,
-		workerPrefix+fmt.Sprintf("Pulling source image: %s", op.Source.FullName))
-
-	if err := s.dockerClient.PullImage(ctx, op.Source.FullName); err != nil {
-		result.Error = errors.NewOperationError(
-			"sync",
-			fmt.Sprintf("worker %d failed to pull source image", workerId),
-			err,
-		)
-		result.DetailedLogs = append(result.DetailedLogs,
-			workerPrefix+fmt.Sprintf("Pull failed: %v", err))
-		return result
+	// Skip images whose target already matches the source
+	if op.ValidateDst && !op.Force {
+		if digest, upToDate := checkTarget(ctx, s.registryClient, op); upToDate {
+			result.Status = StatusSkipped
+			result.Success = true
+			result.SourceDigest = digest
+			result.TargetDigest = digest
+			result.DetailedLogs = append(result.DetailedLogs,
+				fmt.Sprintf("%sTarget %s is up to date at %s", workerPrefix, op.Target.FullName, digest))
+			return result
+		}
 	}
 
-	// Step 2: Tag the image with the target name
-	result.DetailedLogs = append(result.DetailedLogs,
-		workerPrefix+fmt.Sprintf("Tagging image from %s to %s", op.Source.FullName, op.Target.FullName))
-
-	if err := s.dockerClient.TagImage(ctx, op.Source.FullName, op.Target.FullName); err != nil {
-		result.Error = errors.NewOperationError(
-			"sync",
-			fmt.Sprintf("worker %d failed to tag image", workerId),
-			err,
-		)
-		result.DetailedLogs = append(result.DetailedLogs,
-			workerPrefix+fmt.Sprintf("Tag failed: %v", err))
-		return result
+	// Transfer the image with the configured engine
+	report, err := s.engine.Transfer(ctx, op.Source, op.Target)
+	if report != nil {
+		for _, line := range report.Logs {
+			result.DetailedLogs = append(result.DetailedLogs, workerPrefix+line)
+		}
+		applyReport(result, report)
 	}
-
-	// Step 3: Push the tagged image to the target registry
-	result.DetailedLogs = append(result.DetailedLogs,
-		workerPrefix+fmt.Sprintf("Pushing target image: %s", op.Target.FullName))
-
-	if err := s.dockerClient.PushImage(ctx, op.Target.FullName); err != nil {
+	if err != nil {
 		result.Error = errors.NewOperationError(
 			"sync",
-			fmt.Sprintf("worker %d failed to push target image", workerId),
+			fmt.Sprintf("worker %d failed to transfer image", workerId),
 			err,
 		)
-		result.DetailedLogs = append(result.DetailedLogs,
-			workerPrefix+fmt.Sprintf("Push failed: %v", err))
+		if errors.IsVerificationError(err) {
+			// Keep the dedicated type so digest mismatches are reported as such
+			result.Error = err
+		}
 		return result
 	}
 
 	// Set success
+	result.Status = StatusSucceeded
 	result.Success = true
 	result.DetailedLogs = append(result.DetailedLogs,
 		workerPrefix+"Synchronization completed successfully")
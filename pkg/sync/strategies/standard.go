@@ -7,22 +7,25 @@ import (
 
 	"github.com/rs/zerolog/log"
 
-	"github.com/yugasun/hubsync/pkg/docker"
 	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/registry"
+	"github.com/yugasun/hubsync/pkg/transfer"
 )
 
 // StandardStrategy implements a sequential synchronization strategy
 type StandardStrategy struct {
-	dockerClient docker.ClientInterface
+	engine         transfer.Engine
+	registryClient registry.RegistryInterface
 }
 
 // Ensure StandardStrategy implements SyncStrategy
 var _ SyncStrategy = (*StandardStrategy)(nil)
 
 // NewStandardStrategy creates a new standard (sequential) sync strategy
-func NewStandardStrategy(dockerClient docker.ClientInterface) *StandardStrategy {
+func NewStandardStrategy(engine transfer.Engine, registryClient registry.RegistryInterface) *StandardStrategy {
 	return &StandardStrategy{
-		dockerClient: dockerClient,
+		engine:         engine,
+		registryClient: registryClient,
 	}
 }
 
@@ -49,12 +52,19 @@ func (s *StandardStrategy) Execute(ctx context.Context, operations []*SyncOperat
 		results = append(results, result)
 
 		// Log result
-		if result.Success {
+		if result.Status == StatusSkipped {
+			log.Info().
+				Str("source", op.Source.FullName).
+				Str("target", op.Target.FullName).
+				Str("digest", result.TargetDigest).
+				Msg("Image already up to date, skipped")
+		} else if result.Success {
 			log.Info().
 				Str("source", op.Source.FullName).
 				Str("target", op.Target.FullName).
 				Int64("duration_ms", result.Duration).
 				Int64("bytes", result.BytesMoved).
+				Int64("bytes_skipped", result.BytesSkipped).
 				Msg("Image sync successful")
 		} else {
 			log.Error().
@@ -72,6 +82,7 @@ func (s *StandardStrategy) Execute(ctx context.Context, operations []*SyncOperat
 func (s *StandardStrategy) executeSingleOperation(ctx context.Context, op *SyncOperation) *SyncResult {
 	result := &SyncResult{
 		Operation: op,
+		Status:    StatusFailed,
 		StartTime: time.Now().Unix(),
 		Success:   false,
 	}
@@ -91,47 +102,46 @@ func (s *StandardStrategy) executeSingleOperation(ctx context.Context, op *SyncO
 	// If this is a dry run, just log and return success
 	if op.DryRun {
 		opLog.Info().Msg("Dry run: would sync image")
+		result.Status = StatusSucceeded
 		result.Success = true
 		result.DetailedLogs = append(result.DetailedLogs, fmt.Sprintf("Dry run: would sync from %s to %s",
 			op.Source.FullName, op.Target.FullName))
 		return result
 	}
 
-	// Step 1: Pull the source image
-	opLog.Debug().Msg("Pulling source image")
-	result.DetailedLogs = append(result.DetailedLogs, fmt.Sprintf("Pulling source image: %s", op.Source.FullName))
-
-	if err := s.dockerClient.PullImage(ctx, op.Source.FullName); err != nil {
-		opLog.Error().Err(err).Msg("Failed to pull source image")
-		result.Error = errors.NewOperationError("sync", "failed to pull source image", err)
-		result.DetailedLogs = append(result.DetailedLogs, fmt.Sprintf("Pull failed: %v", err))
-		return result
+	// Skip images whose target already matches the source
+	if op.ValidateDst && !op.Force {
+		if digest, upToDate := checkTarget(ctx, s.registryClient, op); upToDate {
+			result.Status = StatusSkipped
+			result.Success = true
+			result.SourceDigest = digest
+			result.TargetDigest = digest
+			result.DetailedLogs = append(result.DetailedLogs,
+				fmt.Sprintf("Target %s is up to date at %s", op.Target.FullName, digest))
+			return result
+		}
 	}
 
-	// Step 2: Tag the image with the target name
-	opLog.Debug().Msg("Tagging image")
-	result.DetailedLogs = append(result.DetailedLogs,
-		fmt.Sprintf("Tagging image from %s to %s", op.Source.FullName, op.Target.FullName))
+	// Transfer the image with the configured engine
+	opLog.Debug().Str("transport", s.engine.Name()).Msg("Transferring image")
 
-	if err := s.dockerClient.TagImage(ctx, op.Source.FullName, op.Target.FullName); err != nil {
-		opLog.Error().Err(err).Msg("Failed to tag image")
-		result.Error = errors.NewOperationError("sync", "failed to tag image", err)
-		result.DetailedLogs = append(result.DetailedLogs, fmt.Sprintf("Tag failed: %v", err))
-		return result
+	report, err := s.engine.Transfer(ctx, op.Source, op.Target)
+	if report != nil {
+		result.DetailedLogs = append(result.DetailedLogs, report.Logs...)
+		applyReport(result, report)
 	}
-
-	// Step 3: Push the tagged image to the target registry
-	opLog.Debug().Msg("Pushing target image")
-	result.DetailedLogs = append(result.DetailedLogs, fmt.Sprintf("Pushing target image: %s", op.Target.FullName))
-
-	if err := s.dockerClient.PushImage(ctx, op.Target.FullName); err != nil {
-		opLog.Error().Err(err).Msg("Failed to push target image")
-		result.Error = errors.NewOperationError("sync", "failed to push target image", err)
-		result.DetailedLogs = append(result.DetailedLogs, fmt.Sprintf("Push failed: %v", err))
+	if err != nil {
+		opLog.Error().Err(err).Msg("Failed to transfer image")
+		result.Error = errors.NewOperationError("sync", "failed to transfer image", err)
+		if errors.IsVerificationError(err) {
+			// Keep the dedicated type so digest mismatches are reported as such
+			result.Error = err
+		}
 		return result
 	}
 
 	// Set success
+	result.Status = StatusSucceeded
 	result.Success = true
 	result.DetailedLogs = append(result.DetailedLogs, "Synchronization completed successfully")
 
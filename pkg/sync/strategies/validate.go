@@ -0,0 +1,108 @@
+package strategies
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/registry"
+)
+
+// checkTarget resolves the source and target digests of an operation and
+// reports whether the target already holds the source image. Resolution
+// failures are logged and treated as out of date so the image is transferred.
+func checkTarget(ctx context.Context, registryClient registry.RegistryInterface, op *SyncOperation) (string, bool) {
+	if registryClient == nil {
+		return "", false
+	}
+
+	opLog := log.With().
+		Str("source", op.Source.FullName).
+		Str("target", op.Target.FullName).
+		Logger()
+
+	// Archives live on disk, not in the registry
+	if archive.IsLocation(op.Source.FullName) || archive.IsLocation(op.Target.FullName) {
+		return "", false
+	}
+
+	// A platform filter produces a new index whose digest can't be predicted
+	if len(op.Source.Platforms) > 0 {
+		opLog.Debug().Msg("Skipping target validation for platform-filtered image")
+		return "", false
+	}
+
+	targetDigest, exists, err := registryClient.GetImageDigest(ctx, op.Target)
+	if err != nil {
+		opLog.Warn().Err(err).Msg("Failed to resolve target digest, transferring anyway")
+		return "", false
+	}
+	if !exists {
+		return "", false
+	}
+
+	// Pinned sources don't need a lookup
+	sourceDigest := op.Source.Digest
+	if sourceDigest == "" {
+		sourceDigest, exists, err = registryClient.GetImageDigest(ctx, op.Source)
+		if err != nil || !exists {
+			opLog.Warn().Err(err).Msg("Failed to resolve source digest, transferring anyway")
+			return "", false
+		}
+	}
+
+	opLog.Debug().
+		Str("source_digest", sourceDigest).
+		Str("target_digest", targetDigest).
+		Msg("Resolved image digests")
+
+	if sourceDigest == targetDigest {
+		return sourceDigest, true
+	}
+
+	// A transport pushing a single platform of an index leaves the manifest
+	// of that platform in the target
+	if op.Platform != nil {
+		platformDigest, err := resolvePlatform(ctx, registryClient, op, sourceDigest)
+		if err != nil {
+			opLog.Warn().Err(err).Msg("Failed to resolve source platform digest, transferring anyway")
+			return "", false
+		}
+		if platformDigest != "" && platformDigest == targetDigest {
+			return platformDigest, true
+		}
+	}
+
+	return sourceDigest, false
+}
+
+// resolvePlatform returns the digest of the manifest for the platform of the
+// operation when the source is an index, empty when it isn't
+func resolvePlatform(ctx context.Context, registryClient registry.RegistryInterface, op *SyncOperation, sourceDigest string) (string, error) {
+	fetcher, ok := registryClient.(registry.ManifestFetcher)
+	if !ok {
+		return "", nil
+	}
+
+	data, err := fetcher.FetchManifest(ctx, op.Source)
+	if err != nil {
+		return "", err
+	}
+	// The tag may have moved since its digest was resolved
+	if oci.ComputeDigest(data) != sourceDigest || !oci.IsIndexMediaType(oci.DetectMediaType(data)) {
+		return "", nil
+	}
+
+	index, err := oci.ParseIndex(data)
+	if err != nil {
+		return "", err
+	}
+	for _, child := range index.Manifests {
+		if child.Platform.Matches(*op.Platform) {
+			return child.Digest, nil
+		}
+	}
+	return "", nil
+}
@@ -264,7 +264,7 @@ func (s *Syncer) ProcessImage(ctx context.Context, source string) (string, strin
 	// Pull image
 	log.Info().Str("image", source).Msg("Pulling image")
 	pullStart := time.Now()
-	if err := s.Client.PullImage(ctx, source); err != nil {
+	if _, err := s.Client.PullImage(ctx, source); err != nil {
 		return source, target, fmt.Errorf("failed to pull image %s: %w", source, err)
 	}
 	log.Info().
@@ -290,7 +290,7 @@ func (s *Syncer) ProcessImage(ctx context.Context, source string) (string, strin
 	// Push image
 	log.Info().Str("image", target).Msg("Pushing image")
 	pushStart := time.Now()
-	if err := s.Client.PushImage(ctx, target); err != nil {
+	if _, err := s.Client.PushImage(ctx, target); err != nil {
 		return source, target, fmt.Errorf("failed to push image %s: %w", target, err)
 	}
 	log.Info().
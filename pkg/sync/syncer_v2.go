@@ -12,11 +12,16 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/bandwidth"
+	"github.com/yugasun/hubsync/pkg/cache"
 	"github.com/yugasun/hubsync/pkg/docker"
 	"github.com/yugasun/hubsync/pkg/errors"
 	"github.com/yugasun/hubsync/pkg/observability"
+	"github.com/yugasun/hubsync/pkg/oci"
 	"github.com/yugasun/hubsync/pkg/registry"
 	"github.com/yugasun/hubsync/pkg/sync/strategies"
+	"github.com/yugasun/hubsync/pkg/transfer"
 )
 
 // SyncStatisticsV2 holds statistics for the synchronization process
@@ -25,20 +30,57 @@ type SyncStatisticsV2 struct {
 	Successful      int           // Number of successfully synced images
 	Failed          int           // Number of failed sync operations
 	Skipped         int           // Number of skipped images
+	MountedBlobs    int           // Number of blobs mounted instead of uploaded
+	Verified        int           // Number of targets whose digest was verified after push
+	Mismatched      int           // Number of targets whose digest did not match the source
+	QuotaExceeded   int           // Number of pushes refused over a registry storage quota
+	CacheHits       int64         // Number of blobs read from the local cache
+	CacheMisses     int64         // Number of blobs fetched from the network
+	PrunedImages    int           // Number of dangling images pruned from the local daemon
+	SpaceReclaimed  int64         // Disk space freed by pruning in bytes
 	TotalDuration   time.Duration // Total duration of the sync process
 	AverageDuration time.Duration // Average duration per successful operation
 }
 
+// contentEntry is one image listed in the content. Entries are either a plain
+// image string or an object that overrides per-image settings, e.g.
+// {"image": "nginx:latest", "platforms": ["linux/amd64"], "repository": "oci:/mnt/export"}
+type contentEntry struct {
+	Image      string   `json:"image"`
+	Platforms  []string `json:"platforms,omitempty"`
+	Repository string   `json:"repository,omitempty"`
+}
+
+// UnmarshalJSON accepts both the string and the object form of an entry
+func (e *contentEntry) UnmarshalJSON(data []byte) error {
+	var image string
+	if err := json.Unmarshal(data, &image); err == nil {
+		e.Image = image
+		return nil
+	}
+
+	type plain contentEntry
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+// throughputInterval is how often the throughput gauges are updated
+const throughputInterval = time.Second
+
 // SyncerV2 represents the enhanced syncer with dependency injection
 type SyncerV2 struct {
 	config           *config.Config
 	dockerClient     docker.ClientInterface
 	registryClient   registry.RegistryInterface
+	engine           transfer.Engine
+	blobCache        *cache.BlobCache
+	bandwidth        *bandwidth.Limits
+	preflightReport  *PreflightReport
 	strategyFactory  *strategies.StrategyFactory
 	operations       []*strategies.SyncOperation
 	results          []*strategies.SyncResult
 	processedCount   int
 	statistics       *SyncStatisticsV2
+	metrics          *observability.MetricsManager
 	telemetryEnabled bool
 	correlationID    string
 }
@@ -49,9 +91,30 @@ func NewSyncerV2(
 	dockerClient docker.ClientInterface,
 	registryClient registry.RegistryInterface,
 ) *SyncerV2 {
+	// Pulls, pushes and registry copies share the bandwidth limits, a Docker
+	// client created with limits brings its own
+	var limits *bandwidth.Limits
+	if limited, ok := dockerClient.(docker.BandwidthLimited); ok {
+		limits = limited.Bandwidth()
+	}
+	if limits == nil {
+		limits = NewBandwidthLimits(config)
+	}
+
+	// Registries with short-lived tokens log registry copies in with a
+	// fresh one, the Docker client gets the same login when it is created
+	var login docker.LoginFunc
+	if provider, ok := registryClient.(registry.LoginProvider); ok {
+		login = provider.Login
+	}
+
+	// Create the transfer engine selected by configuration
+	engine, blobCache := newTransferEngine(config, dockerClient, registryClient, limits, login)
+
 	// Create a strategy factory
 	strategyFactory := strategies.NewStrategyFactory(
-		dockerClient,
+		engine,
+		registryClient,
 		config.Concurrency,
 		true, // validateDst
 		config.Force,
@@ -62,15 +125,192 @@ func NewSyncerV2(
 		config:           config,
 		dockerClient:     dockerClient,
 		registryClient:   registryClient,
+		engine:           engine,
+		blobCache:        blobCache,
+		bandwidth:        limits,
 		strategyFactory:  strategyFactory,
 		operations:       make([]*strategies.SyncOperation, 0),
 		results:          make([]*strategies.SyncResult, 0),
 		statistics:       &SyncStatisticsV2{},
+		metrics:          observability.NewMetricsManager(false, "hubsync"),
 		telemetryEnabled: true,
 		correlationID:    fmt.Sprintf("sync-%d", time.Now().UnixNano()),
 	}
 }
 
+// SetMetricsManager sets the metrics manager that sync outcomes are recorded to
+func (s *SyncerV2) SetMetricsManager(metrics *observability.MetricsManager) {
+	s.metrics = metrics
+}
+
+// newTransferEngine creates the transfer engine for the configured transport,
+// along with the blob cache it uses if one is configured. A login function
+// replaces the configured credentials of the target registry, the registry
+// client verifies daemon pushes.
+func newTransferEngine(cfg *config.Config, dockerClient docker.ClientInterface, registryClient registry.RegistryInterface, limits *bandwidth.Limits, login docker.LoginFunc) (transfer.Engine, *cache.BlobCache) {
+	// Credentials only apply to the target registry, sources are pulled anonymously
+	targetHost := targetAPIHost(cfg.Repository)
+
+	credentials := oci.StaticCredentials(
+		oci.Credentials{Username: cfg.Username, Password: cfg.Password},
+		targetHost,
+	)
+	if login != nil {
+		credentials = func(host string) oci.Credentials {
+			if host != targetHost {
+				return oci.Credentials{}
+			}
+			// Tokens are cached by the provider, this only waits on a refresh
+			username, password, err := login(context.Background())
+			if err != nil {
+				log.Warn().Err(err).Str("registry", host).Msg("Failed to get registry credentials")
+				return oci.Credentials{}
+			}
+			return oci.Credentials{Username: username, Password: password}
+		}
+	}
+
+	client := oci.NewClient(oci.ClientConfig{
+		PlainHTTP:   cfg.Insecure,
+		Credentials: credentials,
+		UserAgent:   "hubsync/" + cfg.Version,
+	})
+
+	// A broken cache only costs bandwidth, so carry on without it
+	var blobCache *cache.BlobCache
+	if cfg.CacheDir != "" {
+		var err error
+		blobCache, err = cache.NewBlobCache(cfg.CacheDir, cfg.CacheMaxSize)
+		if err != nil {
+			log.Warn().Err(err).Str("dir", cfg.CacheDir).Msg("Failed to open blob cache, continuing without it")
+			blobCache = nil
+		}
+	}
+
+	registryEngine := transfer.NewRegistryEngine(client, blobCache)
+	registryEngine.SetBandwidth(limits)
+	if cfg.Bundle || len(cfg.BundleBase) > 0 {
+		registryEngine.SetBundle(cfg.BundleBase)
+	}
+	if cfg.CopyReferrers || cfg.RequireReferrers {
+		registryEngine.SetReferrers(true)
+		registryEngine.SetRequireReferrers(cfg.RequireReferrers)
+		if cfg.Transport != transfer.TransportRegistry {
+			log.Warn().Str("transport", cfg.Transport).Msg("Signatures and referrers are only copied by the registry transport")
+		}
+	}
+	if cfg.ConvertLayers != "" {
+		registryEngine.SetConversion(cfg.ConvertLayers)
+		if cfg.Transport != transfer.TransportRegistry {
+			log.Warn().Str("transport", cfg.Transport).Msg("Layers are only converted by the registry transport")
+		}
+	}
+
+	// Local images only exist with the daemon transport
+	if cfg.Transport == transfer.TransportRegistry && (cfg.Cleanup || cfg.PruneDangling) {
+		log.Warn().Str("transport", cfg.Transport).Msg("Local images are only cleaned up with the daemon transport")
+	}
+
+	// The daemon can't read or write archives, route those to the registry engine
+	if cfg.Transport != transfer.TransportRegistry {
+		daemonEngine := transfer.NewDaemonEngine(dockerClient, registryClient)
+		daemonEngine.SetCleanup(cfg.Cleanup)
+		return transfer.NewRouter(daemonEngine, registryEngine), blobCache
+	}
+
+	return registryEngine, blobCache
+}
+
+// targetAPIHost returns the host serving the distribution API of the target
+// repository. A repository without a registry host, like user/repo, and
+// docker.io itself are on Docker Hub.
+func targetAPIHost(repository string) string {
+	if repository != "" && !archive.IsLocation(repository) {
+		// A placeholder image name lets the parser tell a host from a namespace
+		if ref, err := oci.ParseReference(strings.TrimSuffix(repository, "/") + "/image"); err == nil {
+			return ref.APIHost()
+		}
+	}
+	return oci.Reference{Registry: oci.DockerHubDomain}.APIHost()
+}
+
+// NewBandwidthLimits creates the bandwidth limits of the configuration. They
+// also measure throughput, so they are created even without any limit.
+func NewBandwidthLimits(cfg *config.Config) *bandwidth.Limits {
+	registries, err := config.ParseRegistryBandwidth(cfg.RegistryBandwidth)
+	if err != nil {
+		log.Warn().Err(err).Msg("Ignoring invalid registry bandwidth limits")
+		registries = nil
+	}
+	return bandwidth.NewLimits(cfg.MaxBandwidth, registries)
+}
+
+// ensureRepositories prepares the target repositories of the batch when the
+// registry client requires it. Failures are logged, the push reports them.
+func (s *SyncerV2) ensureRepositories(ctx context.Context) {
+	creator, ok := s.registryClient.(registry.RepositoryCreator)
+	if !ok || s.config.DryRun {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, op := range s.operations {
+		ref, err := oci.ParseReference(op.Target.FullName)
+		if err != nil || seen[ref.Registry+"/"+ref.Repository] {
+			continue
+		}
+		seen[ref.Registry+"/"+ref.Repository] = true
+
+		if err := creator.EnsureRepository(ctx, op.Target); err != nil {
+			log.Warn().Err(err).Str("target", op.Target.FullName).Msg("Target repository is not ready for pushes")
+		}
+	}
+}
+
+// classifyErrors replaces the errors of failed results with the typed errors
+// of the registry client, when it recognizes its own failures
+func (s *SyncerV2) classifyErrors(results []*strategies.SyncResult) {
+	classifier, ok := s.registryClient.(registry.ErrorClassifier)
+	if !ok {
+		return
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			result.Error = classifier.ClassifyError(result.Error)
+		}
+	}
+}
+
+// recordThroughput samples the throughput into the metrics every interval
+// until the returned function is called, which resets the gauges to zero
+func (s *SyncerV2) recordThroughput(interval time.Duration) func() {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for host, rate := range s.bandwidth.Throughput() {
+					s.metrics.RecordThroughput(host, rate)
+				}
+			case <-done:
+				for host := range s.bandwidth.Throughput() {
+					s.metrics.RecordThroughput(host, 0)
+				}
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
 // Run executes the synchronization process
 func (s *SyncerV2) Run(ctx context.Context) error {
 	startTime := time.Now()
@@ -89,6 +329,13 @@ func (s *SyncerV2) Run(ctx context.Context) error {
 		return errors.NewConfigError("sync", "failed to parse content", err)
 	}
 
+	// List the images of archive sources given without an image name
+	images, err = s.expandArchiveSources(images)
+	if err != nil {
+		_ = s.engine.Close()
+		return errors.NewConfigError("sync", "failed to read archive source", err)
+	}
+
 	// Initialize statistics
 	s.statistics.TotalImages = len(images)
 
@@ -100,8 +347,22 @@ func (s *SyncerV2) Run(ctx context.Context) error {
 		Bool("dry_run", s.config.DryRun).
 		Msg("Starting image synchronization")
 
+	// The daemon only pulls and pushes its own platform of an index
+	daemon := s.daemonInfo(ctx)
+
 	// Create sync operations
-	s.operations = s.createSyncOperations(images)
+	s.operations = s.createSyncOperations(images, daemon)
+
+	// Check the batch fits before pulling anything
+	s.operations, err = s.preflight(ctx, s.operations, daemon)
+	if err != nil {
+		_ = s.engine.Close()
+		return err
+	}
+	s.statistics.TotalImages = len(s.operations)
+
+	// Some registries need repositories to exist before a push
+	s.ensureRepositories(ctx)
 
 	// Choose strategy based on configuration
 	var strategy strategies.SyncStrategy
@@ -113,21 +374,42 @@ func (s *SyncerV2) Run(ctx context.Context) error {
 
 	log.Info().
 		Str("strategy", strategy.Name()).
+		Str("transport", s.engine.Name()).
 		Int("operations", len(s.operations)).
 		Msg("Executing sync with strategy")
 
 	// Execute sync operations using selected strategy
+	stopThroughput := s.recordThroughput(throughputInterval)
 	results, err := strategy.Execute(ctx, s.operations)
+	stopThroughput()
 	if err != nil {
 		log.Error().Err(err).Msg("Error during synchronization execution")
 		// Continue to process results even if there was an error
 	}
 
-	// Store results
+	// Store results, with the failures the registry recognizes typed
+	s.classifyErrors(results)
 	s.results = results
 
+	// Free the disk space left behind by the pulls
+	if s.config.PruneDangling && s.config.Transport != transfer.TransportRegistry && !s.config.DryRun {
+		s.pruneDangling(ctx)
+	}
+
+	// Finish archives written during the run
+	if err := s.engine.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to finish archives")
+		return errors.NewIOError("sync", "failed to finish archives", err)
+	}
+
 	// Calculate statistics
 	s.calculateStatistics(results, time.Since(startTime))
+	if s.blobCache != nil {
+		cacheStats := s.blobCache.Stats()
+		s.statistics.CacheHits = cacheStats.Hits
+		s.statistics.CacheMisses = cacheStats.Misses
+		s.metrics.RecordBlobCache(cacheStats.Hits, cacheStats.Misses, cacheStats.Size)
+	}
 
 	// Generate output file
 	if err := s.generateOutput(); err != nil {
@@ -140,6 +422,12 @@ func (s *SyncerV2) Run(ctx context.Context) error {
 		Int("successful", s.statistics.Successful).
 		Int("failed", s.statistics.Failed).
 		Int("skipped", s.statistics.Skipped).
+		Int("mounted_blobs", s.statistics.MountedBlobs).
+		Int("verified", s.statistics.Verified).
+		Int("mismatched", s.statistics.Mismatched).
+		Int("quota_exceeded", s.statistics.QuotaExceeded).
+		Int64("cache_hits", s.statistics.CacheHits).
+		Int64("cache_misses", s.statistics.CacheMisses).
 		Dur("total_duration", s.statistics.TotalDuration).
 		Str("correlation_id", s.correlationID).
 		Msg("Image synchronization completed")
@@ -147,10 +435,33 @@ func (s *SyncerV2) Run(ctx context.Context) error {
 	return nil
 }
 
+// pruneDangling prunes dangling images from the local daemon. The images are
+// synced by now, so a failed prune is only logged.
+func (s *SyncerV2) pruneDangling(ctx context.Context) {
+	pruner, ok := s.dockerClient.(docker.ImagePruner)
+	if !ok {
+		log.Warn().Msg("The Docker client can't prune dangling images")
+		return
+	}
+
+	report, err := pruner.PruneDanglingImages(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to prune dangling images")
+		return
+	}
+
+	s.statistics.PrunedImages = report.ImagesDeleted
+	s.statistics.SpaceReclaimed = report.SpaceReclaimed
+	log.Info().
+		Int("images", report.ImagesDeleted).
+		Int64("space_reclaimed", report.SpaceReclaimed).
+		Msg("Pruned dangling images")
+}
+
 // parseContent parses the JSON content to get the list of images
-func (s *SyncerV2) parseContent() ([]string, error) {
+func (s *SyncerV2) parseContent() ([]contentEntry, error) {
 	var hubMirrors struct {
-		Content []string `json:"hubsync"`
+		Content []contentEntry `json:"hubsync"`
 	}
 
 	if err := json.Unmarshal([]byte(s.config.Content), &hubMirrors); err != nil {
@@ -162,31 +473,89 @@ func (s *SyncerV2) parseContent() ([]string, error) {
 			len(hubMirrors.Content), s.config.MaxContent)
 	}
 
+	for _, entry := range hubMirrors.Content {
+		if _, err := oci.ParsePlatforms(entry.Platforms); err != nil {
+			return nil, fmt.Errorf("invalid platforms for %s: %w", entry.Image, err)
+		}
+	}
+
 	return hubMirrors.Content, nil
 }
 
-// createSyncOperations converts image names to sync operations
-func (s *SyncerV2) createSyncOperations(images []string) []*strategies.SyncOperation {
+// expandArchiveSources replaces every archive source without an image name,
+// e.g. docker-archive:/mnt/images.tar, with one entry per image it holds
+func (s *SyncerV2) expandArchiveSources(images []contentEntry) ([]contentEntry, error) {
+	expanded := make([]contentEntry, 0, len(images))
+
+	for _, entry := range images {
+		loc, ok := archive.ParseLocation(entry.Image)
+		if !ok || loc.Ref != "" {
+			expanded = append(expanded, entry)
+			continue
+		}
+
+		lister, ok := s.engine.(transfer.ArchiveLister)
+		if !ok {
+			return nil, fmt.Errorf("transport %s cannot read %s", s.engine.Name(), entry.Image)
+		}
+		names, err := lister.ListArchive(entry.Image)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			log.Warn().Str("source", entry.Image).Msg("Archive source holds no named images")
+		}
+
+		for _, name := range names {
+			image := entry
+			image.Image = loc.WithRef(name).String()
+			expanded = append(expanded, image)
+		}
+	}
+
+	return expanded, nil
+}
+
+// createSyncOperations converts image names to sync operations. Targets are
+// not validated when layers are converted, the converted digests can't be
+// predicted.
+func (s *SyncerV2) createSyncOperations(images []contentEntry, daemon *docker.DaemonInfo) []*strategies.SyncOperation {
 	operations := make([]*strategies.SyncOperation, 0, len(images))
+	converting := s.config.ConvertLayers != "" && s.config.Transport == transfer.TransportRegistry
 
-	for _, imageName := range images {
-		if imageName == "" {
+	for _, entry := range images {
+		if entry.Image == "" {
 			// Skip empty image names
 			s.statistics.Skipped++
 			continue
 		}
 
+		// Per-image repository overrides the global target
+		repository := s.config.Repository
+		if entry.Repository != "" {
+			repository = entry.Repository
+		}
+
 		// Generate source and target image references
-		sourceRef, targetRef := s.generateImageReferences(imageName)
+		sourceRef, targetRef := s.generateImageReferences(entry.Image, repository)
+
+		// Per-image platforms override the global filter
+		sourceRef.Platforms = s.config.Platforms
+		if entry.Platforms != nil {
+			sourceRef.Platforms = entry.Platforms
+		}
 
 		// Create sync operation
 		operation := &strategies.SyncOperation{
 			Source:      sourceRef,
 			Target:      targetRef,
-			ValidateDst: !s.config.Force, // Skip validation if force is enabled
+			ValidateDst: !s.config.Force && !converting, // Skip validation if force is enabled or layers are converted
 			Force:       s.config.Force,
 			DryRun:      s.config.DryRun,
 		}
+		if daemon != nil && !archive.IsLocation(sourceRef.FullName) && !archive.IsLocation(targetRef.FullName) {
+			operation.Platform = &daemon.Platform
+		}
 
 		operations = append(operations, operation)
 	}
@@ -195,7 +564,10 @@ func (s *SyncerV2) createSyncOperations(images []string) []*strategies.SyncOpera
 }
 
 // generateImageReferences converts an image name to source and target references
-func (s *SyncerV2) generateImageReferences(image string) (*docker.ImageReference, *docker.ImageReference) {
+// in repository. Sources may be pinned with a digest, as repo@sha256:... or
+// repo:tag@sha256:..., and repository may be an oci: or docker-archive: location,
+// in which case the image is named namespace/image:tag inside the archive.
+func (s *SyncerV2) generateImageReferences(image, repository string) (*docker.ImageReference, *docker.ImageReference) {
 	// Save the original input
 	originalImage := image
 
@@ -212,24 +584,50 @@ func (s *SyncerV2) generateImageReferences(image string) (*docker.ImageReference
 		}
 	}
 
-	// Ensure source has a tag
-	if !strings.Contains(image, ":") {
-		image = image + ":latest"
+	// Archive sources name the image after the location,
+	// e.g. oci:/mnt/export:mirror/nginx:latest
+	sourceLoc, fromArchive := archive.ParseLocation(image)
+	if fromArchive {
+		image = sourceLoc.Ref
 	}
 
-	// Parse source image reference
-	sourceParts := strings.Split(image, ":")
-	sourceImage := sourceParts[0]
-	sourceTag := "latest"
-	if len(sourceParts) > 1 {
-		sourceTag = sourceParts[1]
+	// Split off a pinned digest
+	var sourceDigest string
+	if idx := strings.Index(image, "@"); idx >= 0 {
+		sourceDigest = image[idx+1:]
+		image = image[:idx]
+	}
+
+	// Parse source image reference, only digest-pinned sources may omit the tag
+	sourceImage, sourceTag := splitTag(image)
+	if sourceTag == "" && sourceDigest == "" {
+		sourceTag = "latest"
+	}
+
+	sourceFullName := sourceImage
+	if sourceTag != "" {
+		sourceFullName += ":" + sourceTag
+	}
+	if sourceDigest != "" {
+		sourceFullName += "@" + sourceDigest
 	}
 
 	// Create source reference
 	sourceRef := &docker.ImageReference{
-		FullName: image,
+		FullName: sourceFullName,
 		Name:     sourceImage,
 		Tag:      sourceTag,
+		Digest:   sourceDigest,
+	}
+	if fromArchive {
+		sourceRef.FullName = sourceLoc.WithRef(sourceFullName).String()
+		sourceRef.Name = sourceLoc.WithRef(sourceImage).String()
+	}
+
+	// The target is always pushed by tag, digest-only sources land on latest
+	targetTag := sourceTag
+	if targetTag == "" {
+		targetTag = "latest"
 	}
 
 	// Build target reference
@@ -243,18 +641,29 @@ func (s *SyncerV2) generateImageReferences(image string) (*docker.ImageReference
 		// Use custom name with source tag
 		targetFullName = customName
 		if !strings.Contains(targetFullName, ":") {
-			targetFullName = targetFullName + ":" + sourceTag
+			targetFullName = targetFullName + ":" + targetTag
 		}
 	} else if isTaggedWithVersion {
 		// Special case: when using version tags, keep original structure
-		targetFullName = image
+		targetFullName = sourceImage + ":" + targetTag
 	} else {
 		// Use source name
-		targetFullName = image
+		targetFullName = sourceImage + ":" + targetTag
 	}
 
 	// Add repository and namespace if needed
-	if s.config.Repository == "" {
+	if loc, ok := archive.ParseLocation(repository); ok {
+		// Name the image inside the archive as it would be on Docker Hub
+		imageName := targetFullName
+		if strings.Contains(targetFullName, "/") {
+			parts := strings.Split(targetFullName, "/")
+			imageName = parts[len(parts)-1]
+		}
+		if s.config.Namespace != "" {
+			imageName = s.config.Namespace + "/" + imageName
+		}
+		targetFullName = loc.WithRef(imageName).String()
+	} else if repository == "" {
 		// No repository specified, use Docker Hub format
 		if !strings.HasPrefix(targetFullName, s.config.Namespace+"/") {
 			// Extract image name without path
@@ -273,21 +682,24 @@ func (s *SyncerV2) generateImageReferences(image string) (*docker.ImageReference
 			parts := strings.Split(targetFullName, "/")
 			imageName = parts[len(parts)-1]
 		}
-		targetFullName = s.config.Repository + "/" + s.config.Namespace + "/" + imageName
+		// The repository may already hold the whole path, e.g. an Artifact
+		// Registry LOCATION-docker.pkg.dev/PROJECT/REPOSITORY
+		targetFullName = repository + "/" + imageName
+		if s.config.Namespace != "" {
+			targetFullName = repository + "/" + s.config.Namespace + "/" + imageName
+		}
 	}
 
 	// Parse target image reference
-	targetParts := strings.Split(targetFullName, ":")
-	targetImage := targetParts[0]
-	targetTag := "latest"
-	if len(targetParts) > 1 {
-		targetTag = targetParts[1]
+	targetImage, parsedTag := splitTag(targetFullName)
+	if parsedTag != "" {
+		targetTag = parsedTag
 	}
 
 	// Create target reference
 	targetRef := &docker.ImageReference{
 		FullName:   targetFullName,
-		Repository: s.config.Repository,
+		Repository: repository,
 		Name:       targetImage,
 		Tag:        targetTag,
 	}
@@ -295,15 +707,50 @@ func (s *SyncerV2) generateImageReferences(image string) (*docker.ImageReference
 	return sourceRef, targetRef
 }
 
+// splitTag splits an image name into repository and tag. A tag separator is a
+// colon after the last slash, so registry ports are not mistaken for tags.
+func splitTag(image string) (string, string) {
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		return image[:idx], image[idx+1:]
+	}
+	return image, ""
+}
+
 // calculateStatistics computes statistics from sync results
 func (s *SyncerV2) calculateStatistics(results []*strategies.SyncResult, totalDuration time.Duration) {
 	s.statistics.TotalDuration = totalDuration
 
 	for _, result := range results {
-		if result.Success {
+		status := "success"
+		switch {
+		case result.Status == strategies.StatusSkipped:
+			s.statistics.Skipped++
+			status = "skipped"
+		case result.Success:
 			s.statistics.Successful++
-		} else {
+		default:
 			s.statistics.Failed++
+			status = "failed"
+		}
+		s.statistics.MountedBlobs += result.BlobsMounted
+		s.metrics.RecordSyncOperation(result.Operation.Source.FullName, result.Operation.Target.FullName, status)
+		if result.Success && result.ImageSize > 0 {
+			s.metrics.RecordImageSize(result.Operation.Target.FullName, result.ImageSize)
+		}
+
+		// Record the outcome of the post-push digest check
+		switch {
+		case result.ChecksumOK:
+			s.statistics.Verified++
+			s.metrics.RecordDigestVerification("verified")
+		case errors.IsVerificationError(result.Error):
+			s.statistics.Mismatched++
+			s.metrics.RecordDigestVerification("mismatch")
+		case status == "success":
+			s.metrics.RecordDigestVerification("unverified")
+		}
+		if errors.IsQuotaError(result.Error) {
+			s.statistics.QuotaExceeded++
 		}
 
 		// Update processed count
@@ -324,19 +771,65 @@ func (s *SyncerV2) generateOutput() error {
 
 	// Create template for output
 	var loginCmd string
-	if s.config.Repository != "" {
+	if s.config.Repository != "" && !archive.IsLocation(s.config.Repository) {
 		loginCmd = fmt.Sprintf("# If your repository is private, please login first...\n# docker login %s --username={your username}\n\n", s.config.Repository)
 	}
 
-	tmpl, err := template.New("pull_images").Parse(loginCmd +
+	funcs := template.FuncMap{"join": strings.Join, "archive": archive.IsLocation, "size": config.FormatByteSize}
+
+	tmpl, err := template.New("pull_images").Funcs(funcs).Parse(loginCmd +
 		`# HubSync completed at {{ .Timestamp }}
 # Summary: {{ .Stats.Successful }} successful, {{ .Stats.Failed }} failed, {{ .Stats.Skipped }} skipped
 # Total duration: {{ .Stats.TotalDuration }}
+{{- if gt .Stats.MountedBlobs 0 }}
+# Mounted blobs: {{ .Stats.MountedBlobs }}
+{{- end }}
+{{- if or (gt .Stats.CacheHits 0) (gt .Stats.CacheMisses 0) }}
+# Blob cache: {{ .Stats.CacheHits }} hits, {{ .Stats.CacheMisses }} misses
+{{- end }}
+{{- if gt .Stats.PrunedImages 0 }}
+# Pruned dangling images: {{ .Stats.PrunedImages }} ({{ .Stats.SpaceReclaimed }} bytes reclaimed)
+{{- end }}
+{{- with .Preflight }}
+# Estimated transfer size: {{ size .TotalSize }}{{ if .Unknown }} ({{ .Unknown }} images of unknown size){{ end }}{{ if .Limit }}, limit {{ size .Limit }} ({{ .LimitedBy }}){{ end }}
+{{- range .Trimmed }}
+# Trimmed by the size check: {{ .Source }} ({{ size .Size }})
+{{- end }}
+{{- end }}
+{{- if or (gt .Stats.Verified 0) (gt .Stats.Mismatched 0) }}
+# Digest verification: {{ .Stats.Verified }} verified, {{ .Stats.Mismatched }} mismatched
+{{- end }}
+{{- if gt .Stats.QuotaExceeded 0 }}
+# Storage quota exceeded: {{ .Stats.QuotaExceeded }} images were refused by the target registry
+{{- end }}
 # Correlation ID: {{ .CorrelationID }}
 
 {{- range .Results -}}
 {{- if .Success }}
-docker pull {{ .Operation.Target.FullName }} # (from {{ .Operation.Source.FullName }} in {{ .Duration }}ms)
+{{- if archive .Operation.Target.FullName }}
+# Exported {{ .Operation.Target.FullName }} (from {{ .Operation.Source.FullName }} in {{ .Duration }}ms{{ if .ChecksumOK }}, digest verified{{ end }})
+{{- else if eq .Status "skipped" }}
+docker pull {{ .Operation.Target.FullName }} # (up to date with {{ .Operation.Source.FullName }}, skipped)
+{{- else if .ArtifactType }}
+# Mirrored {{ .Operation.Target.FullName }} (from {{ .Operation.Source.FullName }} in {{ .Duration }}ms{{ if .ChecksumOK }}, digest verified{{ end }})
+{{- else }}
+docker pull {{ .Operation.Target.FullName }} # (from {{ .Operation.Source.FullName }} in {{ .Duration }}ms{{ if .ChecksumOK }}, digest verified{{ end }})
+{{- end }}
+{{- if and .TargetDigest (not .ArtifactType) (not (archive .Operation.Target.FullName)) }}
+docker pull {{ .Operation.Target.Name }}@{{ .TargetDigest }}
+{{- end }}
+{{- if .ArtifactType }}
+# Artifact type: {{ .ArtifactType }}
+{{- end }}
+{{- if .FilteredPlatforms }}
+# Platforms filtered out: {{ join .FilteredPlatforms ", " }}
+{{- end }}
+{{- range .Conversions }}
+#   converted {{ .SourceDigest }} -> {{ .TargetDigest }} ({{ .MediaType }})
+{{- end }}
+{{- range .Artifacts }}
+#   {{ .Kind }} {{ .Reference }}{{ if .ArtifactType }} ({{ .ArtifactType }}){{ end }}
+{{- end }}
 {{ end }}
 {{- end -}}
 
@@ -363,11 +856,13 @@ docker pull {{ .Operation.Target.FullName }} # (from {{ .Operation.Source.FullNa
 	data := struct {
 		Results       []*strategies.SyncResult
 		Stats         *SyncStatisticsV2
+		Preflight     *PreflightReport
 		Timestamp     string
 		CorrelationID string
 	}{
 		Results:       s.results,
 		Stats:         s.statistics,
+		Preflight:     s.preflightReport,
 		Timestamp:     time.Now().Format(time.RFC3339),
 		CorrelationID: s.correlationID,
 	}
@@ -0,0 +1,166 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/yugasun/hubsync/pkg/compression"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// LayerConversion records a layer recompressed while copying
+type LayerConversion struct {
+	SourceDigest string // Digest of the layer in the source
+	TargetDigest string // Digest of the converted layer pushed to the target
+	MediaType    string // Media type of the converted layer
+}
+
+// convertLayers recompresses the layers of an image manifest that don't use
+// the target compression, pushing each converted layer, and rewrites the
+// manifest to reference them. It returns the manifest to push and the
+// digests of the layers already pushed.
+func (e *RegistryEngine) convertLayers(ctx context.Context, src source, srcRef oci.Reference, dst destination, dstRef oci.Reference, manifest *oci.Manifest, data []byte, desc oci.Descriptor, report *Report) ([]byte, oci.Descriptor, map[string]bool, error) {
+	converted := make(map[string]bool)
+	for i, layer := range manifest.Layers {
+		from := compression.Detect(layer.MediaType)
+		if from == "" || from == e.conversion || len(layer.URLs) > 0 {
+			continue
+		}
+
+		target, err := e.convertLayer(ctx, src, srcRef, dst, dstRef, layer, from, report)
+		if err != nil {
+			report.logf("Layer conversion failed: %v", err)
+			if errors.IsVerificationError(err) {
+				// Keep the dedicated type so corrupt source layers are reported as such
+				return nil, desc, nil, err
+			}
+			return nil, desc, nil, errors.NewOperationError("transfer", fmt.Sprintf("failed to convert layer %s", layer.Digest), err)
+		}
+		manifest.Layers[i] = target
+		converted[target.Digest] = true
+		report.Conversions = append(report.Conversions, LayerConversion{
+			SourceDigest: layer.Digest,
+			TargetDigest: target.Digest,
+			MediaType:    target.MediaType,
+		})
+	}
+	if len(converted) == 0 {
+		return data, desc, converted, nil
+	}
+
+	// Docker manifests have no zstd layer type, converted images are OCI images
+	manifest.MediaType = oci.MediaTypeOCIManifest
+	if manifest.Config.MediaType == oci.MediaTypeDockerConfig {
+		manifest.Config.MediaType = oci.MediaTypeOCIConfig
+	}
+	for i := range manifest.Layers {
+		manifest.Layers[i].MediaType = compression.OCILayerMediaType(manifest.Layers[i].MediaType)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, desc, nil, errors.NewOperationError("transfer", "failed to encode converted manifest", err)
+	}
+	report.logf("Rewrote manifest %s with %d converted layers", desc.Digest, len(converted))
+	return data, oci.Descriptor{
+		MediaType: oci.MediaTypeOCIManifest,
+		Digest:    oci.ComputeDigest(data),
+		Size:      int64(len(data)),
+	}, converted, nil
+}
+
+// convertLayer recompresses a single layer through a temporary file, which
+// gives its digest before the upload starts, and pushes it to the target
+func (e *RegistryEngine) convertLayer(ctx context.Context, src source, srcRef oci.Reference, dst destination, dstRef oci.Reference, layer oci.Descriptor, from string, report *Report) (oci.Descriptor, error) {
+	// Layers shared between images are converted once per run
+	e.mutex.Lock()
+	target, ok := e.converted[layer.Digest]
+	e.mutex.Unlock()
+	if ok {
+		exists, err := dst.HasBlob(ctx, dstRef, target.Digest)
+		if err != nil {
+			return target, err
+		}
+		if exists {
+			report.logf("Skipping existing converted blob %s (%d bytes)", target.Digest, target.Size)
+			report.ImageSize += target.Size
+			report.BytesSkipped += target.Size
+			return target, nil
+		}
+	}
+
+	content, _, err := src.GetBlob(ctx, srcRef, layer.Digest)
+	if err != nil {
+		return target, err
+	}
+	defer content.Close()
+
+	file, err := os.CreateTemp("", "hubsync-convert-*")
+	if err != nil {
+		return target, errors.NewIOError("transfer", "failed to create conversion file", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// The source layer is hashed as it is read and checked once it is done
+	sourceHash := sha256.New()
+	reader := io.TeeReader(e.limit(ctx, content, src, srcRef, nil, oci.Reference{}), sourceHash)
+	hash := sha256.New()
+	if err := compression.Recompress(io.MultiWriter(file, hash), reader, from, e.conversion); err != nil {
+		return target, err
+	}
+	// The decompressor may stop before the end of the blob
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return target, errors.NewIOError("transfer", "failed to read source layer", err)
+	}
+	if actual := "sha256:" + hex.EncodeToString(sourceHash.Sum(nil)); strings.HasPrefix(layer.Digest, "sha256:") && actual != layer.Digest {
+		return target, errors.NewVerificationError("transfer",
+			fmt.Sprintf("source layer digest %s does not match %s", actual, layer.Digest), nil).
+			WithDetail("expected", layer.Digest).
+			WithDetail("actual", actual)
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return target, errors.NewIOError("transfer", "failed to read conversion file", err)
+	}
+
+	target = oci.Descriptor{
+		MediaType:   compression.LayerMediaType(e.conversion),
+		Digest:      "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		Size:        size,
+		Annotations: layer.Annotations,
+	}
+	report.logf("Converted layer %s from %s to %s: %s (%d -> %d bytes)",
+		layer.Digest, from, e.conversion, target.Digest, layer.Size, target.Size)
+
+	e.mutex.Lock()
+	e.converted[layer.Digest] = target
+	e.mutex.Unlock()
+
+	report.ImageSize += target.Size
+	exists, err := dst.HasBlob(ctx, dstRef, target.Digest)
+	if err != nil {
+		return target, err
+	}
+	if exists {
+		report.logf("Skipping existing converted blob %s (%d bytes)", target.Digest, target.Size)
+		report.BytesSkipped += target.Size
+		return target, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return target, errors.NewIOError("transfer", "failed to rewind conversion file", err)
+	}
+	if err := dst.PushBlob(ctx, dstRef, target, e.limit(ctx, file, nil, oci.Reference{}, dst, dstRef)); err != nil {
+		return target, err
+	}
+	report.BytesMoved += target.Size
+	return target, nil
+}
@@ -0,0 +1,253 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/registry"
+)
+
+// DaemonEngine transfers images by pulling, tagging and pushing through the
+// local Docker daemon
+type DaemonEngine struct {
+	dockerClient docker.ClientInterface
+
+	// registryClient reads pushed digests back from the target registry,
+	// nil skips the verification
+	registryClient registry.RegistryInterface
+
+	// cleanup removes the local source and target tags after a push
+	cleanup bool
+}
+
+// Ensure DaemonEngine implements Engine
+var _ Engine = (*DaemonEngine)(nil)
+
+// NewDaemonEngine creates a new daemon-backed transfer engine. Pushes are
+// verified against the target registry through registryClient when it is
+// not nil.
+func NewDaemonEngine(dockerClient docker.ClientInterface, registryClient registry.RegistryInterface) *DaemonEngine {
+	return &DaemonEngine{
+		dockerClient:   dockerClient,
+		registryClient: registryClient,
+	}
+}
+
+// SetCleanup makes the engine remove the source and target tags from the
+// local daemon after a successful push. Failed transfers keep their images
+// for debugging.
+func (e *DaemonEngine) SetCleanup(enabled bool) {
+	e.cleanup = enabled
+}
+
+// Name returns the name of the transport
+func (e *DaemonEngine) Name() string {
+	return TransportDaemon
+}
+
+// Close implements Engine, the daemon keeps nothing open
+func (e *DaemonEngine) Close() error {
+	return nil
+}
+
+// Transfer pulls the source image, tags it with the target name and pushes it
+func (e *DaemonEngine) Transfer(ctx context.Context, source, target *docker.ImageReference) (*Report, error) {
+	report := &Report{SourceDigest: source.Digest}
+
+	// The daemon only ever pulls the platform it runs on
+	if len(source.Platforms) > 0 {
+		report.logf("Platform filter %s is only applied by the registry transport", strings.Join(source.Platforms, ","))
+	}
+
+	// Step 1: Pull the source image
+	report.logf("Pulling source image: %s", source.FullName)
+	pulled, err := e.dockerClient.PullImage(ctx, source.FullName)
+	if err != nil {
+		report.logf("Pull failed: %v", err)
+		return report, errors.NewOperationError("transfer", "failed to pull source image", err)
+	}
+	logLayers(report, "Pulled", pulled)
+	if report.SourceDigest == "" {
+		report.SourceDigest = pulled.Digest
+	}
+
+	// Step 2: Tag the image with the target name
+	report.logf("Tagging image from %s to %s", source.FullName, target.FullName)
+	if err := e.dockerClient.TagImage(ctx, source.FullName, target.FullName); err != nil {
+		report.logf("Tag failed: %v", err)
+		return report, errors.NewOperationError("transfer", "failed to tag image", err)
+	}
+
+	// Step 3: Push the tagged image to the target registry
+	report.logf("Pushing target image: %s", target.FullName)
+	pushed, err := e.dockerClient.PushImage(ctx, target.FullName)
+	if err != nil {
+		report.logf("Push failed: %v", err)
+		return report, errors.NewOperationError("transfer", "failed to push target image", err)
+	}
+	logLayers(report, "Pushed", pushed)
+	report.TargetDigest = pushed.Digest
+
+	// Step 4: Compare the target registry with the source
+	if err := e.verify(ctx, source, target, report.SourceDigest, pushed.Digest, report); err != nil {
+		report.logf("Verification failed: %v", err)
+		return report, err
+	}
+
+	// Layers the daemon already had report no size when pulled, fall back
+	// to the sizes the push reported
+	report.ImageSize = pulled.Size()
+	if report.ImageSize == 0 {
+		report.ImageSize = pushed.Size()
+	}
+	report.BytesMoved = pushed.BytesMoved()
+
+	if e.cleanup {
+		e.removeLocal(ctx, report, target.FullName, source.FullName)
+	}
+
+	return report, nil
+}
+
+// verify resolves the digest the target registry holds for the pushed tag
+// and checks that it is the digest of the source manifest the daemon pulled.
+// Without a known source digest it falls back to the digest the daemon
+// reported for the push, which a pinned source doesn't accept.
+func (e *DaemonEngine) verify(ctx context.Context, source, target *docker.ImageReference, sourceDigest, pushedDigest string, report *Report) error {
+	if e.registryClient == nil {
+		return e.refusePinned(source)
+	}
+
+	expected, err := e.sourcePlatformDigest(ctx, source, sourceDigest, report)
+	if err != nil {
+		return errors.NewOperationError("transfer", "failed to resolve source digest for verification", err)
+	}
+	against := "source"
+	if expected == "" {
+		if err := e.refusePinned(source); err != nil {
+			return err
+		}
+		if pushedDigest == "" {
+			report.logf("Target digest not verified, neither the source nor the push reported a digest")
+			return nil
+		}
+		report.logf("Source digest unknown, verifying against the pushed digest")
+		expected, against = pushedDigest, "pushed"
+	}
+
+	// A pinned source must arrive unchanged, the daemon may push a
+	// re-serialized manifest
+	if source.Digest != "" && pushedDigest != "" && pushedDigest != expected {
+		return errors.NewVerificationError("transfer",
+			fmt.Sprintf("pushed digest %s does not match pinned source digest %s", pushedDigest, expected), nil).
+			WithDetail("expected", expected).
+			WithDetail("actual", pushedDigest)
+	}
+
+	report.logf("Verifying target manifest: %s", target.FullName)
+	digest, exists, err := e.registryClient.GetImageDigest(ctx, target)
+	if err != nil {
+		return errors.NewOperationError("transfer", "failed to resolve target digest for verification", err)
+	}
+	if !exists {
+		return errors.NewVerificationError("transfer",
+			fmt.Sprintf("target %s is missing after the push", target.FullName), nil).
+			WithDetail("expected", expected)
+	}
+	if digest != expected {
+		return errors.NewVerificationError("transfer",
+			fmt.Sprintf("target digest %s does not match %s digest %s", digest, against, expected), nil).
+			WithDetail("expected", expected).
+			WithDetail("actual", digest)
+	}
+
+	report.ChecksumOK = true
+	report.logf("Verified target digest %s", digest)
+	return nil
+}
+
+// refusePinned fails a pinned source whose digest can't be checked, the
+// push would otherwise pass for the pinned image unverified
+func (e *DaemonEngine) refusePinned(source *docker.ImageReference) error {
+	if source.Digest == "" {
+		return nil
+	}
+	return errors.NewVerificationError("transfer",
+		fmt.Sprintf("pinned source %s can't be verified through the daemon, use the registry transport", source.FullName), nil).
+		WithDetail("expected", source.Digest)
+}
+
+// sourcePlatformDigest returns the digest of the source manifest the daemon
+// pulled: the manifest for the daemon's platform when the source digest
+// names an index, the source digest itself otherwise. It is empty when the
+// registry client can't read the source manifest or the daemon platform is
+// unknown.
+func (e *DaemonEngine) sourcePlatformDigest(ctx context.Context, source *docker.ImageReference, sourceDigest string, report *Report) (string, error) {
+	fetcher, ok := e.registryClient.(registry.ManifestFetcher)
+	if !ok || sourceDigest == "" {
+		return "", nil
+	}
+
+	// Read the manifest by digest, the tag may have moved since the pull
+	ref, err := oci.ParseReference(source.FullName)
+	if err != nil {
+		return "", err
+	}
+	ref.Tag, ref.Digest = "", sourceDigest
+	data, err := fetcher.FetchManifest(ctx, &docker.ImageReference{FullName: ref.String(), Digest: sourceDigest})
+	if err != nil {
+		return "", err
+	}
+	if !oci.IsIndexMediaType(oci.DetectMediaType(data)) {
+		return sourceDigest, nil
+	}
+
+	inspector, ok := e.dockerClient.(docker.DaemonInspector)
+	if !ok {
+		return "", nil
+	}
+	daemon, err := inspector.DaemonInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	index, err := oci.ParseIndex(data)
+	if err != nil {
+		return "", err
+	}
+	for _, child := range index.Manifests {
+		if child.Platform.Matches(daemon.Platform) {
+			report.logf("Source manifest for platform %s is %s", daemon.Platform.String(), child.Digest)
+			return child.Digest, nil
+		}
+	}
+	return "", errors.NewVerificationError("transfer",
+		fmt.Sprintf("source index %s has no manifest for platform %s", sourceDigest, daemon.Platform.String()), nil)
+}
+
+// removeLocal removes image tags from the local daemon. The push already
+// succeeded, so a failed removal is only logged.
+func (e *DaemonEngine) removeLocal(ctx context.Context, report *Report, images ...string) {
+	for _, image := range images {
+		if err := e.dockerClient.RemoveImage(ctx, image); err != nil {
+			report.logf("Failed to remove local image %s: %v", image, err)
+			log.Warn().Err(err).Str("image", image).Msg("Failed to remove local image")
+			continue
+		}
+		report.logf("Removed local image %s", image)
+	}
+}
+
+// logLayers adds the outcome of every layer of a pull or push to the report
+func logLayers(report *Report, action string, progress *docker.Progress) {
+	for _, layer := range progress.Layers {
+		report.logf("Layer %s: %s (%d of %d bytes)", layer.ID, layer.Status, layer.Moved, layer.Size)
+	}
+	report.logf("%s %s", action, progress)
+}
@@ -0,0 +1,116 @@
+package transfer
+
+import (
+	"context"
+	"io"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// destination is where the registry engine writes manifests and blobs
+type destination interface {
+	// HasBlob reports whether the destination already holds a blob
+	HasBlob(ctx context.Context, ref oci.Reference, digest string) (bool, error)
+
+	// PushBlob stores a blob
+	PushBlob(ctx context.Context, ref oci.Reference, desc oci.Descriptor, content io.Reader) error
+
+	// PutManifest stores a manifest under the reference's tag or digest
+	PutManifest(ctx context.Context, ref oci.Reference, mediaType string, data []byte) (string, error)
+
+	// GetManifest reads a stored manifest back
+	GetManifest(ctx context.Context, ref oci.Reference) ([]byte, oci.Descriptor, error)
+
+	// HeadManifest resolves a stored manifest without reading it
+	HeadManifest(ctx context.Context, ref oci.Reference) (oci.Descriptor, bool, error)
+}
+
+// registryDestination writes to a registry over the distribution API
+type registryDestination struct {
+	*oci.Client
+}
+
+// HasBlob checks the blob with push scope, so a single token covers the copy
+func (d registryDestination) HasBlob(ctx context.Context, ref oci.Reference, digest string) (bool, error) {
+	return d.CheckBlobForPush(ctx, ref, digest)
+}
+
+// layoutDestination writes to an image layout, or to the staging layout of
+// a docker-archive tarball. Tagged manifests are named repository:tag.
+type layoutDestination struct {
+	layout *archive.Layout
+
+	// singlePlatform is set for docker-archive, which can't hold indexes
+	singlePlatform bool
+
+	// shipped holds the blobs of base bundles, left out of delta bundles
+	shipped map[string]bool
+}
+
+// layoutRef returns the name of a reference inside a layout, or its digest
+// when it has no tag
+func layoutRef(ref oci.Reference) string {
+	if ref.Digest != "" {
+		return ref.Digest
+	}
+	return ref.Repository + ":" + ref.Tag
+}
+
+// HasBlob implements destination
+func (d layoutDestination) HasBlob(_ context.Context, _ oci.Reference, digest string) (bool, error) {
+	return d.layout.HasBlob(digest) || d.shipped[digest], nil
+}
+
+// PushBlob implements destination
+func (d layoutDestination) PushBlob(_ context.Context, _ oci.Reference, desc oci.Descriptor, content io.Reader) error {
+	return d.layout.WriteBlob(desc, content)
+}
+
+// PutManifest implements destination
+func (d layoutDestination) PutManifest(_ context.Context, ref oci.Reference, mediaType string, data []byte) (string, error) {
+	name := ""
+	if ref.Digest == "" {
+		name = layoutRef(ref)
+	}
+	return d.layout.PutManifest(name, mediaType, data)
+}
+
+// GetManifest implements destination
+func (d layoutDestination) GetManifest(_ context.Context, ref oci.Reference) ([]byte, oci.Descriptor, error) {
+	return d.layout.GetManifest(layoutRef(ref))
+}
+
+// HeadManifest implements destination
+func (d layoutDestination) HeadManifest(_ context.Context, ref oci.Reference) (oci.Descriptor, bool, error) {
+	desc, ok := d.layout.Resolve(layoutRef(ref))
+	return desc, ok, nil
+}
+
+// bundleRecorder writes the bundle record of a layout once it is complete
+type bundleRecorder struct {
+	layout  *archive.Layout
+	shipped map[string]bool
+}
+
+// Close implements io.Closer
+func (r bundleRecorder) Close() error {
+	shipped := make([]string, 0, len(r.shipped))
+	for digest := range r.shipped {
+		shipped = append(shipped, digest)
+	}
+
+	record, err := r.layout.WriteBundleRecord(shipped)
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("bundle", r.layout.Dir()).
+		Int("blobs", len(record.Blobs)).
+		Int("shipped", len(record.Shipped)).
+		Msg("Bundle record written")
+	return nil
+}
@@ -0,0 +1,67 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yugasun/hubsync/pkg/docker"
+)
+
+// Transport names accepted in configuration
+const (
+	// TransportDaemon pulls, tags and pushes through the local Docker daemon
+	TransportDaemon = "daemon"
+
+	// TransportRegistry copies directly between registries over the distribution API
+	TransportRegistry = "registry"
+)
+
+// Engine moves an image from a source reference to a target reference
+type Engine interface {
+	// Transfer copies the source image to the target and reports what was done
+	Transfer(ctx context.Context, source, target *docker.ImageReference) (*Report, error)
+
+	// Name returns the name of the transport
+	Name() string
+
+	// Close finishes any output the engine keeps open across transfers
+	Close() error
+}
+
+// ArchiveLister is implemented by engines that can read on-disk archives
+type ArchiveLister interface {
+	// ListArchive returns the names of the images stored at an archive location
+	ListArchive(location string) ([]string, error)
+}
+
+// Report describes the outcome of a single transfer
+type Report struct {
+	SourceDigest string   // Digest of the source manifest, empty when unknown
+	TargetDigest string   // Digest of the manifest pushed to the target, empty when unknown
+	ChecksumOK   bool     // Whether the pushed manifest was read back and matched what was pushed
+	ImageSize    int64    // Total size of the image content in bytes
+	BytesMoved   int64    // Bytes actually sent to the target
+	BytesSkipped int64    // Bytes already present in the target and not sent
+	BlobsMounted int      // Blobs linked from another repository on the same registry
+	Logs         []string // Human readable steps performed during the transfer
+
+	// FilteredPlatforms lists the platforms dropped from a multi-platform source
+	FilteredPlatforms []string
+
+	// Conversions maps the layers recompressed during the copy to the
+	// layers pushed in their place
+	Conversions []LayerConversion
+
+	// ArtifactType is the type of a source that is an OCI artifact rather
+	// than a container image, e.g. a Helm chart config media type
+	ArtifactType string
+
+	// Artifacts lists the signatures, attestations, SBOMs and referrers
+	// copied alongside the image
+	Artifacts []Artifact
+}
+
+// logf appends a formatted line to the report's logs
+func (r *Report) logf(format string, args ...interface{}) {
+	r.Logs = append(r.Logs, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,181 @@
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// Kinds of artifacts copied alongside an image
+const (
+	ArtifactSignature   = "signature"
+	ArtifactAttestation = "attestation"
+	ArtifactSBOM        = "sbom"
+	ArtifactReferrer    = "referrer"
+)
+
+// cosignKinds maps cosign tag suffixes to artifact kinds
+var cosignKinds = map[string]string{
+	"sig":  ArtifactSignature,
+	"att":  ArtifactAttestation,
+	"sbom": ArtifactSBOM,
+}
+
+// Artifact is a signature, attestation, SBOM or other referrer copied
+// alongside an image
+type Artifact struct {
+	Kind         string // One of the Artifact* kinds
+	Reference    string // Tag or digest the artifact was stored under in the target
+	Digest       string // Digest of the artifact manifest
+	ArtifactType string // Artifact type of OCI referrers, empty for cosign tags
+}
+
+// copyReferrers copies the cosign tags and OCI referrers of the manifest
+// with the given digest from a source registry to the target
+func (e *RegistryEngine) copyReferrers(ctx context.Context, client *oci.Client, srcRef oci.Reference, dst destination, dstRef oci.Reference, digest string, report *Report) error {
+	// Cosign signatures, attestations and SBOMs live under well-known tags
+	for _, suffix := range oci.CosignTagSuffixes {
+		tagSrc := srcRef
+		tagSrc.Tag = oci.CosignTag(digest, suffix)
+		tagSrc.Digest = ""
+
+		data, desc, err := client.GetManifest(ctx, tagSrc)
+		if oci.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return errors.NewOperationError("transfer", fmt.Sprintf("failed to fetch %s", tagSrc.Tag), err)
+		}
+
+		tagDst := dstRef
+		tagDst.Tag = tagSrc.Tag
+		tagDst.Digest = ""
+
+		report.logf("Copying %s %s", cosignKinds[suffix], tagSrc.Tag)
+		if _, err := e.copyManifest(ctx, client, tagSrc, dst, tagDst, data, desc, report); err != nil {
+			return err
+		}
+		report.Artifacts = append(report.Artifacts, Artifact{
+			Kind:      cosignKinds[suffix],
+			Reference: tagSrc.Tag,
+			Digest:    desc.Digest,
+		})
+	}
+
+	referrers, err := e.listReferrers(ctx, client, srcRef, digest)
+	if err != nil {
+		return err
+	}
+	if len(referrers) == 0 {
+		return nil
+	}
+
+	for _, referrer := range referrers {
+		childSrc := srcRef
+		childSrc.Tag = ""
+		childSrc.Digest = referrer.Digest
+
+		data, desc, err := client.GetManifest(ctx, childSrc)
+		if err != nil {
+			return errors.NewOperationError("transfer", fmt.Sprintf("failed to fetch referrer %s", referrer.Digest), err)
+		}
+		if referrer.MediaType != "" {
+			desc.MediaType = referrer.MediaType
+		}
+
+		childDst := dstRef
+		childDst.Tag = ""
+		childDst.Digest = referrer.Digest
+
+		report.logf("Copying referrer %s (%s)", referrer.Digest, referrer.ArtifactType)
+		if _, err := e.copyManifest(ctx, client, childSrc, dst, childDst, data, desc, report); err != nil {
+			return err
+		}
+		report.Artifacts = append(report.Artifacts, Artifact{
+			Kind:         ArtifactReferrer,
+			Reference:    referrer.Digest,
+			Digest:       referrer.Digest,
+			ArtifactType: referrer.ArtifactType,
+		})
+	}
+
+	return e.indexReferrers(ctx, dst, dstRef, digest, referrers, report)
+}
+
+// listReferrers returns the referrers of a digest, through the referrers API
+// or else the tag schema fallback
+func (e *RegistryEngine) listReferrers(ctx context.Context, client *oci.Client, srcRef oci.Reference, digest string) ([]oci.Descriptor, error) {
+	referrers, supported, err := client.Referrers(ctx, srcRef, digest)
+	if err != nil {
+		return nil, errors.NewOperationError("transfer", "failed to list referrers", err)
+	}
+	if supported {
+		return referrers, nil
+	}
+
+	tagRef := srcRef
+	tagRef.Tag = oci.ReferrersTag(digest)
+	tagRef.Digest = ""
+
+	data, _, err := client.GetManifest(ctx, tagRef)
+	if oci.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewOperationError("transfer", "failed to fetch referrers tag", err)
+	}
+	index, err := oci.ParseIndex(data)
+	if err != nil {
+		return nil, errors.NewValidationError("transfer", "invalid referrers tag", err)
+	}
+	return index.Manifests, nil
+}
+
+// indexReferrers maintains the referrers tag schema on targets without the
+// referrers API, so clients can still discover what was copied
+func (e *RegistryEngine) indexReferrers(ctx context.Context, dst destination, dstRef oci.Reference, digest string, referrers []oci.Descriptor, report *Report) error {
+	if rd, ok := dst.(registryDestination); ok {
+		_, supported, err := rd.Referrers(ctx, dstRef, digest)
+		if err != nil {
+			return errors.NewOperationError("transfer", "failed to list target referrers", err)
+		}
+		if supported {
+			return nil
+		}
+	}
+
+	tagRef := dstRef
+	tagRef.Tag = oci.ReferrersTag(digest)
+	tagRef.Digest = ""
+
+	// Keep referrers pushed to the target by others
+	index := oci.Index{SchemaVersion: 2, MediaType: oci.MediaTypeOCIIndex}
+	if existing, _, err := dst.GetManifest(ctx, tagRef); err == nil {
+		if parsed, err := oci.ParseIndex(existing); err == nil {
+			index.Manifests = parsed.Manifests
+		}
+	}
+
+	known := make(map[string]bool, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		known[desc.Digest] = true
+	}
+	for _, desc := range referrers {
+		if !known[desc.Digest] {
+			index.Manifests = append(index.Manifests, desc)
+		}
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return errors.NewOperationError("transfer", "failed to encode referrers tag", err)
+	}
+	report.logf("Updating referrers tag %s", tagRef.Tag)
+	if _, err := dst.PutManifest(ctx, tagRef, oci.MediaTypeOCIIndex, data); err != nil {
+		return errors.NewOperationError("transfer", "failed to push referrers tag", err)
+	}
+	return nil
+}
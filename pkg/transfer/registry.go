@@ -0,0 +1,813 @@
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/bandwidth"
+	"github.com/yugasun/hubsync/pkg/cache"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// RegistryEngine copies images directly between registries using the OCI
+// Distribution API, streaming blobs from source to target without a daemon.
+// Manifest lists and OCI indexes are copied whole, so the target digest
+// matches the source digest unless a platform filter reduces the index.
+// Sources and targets may also be oci: layout directories or docker-archive:
+// tarballs.
+type RegistryEngine struct {
+	client *oci.Client
+	cache  *cache.BlobCache
+
+	mutex    sync.Mutex
+	archives map[string]*openArchive // scheme:path -> archive written this run
+	sources  map[string]*openSource  // scheme:path -> archive read this run
+
+	// Delta bundles, see SetBundle
+	bundle      bool
+	bundleBases []string
+	bundleOnce  sync.Once
+	bundleErr   error
+	shipped     map[string]bool
+	baseLayouts []*archive.Layout
+
+	// referrers copies signatures, attestations, SBOMs and referrers, which
+	// only fail the image when requireReferrers is set
+	referrers        bool
+	requireReferrers bool
+
+	// Layer conversion, see SetConversion
+	conversion string
+	converted  map[string]oci.Descriptor // source layer digest -> converted layer
+
+	// bandwidth limits blob streams from and to registries, nil for none
+	bandwidth *bandwidth.Limits
+}
+
+// openArchive is an on-disk target kept open until the engine is closed
+type openArchive struct {
+	dst    layoutDestination
+	closer io.Closer // packs docker-archive tarballs, nil for layouts
+}
+
+// openSource is an on-disk source kept open until the engine is closed
+type openSource struct {
+	src    layoutSource
+	closer io.Closer // removes unpacked docker-archive tarballs, nil for layouts
+}
+
+// Ensure RegistryEngine implements Engine and ArchiveLister
+var (
+	_ Engine        = (*RegistryEngine)(nil)
+	_ ArchiveLister = (*RegistryEngine)(nil)
+)
+
+// NewRegistryEngine creates a new daemonless transfer engine. Blobs are read
+// from and written to blobCache when it is not nil.
+func NewRegistryEngine(client *oci.Client, blobCache *cache.BlobCache) *RegistryEngine {
+	return &RegistryEngine{
+		client:    client,
+		cache:     blobCache,
+		archives:  make(map[string]*openArchive),
+		sources:   make(map[string]*openSource),
+		converted: make(map[string]oci.Descriptor),
+	}
+}
+
+// Name returns the name of the transport
+func (e *RegistryEngine) Name() string {
+	return TransportRegistry
+}
+
+// SetBundle turns oci: layouts into delta bundles built on top of bases,
+// given as bundle directories or bundle record files. Blobs shipped in a
+// base are left out of oci: targets, which get a bundle record on Close,
+// and blobs missing from oci: sources are read from the base directories.
+func (e *RegistryEngine) SetBundle(bases []string) {
+	e.bundle = true
+	e.bundleBases = bases
+}
+
+// SetReferrers makes the engine copy the cosign signatures, attestations and
+// SBOMs and the OCI referrers of every image read from a registry
+func (e *RegistryEngine) SetReferrers(enabled bool) {
+	e.referrers = enabled
+}
+
+// SetRequireReferrers makes a failed referrer copy fail the image instead
+// of being logged. Referrers are copied when required.
+func (e *RegistryEngine) SetRequireReferrers(required bool) {
+	e.requireReferrers = required
+	if required {
+		e.referrers = true
+	}
+}
+
+// SetConversion recompresses gzip and zstd image layers to the given
+// algorithm while copying. Converted images get new digests.
+func (e *RegistryEngine) SetConversion(algorithm string) {
+	e.conversion = algorithm
+}
+
+// SetBandwidth charges blobs read from and written to registries to the
+// limits of those registries. Copies between local archives aren't limited.
+func (e *RegistryEngine) SetBandwidth(limits *bandwidth.Limits) {
+	e.bandwidth = limits
+}
+
+// loadBundleBases reads the base bundles once per run
+func (e *RegistryEngine) loadBundleBases() error {
+	e.bundleOnce.Do(func() {
+		e.shipped = make(map[string]bool)
+		for _, base := range e.bundleBases {
+			record, err := archive.ReadBundleRecord(base)
+			if err != nil {
+				e.bundleErr = err
+				return
+			}
+			for _, digest := range record.Shipped {
+				e.shipped[digest] = true
+			}
+
+			// Record files only list digests, directories also hold content
+			if layout, err := archive.ReadLayout(base); err == nil {
+				e.baseLayouts = append(e.baseLayouts, layout)
+			}
+		}
+	})
+	return e.bundleErr
+}
+
+// Close finishes the archives written by the engine
+func (e *RegistryEngine) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var firstErr error
+	for key, a := range e.archives {
+		if a.closer != nil {
+			if err := a.closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			log.Info().Str("archive", key).Msg("Archive written")
+		}
+		delete(e.archives, key)
+	}
+	for key, s := range e.sources {
+		if s.closer != nil {
+			if err := s.closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		delete(e.sources, key)
+	}
+	return firstErr
+}
+
+// Transfer copies the source manifest and all content it references to the target
+func (e *RegistryEngine) Transfer(ctx context.Context, source, target *docker.ImageReference) (*Report, error) {
+	report := &Report{}
+
+	src, srcRef, err := e.source(source.FullName)
+	if err != nil {
+		return report, err
+	}
+	dst, dstRef, err := e.destination(target.FullName)
+	if err != nil {
+		return report, err
+	}
+
+	report.logf("Fetching source manifest: %s", srcRef)
+	data, desc, err := src.GetManifest(ctx, srcRef)
+	if err != nil {
+		report.logf("Manifest fetch failed: %v", err)
+		return report, errors.NewOperationError("transfer", "failed to fetch source manifest", err)
+	}
+	report.SourceDigest = desc.Digest
+	report.ArtifactType = artifactType(data, desc)
+	if report.ArtifactType != "" {
+		report.logf("Source is an OCI artifact of type %s", report.ArtifactType)
+	}
+
+	// Reduce a multi-platform source to the requested platforms
+	if len(source.Platforms) > 0 && oci.IsIndexMediaType(desc.MediaType) {
+		data, err = e.filterPlatforms(data, source.Platforms, report)
+		if err != nil {
+			return report, err
+		}
+		desc.Digest = oci.ComputeDigest(data)
+		desc.Size = int64(len(data))
+	}
+
+	// docker load only understands single-platform images
+	ld, toTarball := dst.(layoutDestination)
+	toTarball = toTarball && ld.singlePlatform
+	if toTarball && report.ArtifactType != "" {
+		return report, errors.NewValidationError("transfer",
+			fmt.Sprintf("docker-archive can't hold %s artifacts, export them to an oci: layout", report.ArtifactType), nil)
+	}
+	if toTarball && oci.IsIndexMediaType(desc.MediaType) {
+		srcRef, data, desc, err = e.selectPlatform(ctx, src, srcRef, data, source.Platforms, report)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	// Fail before pushing anything when a bundle lacks content
+	if ls, ok := src.(layoutSource); ok {
+		if err := e.checkComplete(ctx, ls, srcRef, data, desc); err != nil {
+			report.logf("Bundle check failed: %v", err)
+			return report, err
+		}
+	}
+
+	desc, err = e.copyManifest(ctx, src, srcRef, dst, dstRef, data, desc, report)
+	if err != nil {
+		return report, err
+	}
+	report.TargetDigest = desc.Digest
+
+	if err := e.verify(ctx, dst, dstRef, desc, report); err != nil {
+		report.logf("Verification failed: %v", err)
+		return report, err
+	}
+
+	// Artifacts refer to the source digest, which a filtered copy doesn't keep
+	if client, ok := src.(*oci.Client); ok && e.referrers {
+		if desc.Digest != report.SourceDigest {
+			report.logf("Skipping referrers of %s, the target digest differs", report.SourceDigest)
+		} else if err := e.copyReferrers(ctx, client, srcRef, dst, dstRef, desc.Digest, report); err != nil {
+			if e.requireReferrers {
+				report.logf("Referrer copy failed: %v", err)
+				return report, err
+			}
+			// The image is already in place, e.g. a registry may hide referrers
+			// from a token that can pull the image
+			report.logf("Referrer copy failed, keeping the image without them: %v", err)
+			log.Warn().Err(err).Str("source", srcRef.String()).Msg("Failed to copy referrers")
+		}
+	}
+
+	return report, nil
+}
+
+// artifactType returns the artifact type of a manifest or index that is not
+// a container image, or "" for images
+func artifactType(data []byte, desc oci.Descriptor) string {
+	if oci.IsIndexMediaType(desc.MediaType) {
+		index, err := oci.ParseIndex(data)
+		if err != nil {
+			return ""
+		}
+		return index.ArtifactType
+	}
+
+	manifest, err := oci.ParseManifest(data)
+	if err != nil {
+		return ""
+	}
+	return manifest.Type()
+}
+
+// checkComplete makes sure every blob referenced by a manifest or index read
+// from an archive is available, in the archive itself or its base bundles
+func (e *RegistryEngine) checkComplete(ctx context.Context, src layoutSource, srcRef oci.Reference, data []byte, desc oci.Descriptor) error {
+	if oci.IsIndexMediaType(desc.MediaType) {
+		index, err := oci.ParseIndex(data)
+		if err != nil {
+			return errors.NewValidationError("transfer", "invalid source index", err)
+		}
+		for _, child := range index.Manifests {
+			childRef := srcRef
+			childRef.Tag = ""
+			childRef.Digest = child.Digest
+
+			childData, childDesc, err := src.GetManifest(ctx, childRef)
+			if err != nil {
+				return errors.NewValidationError("transfer",
+					fmt.Sprintf("bundle is incomplete: manifest %s of %s is missing", child.Digest, srcRef.Reference()), err)
+			}
+			if child.MediaType != "" {
+				childDesc.MediaType = child.MediaType
+			}
+			if err := e.checkComplete(ctx, src, childRef, childData, childDesc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	manifest, err := oci.ParseManifest(data)
+	if err != nil {
+		return errors.NewValidationError("transfer", "invalid source manifest", err)
+	}
+	for _, blob := range manifest.Content() {
+		if src.find(blob.Digest) == nil {
+			return errors.NewValidationError("transfer",
+				fmt.Sprintf("bundle is incomplete: blob %s of %s is missing, import it together with the bundle that shipped it",
+					blob.Digest, desc.Digest), nil).
+				WithDetail("digest", blob.Digest)
+		}
+	}
+	return nil
+}
+
+// source resolves a source name to a registry or an on-disk archive
+func (e *RegistryEngine) source(name string) (source, oci.Reference, error) {
+	loc, ok := archive.ParseLocation(name)
+	if !ok {
+		ref, err := oci.ParseReference(name)
+		if err != nil {
+			return nil, oci.Reference{}, errors.NewValidationError("transfer", "invalid source reference", err)
+		}
+		return e.client, ref, nil
+	}
+
+	ref, err := archiveRef(loc)
+	if err != nil {
+		return nil, oci.Reference{}, err
+	}
+	s, err := e.openSource(loc)
+	if err != nil {
+		return nil, oci.Reference{}, err
+	}
+	return s.src, ref, nil
+}
+
+// ListArchive returns the names of the images stored in an archive location
+func (e *RegistryEngine) ListArchive(location string) ([]string, error) {
+	loc, ok := archive.ParseLocation(location)
+	if !ok {
+		return nil, errors.NewValidationError("transfer", fmt.Sprintf("%s is not an archive location", location), nil)
+	}
+	s, err := e.openSource(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, desc := range s.src.layout.Images() {
+		names = append(names, desc.Annotations[archive.AnnotationRefName])
+	}
+	return names, nil
+}
+
+// openSource opens an archive source once per run
+func (e *RegistryEngine) openSource(loc archive.Location) (*openSource, error) {
+	key := loc.WithRef("").String()
+
+	if e.bundle {
+		if err := e.loadBundleBases(); err != nil {
+			return nil, err
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if s, ok := e.sources[key]; ok {
+		return s, nil
+	}
+
+	s := &openSource{}
+	switch loc.Scheme {
+	case archive.SchemeDockerArchive:
+		unpacked, err := archive.UnpackDockerArchive(loc.Path)
+		if err != nil {
+			return nil, err
+		}
+		s.src = layoutSource{layout: unpacked.Layout}
+		s.closer = unpacked
+	default:
+		layout, err := archive.ReadLayout(loc.Path)
+		if err != nil {
+			return nil, err
+		}
+		s.src = layoutSource{layout: layout, bases: e.baseLayouts}
+	}
+
+	e.sources[key] = s
+	return s, nil
+}
+
+// archiveRef builds the reference of an image inside an archive, named by
+// the location's ref
+func archiveRef(loc archive.Location) (oci.Reference, error) {
+	repository, tag, digest, err := archive.SplitRef(loc.Ref)
+	if err != nil {
+		return oci.Reference{}, errors.NewValidationError("transfer",
+			fmt.Sprintf("archive location %s needs an image name", loc), err)
+	}
+	if tag == "" && digest == "" {
+		tag = "latest"
+	}
+	return oci.Reference{
+		Registry:   loc.Scheme + ":" + loc.Path,
+		Repository: repository,
+		Tag:        tag,
+		Digest:     digest,
+	}, nil
+}
+
+// destination resolves a target name to a registry or an on-disk archive
+func (e *RegistryEngine) destination(name string) (destination, oci.Reference, error) {
+	loc, ok := archive.ParseLocation(name)
+	if !ok {
+		ref, err := oci.ParseReference(name)
+		if err != nil {
+			return nil, oci.Reference{}, errors.NewValidationError("transfer", "invalid target reference", err)
+		}
+		return registryDestination{e.client}, ref, nil
+	}
+
+	ref, err := archiveRef(loc)
+	if err != nil {
+		return nil, oci.Reference{}, err
+	}
+	a, err := e.openArchive(loc)
+	if err != nil {
+		return nil, oci.Reference{}, err
+	}
+	return a.dst, ref, nil
+}
+
+// openArchive opens an archive target once per run
+func (e *RegistryEngine) openArchive(loc archive.Location) (*openArchive, error) {
+	key := loc.WithRef("").String()
+
+	if e.bundle {
+		if err := e.loadBundleBases(); err != nil {
+			return nil, err
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if a, ok := e.archives[key]; ok {
+		return a, nil
+	}
+
+	a := &openArchive{}
+	switch loc.Scheme {
+	case archive.SchemeDockerArchive:
+		tarball, err := archive.CreateDockerArchive(loc.Path)
+		if err != nil {
+			return nil, err
+		}
+		a.dst = layoutDestination{layout: tarball.Layout, singlePlatform: true}
+		a.closer = tarball
+	default:
+		layout, err := archive.OpenLayout(loc.Path)
+		if err != nil {
+			return nil, err
+		}
+		a.dst = layoutDestination{layout: layout}
+		if e.bundle {
+			a.dst.shipped = e.shipped
+			a.closer = bundleRecorder{layout: layout, shipped: e.shipped}
+		}
+	}
+
+	e.archives[key] = a
+	return a, nil
+}
+
+// selectPlatform picks a single image from an index, preferring the first
+// requested platform and otherwise linux on the host architecture
+func (e *RegistryEngine) selectPlatform(ctx context.Context, src source, srcRef oci.Reference, data []byte, specs []string, report *Report) (oci.Reference, []byte, oci.Descriptor, error) {
+	want := []string{"linux/" + runtime.GOARCH}
+	if len(specs) > 0 {
+		want = specs
+	}
+	platforms, err := oci.ParsePlatforms(want)
+	if err != nil {
+		return srcRef, nil, oci.Descriptor{}, errors.NewValidationError("transfer", "invalid platform filter", err)
+	}
+
+	index, err := oci.ParseIndex(data)
+	if err != nil {
+		return srcRef, nil, oci.Descriptor{}, errors.NewValidationError("transfer", "invalid source index", err)
+	}
+
+	for _, platform := range platforms {
+		for _, child := range index.Manifests {
+			if child.Platform == nil || !child.Platform.Matches(platform) {
+				continue
+			}
+
+			childRef := srcRef
+			childRef.Tag = ""
+			childRef.Digest = child.Digest
+
+			childData, childDesc, err := src.GetManifest(ctx, childRef)
+			if err != nil {
+				report.logf("Manifest fetch failed: %v", err)
+				return srcRef, nil, oci.Descriptor{}, errors.NewOperationError("transfer",
+					fmt.Sprintf("failed to fetch manifest %s", child.Digest), err)
+			}
+			if child.MediaType != "" {
+				childDesc.MediaType = child.MediaType
+			}
+
+			report.logf("Selected platform %s for docker-archive", child.Platform.String())
+			return childRef, childData, childDesc, nil
+		}
+	}
+
+	return srcRef, nil, oci.Descriptor{}, errors.NewValidationError("transfer",
+		fmt.Sprintf("source has no image for platform %s", strings.Join(want, ",")), nil)
+}
+
+// verify reads the pushed manifest back from the target and checks that its
+// digest, and for indexes the digest of every child, matches what was sent
+func (e *RegistryEngine) verify(ctx context.Context, dst destination, dstRef oci.Reference, desc oci.Descriptor, report *Report) error {
+	report.logf("Verifying target manifest: %s", dstRef)
+	pushed, pushedDesc, err := dst.GetManifest(ctx, dstRef)
+	if err != nil {
+		return errors.NewOperationError("transfer", "failed to fetch target manifest for verification", err)
+	}
+	if pushedDesc.Digest != desc.Digest {
+		return errors.NewVerificationError("transfer",
+			fmt.Sprintf("target digest %s does not match source digest %s", pushedDesc.Digest, desc.Digest), nil).
+			WithDetail("expected", desc.Digest).
+			WithDetail("actual", pushedDesc.Digest)
+	}
+
+	if oci.IsIndexMediaType(desc.MediaType) {
+		index, err := oci.ParseIndex(pushed)
+		if err != nil {
+			return errors.NewValidationError("transfer", "invalid target index", err)
+		}
+
+		for _, child := range index.Manifests {
+			childRef := dstRef
+			childRef.Tag = ""
+			childRef.Digest = child.Digest
+
+			childDesc, exists, err := dst.HeadManifest(ctx, childRef)
+			if err != nil {
+				return errors.NewOperationError("transfer", fmt.Sprintf("failed to resolve target manifest %s", child.Digest), err)
+			}
+			if !exists || childDesc.Digest != child.Digest {
+				return errors.NewVerificationError("transfer",
+					fmt.Sprintf("target is missing manifest %s listed in its index", child.Digest), nil).
+					WithDetail("expected", child.Digest).
+					WithDetail("actual", childDesc.Digest)
+			}
+		}
+	}
+
+	report.ChecksumOK = true
+	report.logf("Verified target digest %s", desc.Digest)
+	return nil
+}
+
+// filterPlatforms drops the index entries that don't match the requested platforms
+func (e *RegistryEngine) filterPlatforms(data []byte, specs []string, report *Report) ([]byte, error) {
+	platforms, err := oci.ParsePlatforms(specs)
+	if err != nil {
+		return nil, errors.NewValidationError("transfer", "invalid platform filter", err)
+	}
+
+	filtered, removed, err := oci.FilterIndex(data, platforms)
+	if err != nil {
+		report.logf("Platform filter failed: %v", err)
+		return nil, errors.NewValidationError("transfer", fmt.Sprintf("cannot select platforms %s", strings.Join(specs, ",")), err)
+	}
+
+	for _, desc := range removed {
+		report.FilteredPlatforms = append(report.FilteredPlatforms, desc.Platform.String())
+	}
+	if len(removed) > 0 {
+		report.logf("Filtered out platforms: %s", strings.Join(report.FilteredPlatforms, ", "))
+	}
+
+	return filtered, nil
+}
+
+// copyManifest copies a manifest or index and everything it references.
+// The manifest is pushed under dstRef's tag, or its digest when no tag is set.
+// It returns the descriptor of the pushed manifest, which differs from desc
+// when layers were converted.
+func (e *RegistryEngine) copyManifest(ctx context.Context, src source, srcRef oci.Reference, dst destination, dstRef oci.Reference, data []byte, desc oci.Descriptor, report *Report) (oci.Descriptor, error) {
+	if oci.IsIndexMediaType(desc.MediaType) {
+		return e.copyIndex(ctx, src, srcRef, dst, dstRef, data, desc, report)
+	}
+	return e.copyImage(ctx, src, srcRef, dst, dstRef, data, desc, report)
+}
+
+// copyIndex copies every child manifest of an index and then the index
+// itself, rewritten to point at converted children
+func (e *RegistryEngine) copyIndex(ctx context.Context, src source, srcRef oci.Reference, dst destination, dstRef oci.Reference, data []byte, desc oci.Descriptor, report *Report) (oci.Descriptor, error) {
+	index, err := oci.ParseIndex(data)
+	if err != nil {
+		return desc, errors.NewValidationError("transfer", "invalid source index", err)
+	}
+
+	rewritten := false
+	report.logf("Copying index with %d manifests", len(index.Manifests))
+	for i, child := range index.Manifests {
+		childSrc := srcRef
+		childSrc.Tag = ""
+		childSrc.Digest = child.Digest
+
+		childData, childDesc, err := src.GetManifest(ctx, childSrc)
+		if err != nil {
+			report.logf("Manifest fetch failed: %v", err)
+			return desc, errors.NewOperationError("transfer", fmt.Sprintf("failed to fetch manifest %s", child.Digest), err)
+		}
+
+		// Registries may answer with a generic content type, trust the index
+		if child.MediaType != "" {
+			childDesc.MediaType = child.MediaType
+		}
+
+		childDst := dstRef
+		childDst.Tag = ""
+		childDst.Digest = child.Digest
+
+		if child.Platform != nil {
+			report.logf("Copying %s manifest %s", child.Platform.String(), child.Digest)
+		}
+		pushed, err := e.copyManifest(ctx, src, childSrc, dst, childDst, childData, childDesc, report)
+		if err != nil {
+			return desc, err
+		}
+		if pushed.Digest != child.Digest {
+			index.Manifests[i].MediaType = pushed.MediaType
+			index.Manifests[i].Digest = pushed.Digest
+			index.Manifests[i].Size = pushed.Size
+			rewritten = true
+		}
+	}
+
+	if rewritten {
+		// Converted children are OCI manifests, which belong in an OCI index
+		index.MediaType = oci.MediaTypeOCIIndex
+		data, err = json.Marshal(index)
+		if err != nil {
+			return desc, errors.NewOperationError("transfer", "failed to encode converted index", err)
+		}
+		desc = oci.Descriptor{MediaType: oci.MediaTypeOCIIndex, Digest: oci.ComputeDigest(data), Size: int64(len(data))}
+		if dstRef.Digest != "" {
+			dstRef.Digest = desc.Digest
+		}
+	}
+
+	return desc, e.putManifest(ctx, dst, dstRef, data, desc, report)
+}
+
+// copyImage copies the config and layers of a manifest and then the manifest itself
+func (e *RegistryEngine) copyImage(ctx context.Context, src source, srcRef oci.Reference, dst destination, dstRef oci.Reference, data []byte, desc oci.Descriptor, report *Report) (oci.Descriptor, error) {
+	manifest, err := oci.ParseManifest(data)
+	if err != nil {
+		return desc, errors.NewValidationError("transfer", "invalid source manifest", err)
+	}
+
+	// Converted layers are pushed as they are converted
+	var converted map[string]bool
+	if e.conversion != "" && manifest.Type() == "" {
+		data, desc, converted, err = e.convertLayers(ctx, src, srcRef, dst, dstRef, manifest, data, desc, report)
+		if err != nil {
+			return desc, err
+		}
+		if dstRef.Digest != "" {
+			dstRef.Digest = desc.Digest
+		}
+	}
+
+	for _, blob := range manifest.Content() {
+		if converted[blob.Digest] {
+			continue
+		}
+		report.ImageSize += blob.Size
+
+		// Skip blobs the target already has, e.g. shared base layers
+		exists, err := dst.HasBlob(ctx, dstRef, blob.Digest)
+		if err != nil {
+			report.logf("Blob check failed: %v", err)
+			return desc, errors.NewOperationError("transfer", fmt.Sprintf("failed to check blob %s", blob.Digest), err)
+		}
+		if exists {
+			report.logf("Skipping existing blob %s (%d bytes)", blob.Digest, blob.Size)
+			report.BytesSkipped += blob.Size
+			continue
+		}
+
+		// Within one registry, try a cross-repository mount before uploading
+		_, fromRegistry := src.(*oci.Client)
+		_, toRegistry := dst.(registryDestination)
+		if fromRegistry && toRegistry && srcRef.APIHost() == dstRef.APIHost() && srcRef.Repository != dstRef.Repository {
+			mounted, err := e.client.MountBlob(ctx, dstRef, srcRef.Repository, blob.Digest)
+			if err != nil {
+				log.Debug().Err(err).Str("digest", blob.Digest).Msg("Blob mount failed, falling back to upload")
+			}
+			if mounted {
+				report.logf("Mounted blob %s from %s", blob.Digest, srcRef.Repository)
+				report.BlobsMounted++
+				report.BytesSkipped += blob.Size
+				continue
+			}
+		}
+
+		report.logf("Copying blob %s (%d bytes)", blob.Digest, blob.Size)
+		if err := e.copyBlob(ctx, src, srcRef, dst, dstRef, blob, report); err != nil {
+			report.logf("Blob copy failed: %v", err)
+			return desc, errors.NewOperationError("transfer", fmt.Sprintf("failed to copy blob %s", blob.Digest), err)
+		}
+		report.BytesMoved += blob.Size
+	}
+
+	return desc, e.putManifest(ctx, dst, dstRef, data, desc, report)
+}
+
+// putManifest pushes a manifest to the target
+func (e *RegistryEngine) putManifest(ctx context.Context, dst destination, dstRef oci.Reference, data []byte, desc oci.Descriptor, report *Report) error {
+	report.logf("Pushing target manifest: %s", dstRef)
+	if _, err := dst.PutManifest(ctx, dstRef, desc.MediaType, data); err != nil {
+		report.logf("Manifest push failed: %v", err)
+		return errors.NewOperationError("transfer", "failed to push target manifest", err)
+	}
+
+	return nil
+}
+
+// copyBlob streams a single blob from the source, or the local cache, to the
+// target. Only blobs fetched from a registry are cached.
+func (e *RegistryEngine) copyBlob(ctx context.Context, src source, srcRef oci.Reference, dst destination, dstRef oci.Reference, blob oci.Descriptor, report *Report) error {
+	_, fromRegistry := src.(*oci.Client)
+	blobCache := e.cache
+	if !fromRegistry {
+		blobCache = nil
+	}
+
+	if blobCache != nil {
+		if content, _, ok := blobCache.Open(blob.Digest); ok {
+			defer content.Close()
+			report.logf("Using cached blob %s", blob.Digest)
+			return dst.PushBlob(ctx, dstRef, blob, e.limit(ctx, content, nil, oci.Reference{}, dst, dstRef))
+		}
+	}
+
+	blobContent, _, err := src.GetBlob(ctx, srcRef, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer blobContent.Close()
+	content := e.limit(ctx, blobContent, src, srcRef, dst, dstRef)
+
+	log.Debug().
+		Str("digest", blob.Digest).
+		Int64("size", blob.Size).
+		Str("target", dstRef.String()).
+		Msg("Streaming blob")
+
+	if blobCache == nil {
+		return dst.PushBlob(ctx, dstRef, blob, content)
+	}
+
+	// Keep a copy of the blob on disk while it streams to the target
+	writer, err := blobCache.Writer(blob.Digest, blob.Size)
+	if err != nil {
+		log.Warn().Err(err).Str("digest", blob.Digest).Msg("Failed to cache blob")
+	}
+	if writer == nil {
+		return dst.PushBlob(ctx, dstRef, blob, content)
+	}
+
+	if err := dst.PushBlob(ctx, dstRef, blob, io.TeeReader(content, writer)); err != nil {
+		writer.Abort()
+		return err
+	}
+	if err := writer.Commit(); err != nil {
+		log.Warn().Err(err).Str("digest", blob.Digest).Msg("Failed to cache blob")
+	}
+	return nil
+}
+
+// limit charges reads from a blob stream to the bandwidth limits of the
+// registries among its source and destination, either may be nil
+func (e *RegistryEngine) limit(ctx context.Context, content io.Reader, src source, srcRef oci.Reference, dst destination, dstRef oci.Reference) io.Reader {
+	var registries []string
+	if _, ok := src.(*oci.Client); ok {
+		registries = append(registries, srcRef.Registry)
+	}
+	if _, ok := dst.(registryDestination); ok {
+		registries = append(registries, dstRef.Registry)
+	}
+	if len(registries) == 0 {
+		return content
+	}
+	return e.bandwidth.Reader(ctx, content, registries...)
+}
@@ -0,0 +1,57 @@
+package transfer
+
+import (
+	"context"
+
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/docker"
+)
+
+// Router hands transfers that read or write an on-disk archive to the
+// registry engine, which is the only one that can handle them, and every
+// other transfer to the configured engine
+type Router struct {
+	engine   Engine
+	archives *RegistryEngine
+}
+
+// Ensure Router implements Engine and ArchiveLister
+var (
+	_ Engine        = (*Router)(nil)
+	_ ArchiveLister = (*Router)(nil)
+)
+
+// NewRouter creates an engine that routes archive transfers to archives
+func NewRouter(engine Engine, archives *RegistryEngine) *Router {
+	return &Router{
+		engine:   engine,
+		archives: archives,
+	}
+}
+
+// Name returns the name of the configured transport
+func (r *Router) Name() string {
+	return r.engine.Name()
+}
+
+// Transfer implements Engine
+func (r *Router) Transfer(ctx context.Context, source, target *docker.ImageReference) (*Report, error) {
+	if archive.IsLocation(source.FullName) || archive.IsLocation(target.FullName) {
+		return r.archives.Transfer(ctx, source, target)
+	}
+	return r.engine.Transfer(ctx, source, target)
+}
+
+// ListArchive implements ArchiveLister
+func (r *Router) ListArchive(location string) ([]string, error) {
+	return r.archives.ListArchive(location)
+}
+
+// Close closes both engines
+func (r *Router) Close() error {
+	err := r.engine.Close()
+	if archiveErr := r.archives.Close(); err == nil {
+		err = archiveErr
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package transfer
+
+import (
+	"context"
+	"io"
+
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// source is where the registry engine reads manifests and blobs
+type source interface {
+	// GetManifest reads a manifest by tag or digest
+	GetManifest(ctx context.Context, ref oci.Reference) ([]byte, oci.Descriptor, error)
+
+	// GetBlob opens a blob and returns its size
+	GetBlob(ctx context.Context, ref oci.Reference, digest string) (io.ReadCloser, int64, error)
+}
+
+// Ensure the distribution client can be read from directly
+var _ source = (*oci.Client)(nil)
+
+// layoutSource reads from an image layout or an unpacked docker-archive.
+// Blobs missing from a delta bundle are read from its base bundles.
+type layoutSource struct {
+	layout *archive.Layout
+	bases  []*archive.Layout
+}
+
+// GetManifest implements source
+func (s layoutSource) GetManifest(_ context.Context, ref oci.Reference) ([]byte, oci.Descriptor, error) {
+	return s.layout.GetManifest(layoutRef(ref))
+}
+
+// GetBlob implements source
+func (s layoutSource) GetBlob(_ context.Context, _ oci.Reference, digest string) (io.ReadCloser, int64, error) {
+	if layout := s.find(digest); layout != nil {
+		return layout.OpenBlob(digest)
+	}
+	return s.layout.OpenBlob(digest)
+}
+
+// find returns the layout, or base bundle, that holds a blob
+func (s layoutSource) find(digest string) *archive.Layout {
+	if s.layout.HasBlob(digest) {
+		return s.layout
+	}
+	for _, base := range s.bases {
+		if base.HasBlob(digest) {
+			return base
+		}
+	}
+	return nil
+}
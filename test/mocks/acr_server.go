@@ -0,0 +1,213 @@
+package mocks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acrRefreshUsername is the username that logs in with a refresh token
+const acrRefreshUsername = "00000000-0000-0000-0000-000000000000"
+
+// acrGrant is a token issued by the ACRServer
+type acrGrant struct {
+	scope   string
+	expires time.Time
+}
+
+// ACRServer is a stub of Azure Container Registry that exchanges AAD tokens
+// for refresh tokens and refresh tokens for access tokens, and serves the
+// distribution API of an embedded RegistryServer to holders of access tokens
+type ACRServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	nextID  int
+	refresh map[string]time.Time
+	access  map[string]acrGrant
+
+	// Registry holds the repositories served to authorized requests
+	Registry *RegistryServer
+
+	// AADToken is the AAD access token accepted by the exchange, and Tenant
+	// the tenant it must name when set
+	AADToken string
+	Tenant   string
+
+	// AdminUsername and AdminPassword enable admin logins when set
+	AdminUsername string
+	AdminPassword string
+
+	// RefreshTTL and AccessTTL are the token lifetimes, an hour when zero
+	RefreshTTL time.Duration
+	AccessTTL  time.Duration
+
+	// Counters for assertions
+	ExchangeCalls int
+	TokenScopes   []string
+}
+
+// NewACRServer starts a new ACR stub accepting the given AAD token
+func NewACRServer(aadToken string) *ACRServer {
+	s := &ACRServer{
+		refresh:  make(map[string]time.Time),
+		access:   make(map[string]acrGrant),
+		Registry: NewRegistryServer(),
+		AADToken: aadToken,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Host returns the host:port of the registry
+func (s *ACRServer) Host() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// Close stops the registry and the embedded RegistryServer
+func (s *ACRServer) Close() {
+	s.Server.Close()
+	s.Registry.Close()
+}
+
+// IssueRefreshToken returns a refresh token valid for ttl
+func (s *ACRServer) IssueRefreshToken(ttl time.Duration) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := s.issue("refresh", "", ttl)
+	s.refresh[token] = time.Now().Add(ttl)
+	return token
+}
+
+// issue returns a new JWT-shaped token carrying its expiry. The caller must
+// hold the mutex.
+func (s *ACRServer) issue(kind, scope string, ttl time.Duration) string {
+	s.nextID++
+	claims, _ := json.Marshal(map[string]interface{}{
+		"jti":        fmt.Sprintf("%s-%d", kind, s.nextID),
+		"access":     scope,
+		"exp":        time.Now().Add(ttl).Unix(),
+		"grant_type": kind,
+	})
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(claims) + ".c2lnbmF0dXJl"
+}
+
+// acrTTL returns d, or an hour when d is zero
+func acrTTL(d time.Duration) time.Duration {
+	if d == 0 {
+		return time.Hour
+	}
+	return d
+}
+
+// validRefreshToken reports whether token is an unexpired refresh token.
+// The caller must hold the mutex.
+func (s *ACRServer) validRefreshToken(token string) bool {
+	expires, ok := s.refresh[token]
+	return ok && time.Now().Before(expires)
+}
+
+// handle routes the authentication endpoints and authorizes registry requests
+func (s *ACRServer) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/oauth2/exchange":
+		s.handleExchange(w, r)
+		return
+	case "/oauth2/token":
+		s.handleToken(w, r)
+		return
+	}
+
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="%s/oauth2/token",service="%s"`, s.URL, s.Host()))
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+	s.Registry.handle(w, r)
+}
+
+// authorized checks the bearer token of a request covers its repository
+func (s *ACRServer) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	grant, ok := s.access[token]
+	if !ok || time.Now().After(grant.expires) {
+		return false
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	for _, marker := range []string{"/tags/list", "/manifests/", "/blobs/"} {
+		if idx := strings.Index(path, marker); idx > 0 {
+			return strings.Contains(grant.scope, "repository:"+path[:idx]+":")
+		}
+	}
+	return true
+}
+
+func (s *ACRServer) handleExchange(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPost || r.FormValue("grant_type") != "access_token" {
+		writeOAuthError(w, "unsupported_grant_type", "unexpected grant type")
+		return
+	}
+	if r.FormValue("service") != s.Host() {
+		writeOAuthError(w, "invalid_request", "unknown service")
+		return
+	}
+	if r.FormValue("access_token") != s.AADToken || (s.Tenant != "" && r.FormValue("tenant") != s.Tenant) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "invalid AAD token"})
+		return
+	}
+
+	s.ExchangeCalls++
+	token := s.issue("refresh", "", acrTTL(s.RefreshTTL))
+	s.refresh[token] = time.Now().Add(acrTTL(s.RefreshTTL))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"refresh_token": token})
+}
+
+// handleToken issues access tokens for a refresh token posted as a form, or
+// for Basic credentials: the admin login or a refresh token login
+func (s *ACRServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.FormValue("service") != s.Host() {
+		writeOAuthError(w, "invalid_request", "unknown service")
+		return
+	}
+
+	var ok bool
+	if r.Method == http.MethodPost {
+		ok = r.FormValue("grant_type") == "refresh_token" && s.validRefreshToken(r.FormValue("refresh_token"))
+	} else if username, password, basic := r.BasicAuth(); basic {
+		ok = (s.AdminUsername != "" && username == s.AdminUsername && password == s.AdminPassword) ||
+			(username == acrRefreshUsername && s.validRefreshToken(password))
+	}
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "invalid credentials"})
+		return
+	}
+
+	scope := strings.Join(r.Form["scope"], " ")
+	s.TokenScopes = append(s.TokenScopes, scope)
+	token := s.issue("access", scope, acrTTL(s.AccessTTL))
+	s.access[token] = acrGrant{scope: scope, expires: time.Now().Add(acrTTL(s.AccessTTL))}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": token})
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/yugasun/hubsync/pkg/bandwidth"
 	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/oci"
 )
 
 // MockDockerClient provides a mock implementation for testing Docker client operations
@@ -18,10 +20,28 @@ type MockDockerClient struct {
 	TagErrors       map[string]error
 	PushErrors      map[string]error
 	CredentialError error
+	PullProgress    map[string]*docker.Progress
+	PushProgress    map[string]*docker.Progress
+	RemovedImages   []string
+	RemoveErrors    map[string]error
+	PruneCalls      int
+	PruneReport     docker.PruneReport
+	PruneError      error
+	Daemon          docker.DaemonInfo
+	DaemonError     error
+	Limits          *bandwidth.Limits // Limits pulls and pushes are charged to, like docker.ClientConfig.Bandwidth
+	Login           docker.LoginFunc  // Looks up push credentials, like docker.ClientConfig.Login
+	PushUsers       []string
 }
 
-// Ensure MockDockerClient implements docker.ClientInterface
-var _ docker.ClientInterface = (*MockDockerClient)(nil)
+// Ensure MockDockerClient implements docker.ClientInterface and the optional
+// daemon interfaces
+var (
+	_ docker.ClientInterface  = (*MockDockerClient)(nil)
+	_ docker.ImagePruner      = (*MockDockerClient)(nil)
+	_ docker.DaemonInspector  = (*MockDockerClient)(nil)
+	_ docker.BandwidthLimited = (*MockDockerClient)(nil)
+)
 
 // NewMockDockerClient creates a new instance of MockDockerClient
 func NewMockDockerClient() *MockDockerClient {
@@ -32,22 +52,26 @@ func NewMockDockerClient() *MockDockerClient {
 		PullErrors:   make(map[string]error),
 		TagErrors:    make(map[string]error),
 		PushErrors:   make(map[string]error),
+		PullProgress: make(map[string]*docker.Progress),
+		PushProgress: make(map[string]*docker.Progress),
+		RemoveErrors: make(map[string]error),
+		Daemon:       docker.DaemonInfo{Platform: oci.Platform{OS: "linux", Architecture: "amd64"}},
 	}
 }
 
 // PullImage mocks the Docker image pull operation
-func (m *MockDockerClient) PullImage(ctx context.Context, imageName string) error {
+func (m *MockDockerClient) PullImage(ctx context.Context, imageName string) (*docker.Progress, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Check for error scenario
 	if err, exists := m.PullErrors[imageName]; exists && err != nil {
-		return err
+		return nil, err
 	}
 
 	// Record successful pull
 	m.PulledImages[imageName] = true
-	return nil
+	return m.progress(m.PullProgress, imageName), nil
 }
 
 // TagImage mocks the Docker image tag operation
@@ -71,13 +95,22 @@ func (m *MockDockerClient) TagImage(ctx context.Context, source, target string)
 }
 
 // PushImage mocks the Docker image push operation
-func (m *MockDockerClient) PushImage(ctx context.Context, imageName string) error {
+func (m *MockDockerClient) PushImage(ctx context.Context, imageName string) (*docker.Progress, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Check for error scenario
 	if err, exists := m.PushErrors[imageName]; exists && err != nil {
-		return err
+		return nil, err
+	}
+
+	// Record who pushed when credentials come from a login function
+	if m.Login != nil {
+		username, _, err := m.Login(ctx)
+		if err != nil {
+			return nil, err
+		}
+		m.PushUsers = append(m.PushUsers, username)
 	}
 
 	// Check if image exists (was tagged)
@@ -90,12 +123,20 @@ func (m *MockDockerClient) PushImage(ctx context.Context, imageName string) erro
 	}
 
 	if !exists {
-		return fmt.Errorf("target image %s not found", imageName)
+		return nil, fmt.Errorf("target image %s not found", imageName)
 	}
 
 	// Record successful push
 	m.PushedImages[imageName] = true
-	return nil
+	return m.progress(m.PushProgress, imageName), nil
+}
+
+// progress returns the configured progress of an image, or an empty one
+func (m *MockDockerClient) progress(configured map[string]*docker.Progress, imageName string) *docker.Progress {
+	if progress, ok := configured[imageName]; ok {
+		return progress
+	}
+	return &docker.Progress{}
 }
 
 // VerifyCredentials mocks Docker registry authentication
@@ -134,6 +175,49 @@ func (m *MockDockerClient) GetImageInfo(ctx context.Context, imageName string) (
 	}, nil
 }
 
+// RemoveImage mocks removing an image tag from the daemon
+func (m *MockDockerClient) RemoveImage(ctx context.Context, imageName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Check for error scenario
+	if err, exists := m.RemoveErrors[imageName]; exists && err != nil {
+		return err
+	}
+
+	// Record successful removal
+	m.RemovedImages = append(m.RemovedImages, imageName)
+	delete(m.PulledImages, imageName)
+	return nil
+}
+
+// PruneDanglingImages mocks pruning dangling images
+func (m *MockDockerClient) PruneDanglingImages(ctx context.Context) (*docker.PruneReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.PruneCalls++
+	if m.PruneError != nil {
+		return nil, m.PruneError
+	}
+	report := m.PruneReport
+	return &report, nil
+}
+
+// DaemonInfo mocks reading the daemon's data root and platform
+func (m *MockDockerClient) DaemonInfo(ctx context.Context) (*docker.DaemonInfo, error) {
+	if m.DaemonError != nil {
+		return nil, m.DaemonError
+	}
+	info := m.Daemon
+	return &info, nil
+}
+
+// Bandwidth returns the limits the client was created with
+func (m *MockDockerClient) Bandwidth() *bandwidth.Limits {
+	return m.Limits
+}
+
 // Close mocks the closing of resources
 func (m *MockDockerClient) Close() error {
 	return nil
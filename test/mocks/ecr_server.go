@@ -0,0 +1,106 @@
+package mocks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ECRServer is a stub of the Amazon ECR API for tests
+type ECRServer struct {
+	*httptest.Server
+
+	mu sync.Mutex
+
+	// AccessKeyID and Region are expected in the SigV4 credential scope
+	AccessKeyID string
+	Region      string
+
+	// Password is handed out in authorization tokens for the AWS user
+	Password string
+
+	// TokenTTL is how long tokens are valid, 12 hours when zero
+	TokenTTL time.Duration
+
+	// Repositories holds the repositories that exist
+	Repositories map[string]bool
+
+	// Counters for assertions
+	TokenRequests int
+	Created       []string
+}
+
+// NewECRServer starts a new ECR API stub
+func NewECRServer(accessKeyID, region, password string) *ECRServer {
+	s := &ECRServer{
+		AccessKeyID:  accessKeyID,
+		Region:       region,
+		Password:     password,
+		Repositories: make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// handle dispatches an ECR API action on its X-Amz-Target header
+func (s *ECRServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scope := fmt.Sprintf("Credential=%s/%s/%s/ecr/aws4_request", s.AccessKeyID, time.Now().UTC().Format("20060102"), s.Region)
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 "+scope) || !strings.Contains(auth, "x-amz-target") || r.Header.Get("X-Amz-Date") == "" {
+		writeECRError(w, http.StatusBadRequest, "UnrecognizedClientException", "The security token included in the request is invalid.")
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonEC2ContainerRegistry_V20150921.") {
+	case "GetAuthorizationToken":
+		s.TokenRequests++
+		ttl := s.TokenTTL
+		if ttl == 0 {
+			ttl = 12 * time.Hour
+		}
+		token := base64.StdEncoding.EncodeToString([]byte("AWS:" + s.Password))
+		writeECRResponse(w, map[string]interface{}{
+			"authorizationData": []map[string]interface{}{{
+				"authorizationToken": token,
+				"expiresAt":          float64(time.Now().Add(ttl).Unix()),
+				"proxyEndpoint":      "https://" + r.Host,
+			}},
+		})
+	case "CreateRepository":
+		var in struct {
+			RepositoryName string `json:"repositoryName"`
+		}
+		_ = json.Unmarshal(body, &in)
+		if s.Repositories[in.RepositoryName] {
+			writeECRError(w, http.StatusBadRequest, "RepositoryAlreadyExistsException",
+				fmt.Sprintf("The repository with name '%s' already exists", in.RepositoryName))
+			return
+		}
+		s.Repositories[in.RepositoryName] = true
+		s.Created = append(s.Created, in.RepositoryName)
+		writeECRResponse(w, map[string]interface{}{"repository": map[string]string{"repositoryName": in.RepositoryName}})
+	default:
+		writeECRError(w, http.StatusBadRequest, "UnknownOperationException", "unknown operation")
+	}
+}
+
+func writeECRResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeECRError(w http.ResponseWriter, status int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"__type": errorType, "message": message})
+}
@@ -0,0 +1,121 @@
+package mocks
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// GoogleTokenServer is a stub of the Google OAuth2 token endpoint that
+// trades service account JWT assertions for access tokens
+type GoogleTokenServer struct {
+	*httptest.Server
+
+	mu sync.Mutex
+
+	// Email and PublicKey identify the service account allowed to sign in
+	Email     string
+	PublicKey *rsa.PublicKey
+
+	// AccessToken is handed out for valid assertions
+	AccessToken string
+
+	// ExpiresIn is the token lifetime in seconds, 3600 when zero
+	ExpiresIn int
+
+	// Counters for assertions
+	TokenRequests int
+}
+
+// NewGoogleTokenServer starts a new token endpoint stub
+func NewGoogleTokenServer(email string, publicKey *rsa.PublicKey, accessToken string) *GoogleTokenServer {
+	s := &GoogleTokenServer{
+		Email:       email,
+		PublicKey:   publicKey,
+		AccessToken: accessToken,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// TokenURL returns the URL of the token endpoint
+func (s *GoogleTokenServer) TokenURL() string {
+	return s.URL + "/token"
+}
+
+func (s *GoogleTokenServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPost || r.URL.Path != "/token" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		writeOAuthError(w, "unsupported_grant_type", "unexpected grant type")
+		return
+	}
+	if err := s.verify(r.FormValue("assertion")); err != nil {
+		writeOAuthError(w, "invalid_grant", err.Error())
+		return
+	}
+
+	s.TokenRequests++
+	expiresIn := s.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = 3600
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": s.AccessToken,
+		"expires_in":   expiresIn,
+		"token_type":   "Bearer",
+	})
+}
+
+// verify checks the signature, issuer and audience of a JWT assertion
+func (s *GoogleTokenServer) verify(assertion string) error {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed assertion")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("malformed signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(s.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return fmt.Errorf("invalid JWT signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("malformed claims")
+	}
+	var claims struct {
+		Iss   string `json:"iss"`
+		Aud   string `json:"aud"`
+		Scope string `json:"scope"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return fmt.Errorf("malformed claims")
+	}
+	if claims.Iss != s.Email || claims.Aud != s.TokenURL() || claims.Scope == "" {
+		return fmt.Errorf("invalid JWT claims")
+	}
+	return nil
+}
+
+func writeOAuthError(w http.ResponseWriter, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
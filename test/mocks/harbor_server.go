@@ -0,0 +1,166 @@
+package mocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// HarborProject is a project held by the HarborServer
+type HarborProject struct {
+	Public       bool
+	StorageLimit int64
+}
+
+// HarborServer is a stub of Harbor serving its projects API and the
+// distribution API of an embedded RegistryServer to signed-in users
+type HarborServer struct {
+	*httptest.Server
+
+	mu sync.Mutex
+
+	// Registry holds the repositories served to authorized requests
+	Registry *RegistryServer
+
+	// Username and Password sign in an administrator who may create projects
+	Username string
+	Password string
+
+	// RobotName and RobotSecret sign in a project robot account, which may
+	// push but not create projects
+	RobotName   string
+	RobotSecret string
+
+	// Projects holds the projects that exist
+	Projects map[string]*HarborProject
+
+	// FullProjects lists projects whose storage quota is used up
+	FullProjects map[string]bool
+
+	// Counters for assertions
+	ProjectLookups int
+	Created        []string
+}
+
+// NewHarborServer starts a new Harbor stub for an administrator
+func NewHarborServer(username, password string) *HarborServer {
+	s := &HarborServer{
+		Registry:     NewRegistryServer(),
+		Username:     username,
+		Password:     password,
+		Projects:     make(map[string]*HarborProject),
+		FullProjects: make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Host returns the host:port of the registry
+func (s *HarborServer) Host() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// Close stops the registry and the embedded RegistryServer
+func (s *HarborServer) Close() {
+	s.Server.Close()
+	s.Registry.Close()
+}
+
+// signedIn reports whether a request is signed in, and as the administrator
+func (s *HarborServer) signedIn(r *http.Request) (bool, bool) {
+	username, password, ok := r.BasicAuth()
+	switch {
+	case !ok:
+		return false, false
+	case username == s.Username && password == s.Password:
+		return true, true
+	case s.RobotName != "" && username == s.RobotName && password == s.RobotSecret:
+		return true, false
+	}
+	return false, false
+}
+
+// handle routes the projects API and authorizes registry requests
+func (s *HarborServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ok, admin := s.signedIn(r)
+	s.mu.Unlock()
+
+	if strings.HasPrefix(r.URL.Path, "/api/v2.0/") {
+		if !ok {
+			writeHarborError(w, http.StatusUnauthorized, "UNAUTHORIZED", "unauthorized")
+			return
+		}
+		s.handleProjects(w, r, admin)
+		return
+	}
+
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="harbor"`)
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	// Harbor checks the project quota before accepting content
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		project, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/")
+		s.mu.Lock()
+		full := s.FullProjects[project]
+		s.mu.Unlock()
+		if full {
+			writeRegistryError(w, http.StatusForbidden, "DENIED", fmt.Sprintf(
+				"Quota exceeded when processing the request of adding 3.0 KiB of storage resource, which when updated to current usage of 10.0 MiB will exceed the configured upper limit of 10.0 MiB in project %s.", project))
+			return
+		}
+	}
+	s.Registry.handle(w, r)
+}
+
+func (s *HarborServer) handleProjects(w http.ResponseWriter, r *http.Request, admin bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/api/v2.0/projects" && r.Method == http.MethodHead:
+		s.ProjectLookups++
+		if _, ok := s.Projects[r.URL.Query().Get("project_name")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/api/v2.0/projects" && r.Method == http.MethodPost:
+		if !admin {
+			writeHarborError(w, http.StatusForbidden, "FORBIDDEN", "forbidden")
+			return
+		}
+		var req struct {
+			ProjectName  string            `json:"project_name"`
+			Metadata     map[string]string `json:"metadata"`
+			StorageLimit int64             `json:"storage_limit"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProjectName == "" {
+			writeHarborError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid project")
+			return
+		}
+		if _, ok := s.Projects[req.ProjectName]; ok {
+			writeHarborError(w, http.StatusConflict, "CONFLICT", fmt.Sprintf("The project named %s already exists", req.ProjectName))
+			return
+		}
+		s.Projects[req.ProjectName] = &HarborProject{Public: req.Metadata["public"] == "true", StorageLimit: req.StorageLimit}
+		s.Created = append(s.Created, req.ProjectName)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeHarborError(w, http.StatusNotFound, "NOT_FOUND", "unknown route")
+	}
+}
+
+func writeHarborError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
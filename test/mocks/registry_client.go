@@ -16,7 +16,9 @@ type MockRegistryClient struct {
 	ExistingImages    map[string]bool
 	ExistingTags      map[string][]string
 	ImageManifests    map[string][]byte
+	ImageDigests      map[string]string
 	ValidationResults map[string]bool
+	DigestErrors      map[string]error
 }
 
 // Ensure MockRegistryClient implements registry.RegistryInterface
@@ -28,7 +30,9 @@ func NewMockRegistryClient() *MockRegistryClient {
 		ExistingImages:    make(map[string]bool),
 		ExistingTags:      make(map[string][]string),
 		ImageManifests:    make(map[string][]byte),
+		ImageDigests:      make(map[string]string),
 		ValidationResults: make(map[string]bool),
+		DigestErrors:      make(map[string]error),
 	}
 }
 
@@ -74,6 +78,19 @@ func (m *MockRegistryClient) GetImageManifest(ctx context.Context, repository st
 	return nil, fmt.Errorf("manifest for %s not found", key)
 }
 
+// GetImageDigest mocks resolving the manifest digest of an image by its full name
+func (m *MockRegistryClient) GetImageDigest(ctx context.Context, imageRef *docker.ImageReference) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err, exists := m.DigestErrors[imageRef.FullName]; exists && err != nil {
+		return "", false, err
+	}
+
+	digest, exists := m.ImageDigests[imageRef.FullName]
+	return digest, exists, nil
+}
+
 // ValidateImage mocks checking if an image exists in the registry
 func (m *MockRegistryClient) ValidateImage(ctx context.Context, imageRef *docker.ImageReference) (bool, error) {
 	m.mu.Lock()
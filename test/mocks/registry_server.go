@@ -0,0 +1,499 @@
+package mocks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// StoredManifest is a manifest held by the RegistryServer
+type StoredManifest struct {
+	MediaType string
+	Data      []byte
+}
+
+// RegistryServer is an in-memory OCI distribution registry for tests
+type RegistryServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	repoBlobs map[string]map[string]bool
+	manifests map[string]map[string]StoredManifest
+	uploads   map[string]*bytes.Buffer
+	nextID    int
+
+	// Username and Password enable the bearer token challenge flow when set
+	Username string
+	Password string
+
+	// BasicAuth answers with a Basic challenge instead of a bearer one
+	BasicAuth bool
+
+	// PageSize limits the catalog and tag list pages, linked with Link
+	// headers, when set
+	PageSize int
+
+	// RefuseMounts makes cross-repository mount requests fall back to uploads
+	RefuseMounts bool
+
+	// RewriteTaggedManifests stores manifests pushed by tag with different
+	// bytes, like a registry that re-serializes what it receives
+	RewriteTaggedManifests bool
+
+	// ReferrersAPI serves the OCI 1.1 referrers API, which returns 404 otherwise
+	ReferrersAPI bool
+
+	// DenyReferrers refuses referrer lookups with 403, like a registry hiding
+	// them from the token
+	DenyReferrers bool
+
+	// Counters for assertions
+	BlobGets     int
+	BlobMounts   int
+	BlobUploads  int
+	ManifestPuts int
+	TokenIssued  int
+	TokenScopes  []string
+}
+
+// NewRegistryServer starts a new in-memory registry
+func NewRegistryServer() *RegistryServer {
+	s := &RegistryServer{
+		blobs:     make(map[string][]byte),
+		repoBlobs: make(map[string]map[string]bool),
+		manifests: make(map[string]map[string]StoredManifest),
+		uploads:   make(map[string]*bytes.Buffer),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Host returns the host:port of the registry
+func (s *RegistryServer) Host() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// AddBlob stores a blob in a repository and returns its descriptor
+func (s *RegistryServer) AddBlob(repo, mediaType string, data []byte) oci.Descriptor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	digest := oci.ComputeDigest(data)
+	s.storeBlob(repo, digest, data)
+	return oci.Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(data))}
+}
+
+// AddManifest stores a manifest under its digest and an optional tag
+func (s *RegistryServer) AddManifest(repo, tag, mediaType string, data []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	digest := oci.ComputeDigest(data)
+	s.storeManifest(repo, digest, StoredManifest{MediaType: mediaType, Data: data})
+	if tag != "" {
+		s.storeManifest(repo, tag, StoredManifest{MediaType: mediaType, Data: data})
+	}
+	return digest
+}
+
+// AddImage stores a single-platform image built from the given layers and
+// returns the manifest digest
+func (s *RegistryServer) AddImage(repo, tag string, layers ...[]byte) string {
+	config := s.AddBlob(repo, "application/vnd.oci.image.config.v1+json",
+		[]byte(fmt.Sprintf(`{"architecture":"amd64","os":"linux","tag":%q}`, tag)))
+
+	manifest := oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeOCIManifest,
+		Config:        config,
+	}
+	for _, layer := range layers {
+		manifest.Layers = append(manifest.Layers,
+			s.AddBlob(repo, "application/vnd.oci.image.layer.v1.tar+gzip", layer))
+	}
+
+	data, _ := json.Marshal(manifest)
+	return s.AddManifest(repo, tag, oci.MediaTypeOCIManifest, data)
+}
+
+// AddMultiArchImage stores one image per os/arch[/variant] platform under an
+// OCI index and returns the index digest
+func (s *RegistryServer) AddMultiArchImage(repo, tag string, platforms ...string) string {
+	index := oci.Index{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeOCIIndex,
+	}
+	for _, platform := range platforms {
+		parts := strings.SplitN(platform, "/", 3)
+		p := &oci.Platform{OS: parts[0], Architecture: parts[1]}
+		if len(parts) == 3 {
+			p.Variant = parts[2]
+		}
+
+		digest := s.AddImage(repo, "", []byte("layer-"+platform))
+		m, _ := s.Manifest(repo, digest)
+		index.Manifests = append(index.Manifests, oci.Descriptor{
+			MediaType: oci.MediaTypeOCIManifest,
+			Digest:    digest,
+			Size:      int64(len(m.Data)),
+			Platform:  p,
+		})
+	}
+
+	data, _ := json.Marshal(index)
+	return s.AddManifest(repo, tag, oci.MediaTypeOCIIndex, data)
+}
+
+// AddArtifact stores an OCI artifact whose subject is the manifest with the
+// given digest, under an optional tag, and returns the artifact digest
+func (s *RegistryServer) AddArtifact(repo, tag, subjectDigest, artifactType string, content []byte) string {
+	subject, _ := s.Manifest(repo, subjectDigest)
+	manifest := oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeOCIManifest,
+		ArtifactType:  artifactType,
+		Config:        s.AddBlob(repo, "application/vnd.oci.empty.v1+json", []byte("{}")),
+		Layers:        []oci.Descriptor{s.AddBlob(repo, artifactType, content)},
+		Subject: &oci.Descriptor{
+			MediaType: subject.MediaType,
+			Digest:    subjectDigest,
+			Size:      int64(len(subject.Data)),
+		},
+	}
+
+	data, _ := json.Marshal(manifest)
+	return s.AddManifest(repo, tag, oci.MediaTypeOCIManifest, data)
+}
+
+// HasBlob reports whether a repository holds a blob
+func (s *RegistryServer) HasBlob(repo, digest string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.repoBlobs[repo][digest]
+}
+
+// Blob returns the content of a stored blob
+func (s *RegistryServer) Blob(digest string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.blobs[digest]
+	return data, ok
+}
+
+// ReplaceBlob serves other content under the digest of a stored blob, like
+// a registry whose storage is corrupt
+func (s *RegistryServer) ReplaceBlob(digest string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[digest] = data
+}
+
+// Manifest returns a stored manifest by tag or digest
+func (s *RegistryServer) Manifest(repo, reference string) (StoredManifest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.manifests[repo][reference]
+	return m, ok
+}
+
+func (s *RegistryServer) storeBlob(repo, digest string, data []byte) {
+	s.blobs[digest] = data
+	if s.repoBlobs[repo] == nil {
+		s.repoBlobs[repo] = make(map[string]bool)
+	}
+	s.repoBlobs[repo][digest] = true
+}
+
+func (s *RegistryServer) storeManifest(repo, reference string, m StoredManifest) {
+	if s.manifests[repo] == nil {
+		s.manifests[repo] = make(map[string]StoredManifest)
+	}
+	s.manifests[repo][reference] = m
+}
+
+// handle routes distribution API requests
+func (s *RegistryServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		s.handleToken(w, r)
+		return
+	}
+
+	if s.BasicAuth {
+		if username, password, _ := r.BasicAuth(); username != s.Username || password != s.Password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mock-registry"`)
+			writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+			return
+		}
+	} else if s.Username != "" && r.Header.Get("Authorization") != "Bearer test-token" {
+		w.Header().Set("WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="%s/token",service="mock-registry"`, s.URL))
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if path == "" || path == r.URL.Path {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch {
+	case path == "_catalog":
+		s.handleList(w, r, "repositories", s.repositories())
+	case strings.HasSuffix(path, "/tags/list"):
+		s.handleList(w, r, "tags", s.tags(strings.TrimSuffix(path, "/tags/list")))
+	case strings.Contains(path, "/referrers/"):
+		idx := strings.LastIndex(path, "/referrers/")
+		s.handleReferrers(w, r, path[:idx], path[idx+len("/referrers/"):])
+	case strings.Contains(path, "/manifests/"):
+		idx := strings.LastIndex(path, "/manifests/")
+		s.handleManifest(w, r, path[:idx], path[idx+len("/manifests/"):])
+	case strings.Contains(path, "/blobs/uploads/"):
+		idx := strings.LastIndex(path, "/blobs/uploads/")
+		s.handleUpload(w, r, path[:idx], path[idx+len("/blobs/uploads/"):])
+	case strings.Contains(path, "/blobs/"):
+		idx := strings.LastIndex(path, "/blobs/")
+		s.handleBlob(w, r, path[:idx], path[idx+len("/blobs/"):])
+	default:
+		writeRegistryError(w, http.StatusNotFound, "NAME_UNKNOWN", "unknown route")
+	}
+}
+
+func (s *RegistryServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || username != s.Username || password != s.Password {
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+		return
+	}
+
+	s.mu.Lock()
+	s.TokenIssued++
+	s.TokenScopes = append(s.TokenScopes, r.URL.Query().Get("scope"))
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"token":"test-token","expires_in":300}`))
+}
+
+// repositories returns the sorted names of the repositories holding manifests
+func (s *RegistryServer) repositories() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.manifests))
+	for repo := range s.manifests {
+		names = append(names, repo)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tags returns the sorted tags of a repository, nil when it doesn't exist
+func (s *RegistryServer) tags(repo string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	manifests, ok := s.manifests[repo]
+	if !ok {
+		return nil
+	}
+	tags := make([]string, 0, len(manifests))
+	for reference := range manifests {
+		if !strings.HasPrefix(reference, "sha256:") {
+			tags = append(tags, reference)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// handleList serves a page of a sorted list after the last query parameter,
+// linking the next page when PageSize cuts it short
+func (s *RegistryServer) handleList(w http.ResponseWriter, r *http.Request, key string, items []string) {
+	if items == nil {
+		writeRegistryError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+
+	if last := r.URL.Query().Get("last"); last != "" {
+		items = items[sort.SearchStrings(items, last):]
+		if len(items) > 0 && items[0] == last {
+			items = items[1:]
+		}
+	}
+	if s.PageSize > 0 && len(items) > s.PageSize {
+		items = items[:s.PageSize]
+		w.Header().Set("Link", fmt.Sprintf(`<%s?n=%d&last=%s>; rel="next"`, r.URL.Path, s.PageSize, items[len(items)-1]))
+	}
+
+	data, _ := json.Marshal(map[string][]string{key: items})
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func (s *RegistryServer) handleManifest(w http.ResponseWriter, r *http.Request, repo, reference string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		m, ok := s.manifests[repo][reference]
+		if !ok {
+			writeRegistryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		w.Header().Set("Content-Type", m.MediaType)
+		w.Header().Set("Docker-Content-Digest", oci.ComputeDigest(m.Data))
+		w.Header().Set("Content-Length", fmt.Sprint(len(m.Data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(m.Data)
+		}
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeRegistryError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		digest := oci.ComputeDigest(data)
+		if strings.HasPrefix(reference, "sha256:") && reference != digest {
+			writeRegistryError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match content")
+			return
+		}
+		if s.RewriteTaggedManifests && !strings.HasPrefix(reference, "sha256:") {
+			data = append(data, '\n')
+			digest = oci.ComputeDigest(data)
+		}
+		m := StoredManifest{MediaType: r.Header.Get("Content-Type"), Data: data}
+		s.storeManifest(repo, digest, m)
+		s.storeManifest(repo, reference, m)
+		s.ManifestPuts++
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *RegistryServer) handleReferrers(w http.ResponseWriter, r *http.Request, repo, digest string) {
+	if s.DenyReferrers {
+		writeRegistryError(w, http.StatusForbidden, "DENIED", "requested access to the resource is denied")
+		return
+	}
+	if !s.ReferrersAPI || r.Method != http.MethodGet {
+		writeRegistryError(w, http.StatusNotFound, "NAME_UNKNOWN", "unknown route")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := oci.Index{SchemaVersion: 2, MediaType: oci.MediaTypeOCIIndex, Manifests: []oci.Descriptor{}}
+	for reference, m := range s.manifests[repo] {
+		if !strings.HasPrefix(reference, "sha256:") {
+			continue
+		}
+		manifest, err := oci.ParseManifest(m.Data)
+		if err != nil || manifest.Subject == nil || manifest.Subject.Digest != digest {
+			continue
+		}
+		index.Manifests = append(index.Manifests, oci.Descriptor{
+			MediaType:    m.MediaType,
+			Digest:       reference,
+			Size:         int64(len(m.Data)),
+			ArtifactType: manifest.ArtifactType,
+		})
+	}
+
+	data, _ := json.Marshal(index)
+	w.Header().Set("Content-Type", oci.MediaTypeOCIIndex)
+	_, _ = w.Write(data)
+}
+
+func (s *RegistryServer) handleBlob(w http.ResponseWriter, r *http.Request, repo, digest string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.repoBlobs[repo][digest] {
+		writeRegistryError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+		return
+	}
+
+	data := s.blobs[digest]
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		s.BlobGets++
+		_, _ = w.Write(data)
+	}
+}
+
+func (s *RegistryServer) handleUpload(w http.ResponseWriter, r *http.Request, repo, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		if mount, from := r.URL.Query().Get("mount"), r.URL.Query().Get("from"); mount != "" && !s.RefuseMounts {
+			if s.repoBlobs[from][mount] {
+				s.storeBlob(repo, mount, s.blobs[mount])
+				s.BlobMounts++
+				w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo, mount))
+				w.Header().Set("Docker-Content-Digest", mount)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		s.nextID++
+		id = fmt.Sprintf("upload-%d", s.nextID)
+		s.uploads[id] = &bytes.Buffer{}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPatch, http.MethodPut:
+		buf, ok := s.uploads[id]
+		if !ok {
+			writeRegistryError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload unknown")
+			return
+		}
+		if _, err := io.Copy(buf, r.Body); err != nil {
+			writeRegistryError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		if r.Method == http.MethodPatch {
+			w.Header().Set("Location", r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		digest := r.URL.Query().Get("digest")
+		if oci.ComputeDigest(buf.Bytes()) != digest {
+			writeRegistryError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match content")
+			return
+		}
+		s.storeBlob(repo, digest, buf.Bytes())
+		delete(s.uploads, id)
+		s.BlobUploads++
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeRegistryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
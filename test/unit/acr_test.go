@@ -0,0 +1,198 @@
+package unit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/registry"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// newACRStub starts an ACR stub accepting the AAD token aad-token
+func newACRStub(t *testing.T) *mocks.ACRServer {
+	server := mocks.NewACRServer("aad-token")
+	t.Cleanup(server.Close)
+	server.Registry.AddImage("mirror/nginx", "latest", []byte("layer"))
+	server.Registry.AddImage("mirror/redis", "7", []byte("layer"))
+	return server
+}
+
+// TestACRRegistry tests signing in to ACR with AAD, refresh and admin tokens
+func TestACRRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("AAD Token Exchange", func(t *testing.T) {
+		server := newACRStub(t)
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, AccessToken: "aad-token"}, registry.ACROptions{})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+		tags, err := client.GetImageTags(ctx, "mirror/nginx")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"latest"}, tags)
+		assert.Equal(t, 1, server.ExchangeCalls)
+
+		username, password, err := client.Login(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "00000000-0000-0000-0000-000000000000", username)
+		assert.NotEmpty(t, password)
+		assert.Equal(t, 1, server.ExchangeCalls)
+	})
+
+	t.Run("Tenant", func(t *testing.T) {
+		server := newACRStub(t)
+		server.Tenant = "contoso"
+
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, AccessToken: "aad-token"}, registry.ACROptions{Tenant: "contoso"})
+		defer client.Close()
+		require.NoError(t, client.Auth(ctx))
+
+		other := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, AccessToken: "aad-token"}, registry.ACROptions{})
+		defer other.Close()
+		assert.True(t, errors.IsAuthError(other.Auth(ctx)))
+	})
+
+	t.Run("Refresh Token", func(t *testing.T) {
+		server := newACRStub(t)
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, RefreshToken: server.IssueRefreshToken(time.Hour)}, registry.ACROptions{})
+		defer client.Close()
+
+		_, err := client.GetImageManifest(ctx, "mirror/nginx", "latest")
+		require.NoError(t, err)
+		assert.Zero(t, server.ExchangeCalls)
+	})
+
+	t.Run("Caches Access Tokens Per Scope", func(t *testing.T) {
+		server := newACRStub(t)
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, AccessToken: "aad-token"}, registry.ACROptions{})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+		for _, repository := range []string{"mirror/nginx", "mirror/redis", "mirror/nginx"} {
+			_, err := client.GetImageTags(ctx, repository)
+			require.NoError(t, err)
+		}
+		_, err := client.GetImageManifest(ctx, "mirror/redis", "7")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"", "repository:mirror/nginx:pull", "repository:mirror/redis:pull"}, server.TokenScopes)
+		assert.Equal(t, 1, server.ExchangeCalls)
+	})
+
+	t.Run("Refreshes Expiring Tokens", func(t *testing.T) {
+		server := newACRStub(t)
+		server.RefreshTTL = 2 * time.Minute
+		server.AccessTTL = 2 * time.Minute
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, AccessToken: "aad-token"}, registry.ACROptions{})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+		_, err := client.GetImageTags(ctx, "mirror/nginx")
+		require.NoError(t, err)
+		assert.Equal(t, 2, server.ExchangeCalls)
+	})
+
+	t.Run("Admin Credentials", func(t *testing.T) {
+		server := newACRStub(t)
+		server.AdminUsername = "mirror"
+		server.AdminPassword = "admin-password"
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, Username: "mirror", Password: "admin-password"}, registry.ACROptions{})
+		defer client.Close()
+
+		tags, err := client.GetImageTags(ctx, "mirror/redis")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"7"}, tags)
+		assert.Zero(t, server.ExchangeCalls)
+
+		username, password, err := client.Login(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "mirror", username)
+		assert.Equal(t, "admin-password", password)
+	})
+
+	t.Run("Rejected AAD Token", func(t *testing.T) {
+		server := newACRStub(t)
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, AccessToken: "other-token"}, registry.ACROptions{})
+		defer client.Close()
+
+		err := client.Auth(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+		assert.Contains(t, err.Error(), "invalid_grant")
+	})
+
+	t.Run("Expired AAD Token", func(t *testing.T) {
+		server := newACRStub(t)
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, AccessToken: "aad-token",
+			TokenExpiration: time.Now().Add(-time.Minute)}, registry.ACROptions{})
+		defer client.Close()
+
+		err := client.Auth(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+		assert.Zero(t, server.ExchangeCalls)
+	})
+
+	t.Run("No Credentials", func(t *testing.T) {
+		server := newACRStub(t)
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL}, registry.ACROptions{})
+		defer client.Close()
+
+		err := client.Auth(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+	})
+}
+
+// TestSyncerV2PushesWithRefreshToken tests that pushes to ACR log in with the refresh token
+func TestSyncerV2PushesWithRefreshToken(t *testing.T) {
+	newConfig := func(repository string) *config.Config {
+		return &config.Config{
+			Repository:  repository,
+			Namespace:   "mirror",
+			Content:     `{"hubsync": ["nginx:latest"]}`,
+			MaxContent:  10,
+			OutputPath:  filepath.Join(t.TempDir(), "output.log"),
+			Concurrency: 1,
+			Timeout:     10 * time.Second,
+			Insecure:    true,
+		}
+	}
+
+	t.Run("Daemon", func(t *testing.T) {
+		server := newACRStub(t)
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, AccessToken: "aad-token"}, registry.ACROptions{})
+		defer client.Close()
+
+		dockerClient := mocks.NewMockDockerClient()
+		dockerClient.Login = client.Login
+		require.NoError(t, sync.NewSyncerV2(newConfig(server.Host()), dockerClient, client).Run(context.Background()))
+		assert.Equal(t, []string{"00000000-0000-0000-0000-000000000000"}, dockerClient.PushUsers)
+	})
+
+	t.Run("Registry", func(t *testing.T) {
+		server := newACRStub(t)
+		source := mocks.NewRegistryServer()
+		defer source.Close()
+		source.AddImage("library/nginx", "latest", []byte("layer"))
+
+		client := registry.NewACRRegistry(registry.RegistryConfig{URL: server.URL, AccessToken: "aad-token"}, registry.ACROptions{})
+		defer client.Close()
+
+		cfg := newConfig(server.Host())
+		cfg.Transport = transfer.TransportRegistry
+		cfg.Content = `{"hubsync": ["` + source.Host() + `/library/nginx:latest"]}`
+
+		require.NoError(t, sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), client).Run(context.Background()))
+		_, ok := server.Registry.Manifest("mirror/nginx", "latest")
+		assert.True(t, ok)
+	})
+}
@@ -0,0 +1,318 @@
+package unit
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// readTar returns the files of a tarball keyed by name
+func readTar(t *testing.T, path string) map[string][]byte {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = data
+	}
+	return files
+}
+
+// TestParseLocation tests parsing of oci: and docker-archive: locations
+func TestParseLocation(t *testing.T) {
+	loc, ok := archive.ParseLocation("oci:/mnt/export:mirror/nginx:latest")
+	require.True(t, ok)
+	assert.Equal(t, archive.Location{Scheme: archive.SchemeOCI, Path: "/mnt/export", Ref: "mirror/nginx:latest"}, loc)
+
+	loc, ok = archive.ParseLocation("docker-archive:/mnt/images.tar")
+	require.True(t, ok)
+	assert.Equal(t, archive.SchemeDockerArchive, loc.Scheme)
+	assert.Equal(t, "/mnt/images.tar", loc.Path)
+	assert.Empty(t, loc.Ref)
+	assert.Equal(t, "docker-archive:/mnt/images.tar:mirror/nginx:1.25", loc.WithRef("mirror/nginx:1.25").String())
+
+	_, ok = archive.ParseLocation("registry.example.com:5000/mirror/nginx:latest")
+	assert.False(t, ok)
+
+	// Docker Hub images named like a scheme are not locations
+	_, ok = archive.ParseLocation("oci:1.0")
+	assert.False(t, ok)
+	_, ok = archive.ParseLocation("docker-archive:latest")
+	assert.False(t, ok)
+
+	loc, ok = archive.ParseLocation("oci:./export:mirror/nginx:latest")
+	require.True(t, ok)
+	assert.Equal(t, archive.Location{Scheme: archive.SchemeOCI, Path: "./export", Ref: "mirror/nginx:latest"}, loc)
+
+	// Paths that don't start like one need the explicit form
+	loc, ok = archive.ParseLocation("oci://export:mirror/nginx:latest")
+	require.True(t, ok)
+	assert.Equal(t, archive.Location{Scheme: archive.SchemeOCI, Path: "export", Ref: "mirror/nginx:latest"}, loc)
+	assert.Equal(t, "oci://export:mirror/nginx:latest", loc.String())
+
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+	loc, ok = archive.ParseLocation("oci:~/export")
+	require.True(t, ok)
+	assert.Equal(t, filepath.Join(home, "export"), loc.Path)
+}
+
+// TestRegistryEngineExportLayout tests exporting images to an OCI image layout
+func TestRegistryEngineExportLayout(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+
+	digest := src.AddMultiArchImage("library/nginx", "latest", "linux/amd64", "linux/arm64")
+	dir := filepath.Join(t.TempDir(), "layout")
+
+	engine := newTestEngine(nil)
+	report, err := engine.Transfer(context.Background(),
+		&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+		&docker.ImageReference{FullName: "oci:" + dir + ":testns/nginx:latest"},
+	)
+	require.NoError(t, err)
+	require.NoError(t, engine.Close())
+	assert.True(t, report.ChecksumOK)
+	assert.Equal(t, digest, report.TargetDigest)
+
+	layout, err := archive.OpenLayout(dir)
+	require.NoError(t, err)
+	images := layout.Images()
+	require.Len(t, images, 1)
+	assert.Equal(t, digest, images[0].Digest)
+	assert.Equal(t, "testns/nginx:latest", images[0].Annotations[archive.AnnotationRefName])
+
+	// Every child manifest and blob is in the layout
+	data, _, err := layout.GetManifest("testns/nginx:latest")
+	require.NoError(t, err)
+	index, err := oci.ParseIndex(data)
+	require.NoError(t, err)
+	for _, child := range index.Manifests {
+		childData, _, err := layout.GetManifest(child.Digest)
+		require.NoError(t, err)
+		manifest, err := oci.ParseManifest(childData)
+		require.NoError(t, err)
+		assert.True(t, layout.HasBlob(manifest.Config.Digest))
+		for _, layer := range manifest.Layers {
+			assert.True(t, layout.HasBlob(layer.Digest))
+		}
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "oci-layout"))
+	assert.NoError(t, err)
+}
+
+// TestSyncerV2ExportArchives tests exporting through --repository and per-image repositories
+func TestSyncerV2ExportArchives(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+
+	src.AddMultiArchImage("library/nginx", "latest", "linux/amd64", "linux/arm64")
+	src.AddImage("library/alpine", "3.18", []byte("alpine-layer"))
+
+	dir := t.TempDir()
+	tarball := filepath.Join(dir, "images.tar")
+	layoutDir := filepath.Join(dir, "layout")
+	outputPath := filepath.Join(dir, "output.log")
+
+	cfg := &config.Config{
+		Repository: "docker-archive:" + tarball,
+		Namespace:  "testns",
+		Content: `{"hubsync": ["` + src.Host() + `/library/nginx:latest", ` +
+			`{"image": "` + src.Host() + `/library/alpine:3.18", "repository": "oci:` + layoutDir + `"}]}`,
+		MaxContent:  10,
+		OutputPath:  outputPath,
+		Concurrency: 2,
+		Timeout:     10 * time.Second,
+		Transport:   transfer.TransportDaemon,
+		Insecure:    true,
+		Platforms:   []string{"linux/arm64"},
+	}
+
+	// Archives bypass the daemon even when it is the configured transport
+	mockDockerClient := mocks.NewMockDockerClient()
+	syncer := sync.NewSyncerV2(cfg, mockDockerClient, mocks.NewMockRegistryClient())
+	require.NoError(t, syncer.Run(context.Background()))
+	assert.Equal(t, 2, syncer.GetProcessedImageCount())
+	assert.Empty(t, mockDockerClient.PulledImages)
+
+	// The tarball holds a single-platform image that docker load understands
+	files := readTar(t, tarball)
+	var entries []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, []string{"testns/nginx:latest"}, entries[0].RepoTags)
+	assert.Contains(t, files, entries[0].Config)
+	require.Len(t, entries[0].Layers, 1)
+	assert.Equal(t, []byte("layer-linux/arm64"), files[entries[0].Layers[0]])
+	assert.Contains(t, files, "index.json")
+	assert.Contains(t, files, "oci-layout")
+
+	// The staging directory is gone
+	leftovers, err := filepath.Glob(filepath.Join(dir, ".hubsync-archive-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+
+	layout, err := archive.OpenLayout(layoutDir)
+	require.NoError(t, err)
+	_, ok := layout.Resolve("testns/alpine:3.18")
+	assert.True(t, ok)
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# Exported docker-archive:"+tarball+":testns/nginx:latest")
+	assert.Contains(t, string(data), "# Exported oci:"+layoutDir+":testns/alpine:3.18")
+	assert.NotContains(t, string(data), "docker login")
+}
+
+// writeTar writes files to a new tarball
+func writeTar(t *testing.T, path string, files map[string][]byte) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	tw := tar.NewWriter(file)
+	for name, data := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+}
+
+// TestSyncerV2ImportArchives tests pushing images read from a layout and a tarball
+func TestSyncerV2ImportArchives(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+
+	nginx := src.AddMultiArchImage("library/nginx", "latest", "linux/amd64", "linux/arm64")
+	alpine := src.AddImage("library/alpine", "3.18", []byte("alpine-layer"))
+
+	dir := t.TempDir()
+	layoutDir := filepath.Join(dir, "layout")
+	tarball := filepath.Join(dir, "images.tar")
+
+	// Prepare the archives on the outside
+	engine := newTestEngine(nil)
+	exports := map[string]string{
+		"library/nginx:latest": "oci:" + layoutDir + ":outside/nginx:latest",
+		"library/alpine:3.18":  "oci:" + layoutDir + ":outside/alpine:3.18",
+	}
+	for name, target := range exports {
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/" + name},
+			&docker.ImageReference{FullName: target})
+		require.NoError(t, err)
+	}
+	_, err := engine.Transfer(context.Background(),
+		&docker.ImageReference{FullName: src.Host() + "/library/alpine:3.18"},
+		&docker.ImageReference{FullName: "docker-archive:" + tarball + ":outside/alpine:3.18"})
+	require.NoError(t, err)
+	require.NoError(t, engine.Close())
+
+	// Push them on the inside, listing every image of the layout
+	outputPath := filepath.Join(dir, "output.log")
+	cfg := &config.Config{
+		Repository: dst.Host(),
+		Namespace:  "inside",
+		Content: `{"hubsync": ["oci:` + layoutDir + `", ` +
+			`"docker-archive:` + tarball + `:outside/alpine:3.18$alpine-from-tar"]}`,
+		MaxContent:  10,
+		OutputPath:  outputPath,
+		Concurrency: 1,
+		Timeout:     10 * time.Second,
+		Transport:   transfer.TransportRegistry,
+		Insecure:    true,
+	}
+
+	syncer := sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient())
+	require.NoError(t, syncer.Run(context.Background()))
+	assert.Equal(t, 3, syncer.GetProcessedImageCount())
+
+	stored, ok := dst.Manifest("inside/nginx", "latest")
+	require.True(t, ok)
+	assert.Equal(t, nginx, oci.ComputeDigest(stored.Data))
+
+	stored, ok = dst.Manifest("inside/alpine", "3.18")
+	require.True(t, ok)
+	assert.Equal(t, alpine, oci.ComputeDigest(stored.Data))
+
+	stored, ok = dst.Manifest("inside/alpine-from-tar", "3.18")
+	require.True(t, ok)
+	assert.Equal(t, alpine, oci.ComputeDigest(stored.Data))
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "docker pull "+dst.Host()+"/inside/nginx:latest # (from oci:"+layoutDir+":outside/nginx:latest")
+}
+
+// TestRegistryEngineImportLegacyDockerArchive tests reading a tarball without an image layout
+func TestRegistryEngineImportLegacyDockerArchive(t *testing.T) {
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("legacy-layer")
+	tarball := filepath.Join(t.TempDir(), "legacy.tar")
+	writeTar(t, tarball, map[string][]byte{
+		"manifest.json": []byte(`[{"Config":"config.json","RepoTags":["legacy/app:1.0"],"Layers":["abc/layer.tar"]}]`),
+		"config.json":   config,
+		"abc/layer.tar": layer,
+		"abc/VERSION":   []byte("1.0"),
+		"repositories":  []byte(`{}`),
+	})
+
+	engine := newTestEngine(nil)
+	report, err := engine.Transfer(context.Background(),
+		&docker.ImageReference{FullName: "docker-archive:" + tarball + ":legacy/app:1.0"},
+		&docker.ImageReference{FullName: dst.Host() + "/mirror/app:1.0"})
+	require.NoError(t, err)
+	require.NoError(t, engine.Close())
+	assert.True(t, report.ChecksumOK)
+	assert.Equal(t, int64(len(config)+len(layer)), report.BytesMoved)
+
+	stored, ok := dst.Manifest("mirror/app", "1.0")
+	require.True(t, ok)
+	manifest, err := oci.ParseManifest(stored.Data)
+	require.NoError(t, err)
+	assert.Equal(t, oci.ComputeDigest(config), manifest.Config.Digest)
+	require.Len(t, manifest.Layers, 1)
+	assert.Equal(t, oci.ComputeDigest(layer), manifest.Layers[0].Digest)
+	assert.True(t, dst.HasBlob("mirror/app", manifest.Layers[0].Digest))
+
+	// A name that isn't in the archive fails clearly
+	_, err = engine.Transfer(context.Background(),
+		&docker.ImageReference{FullName: "docker-archive:" + tarball + ":legacy/other:1.0"},
+		&docker.ImageReference{FullName: dst.Host() + "/mirror/other:1.0"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+const (
+	helmConfigType = "application/vnd.cncf.helm.config.v1+json"
+	helmChartType  = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	wasmType       = "application/vnd.wasm.content.layer.v1+wasm"
+)
+
+// addHelmChart stores a Helm chart the way helm push does and returns its digest
+func addHelmChart(s *mocks.RegistryServer, repo, tag string) string {
+	manifest := oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeOCIManifest,
+		Config:        s.AddBlob(repo, helmConfigType, []byte(`{"name":"podinfo","version":"6.5.0"}`)),
+		Layers:        []oci.Descriptor{s.AddBlob(repo, helmChartType, []byte("chart-archive"))},
+		Annotations:   map[string]string{"org.opencontainers.image.title": "podinfo"},
+	}
+	data, _ := json.Marshal(manifest)
+	return s.AddManifest(repo, tag, oci.MediaTypeOCIManifest, data)
+}
+
+// TestRegistryEngineArtifacts tests copying OCI artifacts that are not images
+func TestRegistryEngineArtifacts(t *testing.T) {
+	t.Run("Helm Chart", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		digest := addHelmChart(src, "charts/podinfo", "6.5.0")
+
+		report, err := newTestEngine(nil).Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/charts/podinfo:6.5.0"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/podinfo:6.5.0"})
+		require.NoError(t, err)
+		assert.Equal(t, helmConfigType, report.ArtifactType)
+		assert.True(t, report.ChecksumOK)
+
+		// Copied byte for byte, annotations included
+		stored, ok := dst.Manifest("mirror/podinfo", "6.5.0")
+		require.True(t, ok)
+		assert.Equal(t, digest, oci.ComputeDigest(stored.Data))
+		assert.True(t, dst.HasBlob("mirror/podinfo", oci.ComputeDigest([]byte("chart-archive"))))
+	})
+
+	t.Run("Artifact Manifest With Blobs", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		module := src.AddBlob("wasm/hello", wasmType, []byte("wasm-module"))
+		data, _ := json.Marshal(map[string]interface{}{
+			"mediaType":    oci.MediaTypeOCIArtifactManifest,
+			"artifactType": "application/vnd.module.wasm.config.v1+json",
+			"blobs":        []oci.Descriptor{module},
+		})
+		src.AddManifest("wasm/hello", "v1", oci.MediaTypeOCIArtifactManifest, data)
+
+		report, err := newTestEngine(nil).Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/wasm/hello:v1"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/hello:v1"})
+		require.NoError(t, err)
+		assert.Equal(t, "application/vnd.module.wasm.config.v1+json", report.ArtifactType)
+		assert.True(t, dst.HasBlob("mirror/hello", module.Digest))
+
+		stored, ok := dst.Manifest("mirror/hello", "v1")
+		require.True(t, ok)
+		assert.Equal(t, oci.MediaTypeOCIArtifactManifest, stored.MediaType)
+	})
+
+	t.Run("Images Have No Artifact Type", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		src.AddImage("library/nginx", "latest", []byte("nginx-layer"))
+
+		report, err := newTestEngine(nil).Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+		require.NoError(t, err)
+		assert.Empty(t, report.ArtifactType)
+	})
+
+	t.Run("Layout Export", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+
+		addHelmChart(src, "charts/podinfo", "6.5.0")
+		dir := filepath.Join(t.TempDir(), "layout")
+
+		engine := newTestEngine(nil)
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/charts/podinfo:6.5.0"},
+			&docker.ImageReference{FullName: "oci:" + dir + ":mirror/podinfo:6.5.0"})
+		require.NoError(t, err)
+		require.NoError(t, engine.Close())
+
+		layout, err := archive.ReadLayout(dir)
+		require.NoError(t, err)
+		images := layout.Images()
+		require.Len(t, images, 1)
+		assert.Equal(t, helmConfigType, images[0].ArtifactType)
+	})
+
+	t.Run("Docker Archive Refuses Artifacts", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+
+		addHelmChart(src, "charts/podinfo", "6.5.0")
+
+		engine := newTestEngine(nil)
+		defer engine.Close()
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/charts/podinfo:6.5.0"},
+			&docker.ImageReference{FullName: "docker-archive:" + filepath.Join(t.TempDir(), "charts.tar") + ":mirror/podinfo:6.5.0"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "docker-archive can't hold")
+	})
+}
+
+// TestSyncerV2Artifacts tests that artifacts are reported with their type
+func TestSyncerV2Artifacts(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+
+	addHelmChart(src, "charts/podinfo", "6.5.0")
+	src.AddImage("library/nginx", "latest", []byte("nginx-layer"))
+
+	outputPath := filepath.Join(t.TempDir(), "output.log")
+	cfg := &config.Config{
+		Repository:  dst.Host(),
+		Namespace:   "mirror",
+		Content:     `{"hubsync": ["` + src.Host() + `/charts/podinfo:6.5.0", "` + src.Host() + `/library/nginx:latest"]}`,
+		MaxContent:  10,
+		OutputPath:  outputPath,
+		Concurrency: 1,
+		Timeout:     10 * time.Second,
+		Transport:   transfer.TransportRegistry,
+		Insecure:    true,
+	}
+	require.NoError(t, sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient()).Run(context.Background()))
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	output := string(data)
+	assert.Contains(t, output, "# Mirrored "+dst.Host()+"/mirror/podinfo:6.5.0 (from "+src.Host()+"/charts/podinfo:6.5.0")
+	assert.Contains(t, output, "# Artifact type: "+helmConfigType)
+	assert.NotContains(t, output, "docker pull "+dst.Host()+"/mirror/podinfo")
+	assert.Contains(t, output, "docker pull "+dst.Host()+"/mirror/nginx:latest")
+}
@@ -0,0 +1,153 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/bandwidth"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// TestLimiter tests the token bucket rate limiter
+func TestLimiter(t *testing.T) {
+	t.Run("Unlimited", func(t *testing.T) {
+		assert.Nil(t, bandwidth.NewLimiter(0))
+
+		var limiter *bandwidth.Limiter
+		assert.NoError(t, limiter.WaitN(context.Background(), 1<<30))
+		assert.Zero(t, limiter.Rate())
+	})
+
+	t.Run("Waits Off Borrowed Bytes", func(t *testing.T) {
+		limiter := bandwidth.NewLimiter(100 << 10)
+
+		// A full second of bytes passes right away, the next half second waits
+		start := time.Now()
+		require.NoError(t, limiter.WaitN(context.Background(), 100<<10))
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+		require.NoError(t, limiter.WaitN(context.Background(), 50<<10))
+		assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	})
+
+	t.Run("Context Cancelled", func(t *testing.T) {
+		limiter := bandwidth.NewLimiter(1 << 10)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := limiter.WaitN(ctx, 10<<10)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+// TestLimits tests global and per-registry limits and throughput
+func TestLimits(t *testing.T) {
+	t.Run("Registry Limits Only Apply To Their Registry", func(t *testing.T) {
+		limits := bandwidth.NewLimits(0, map[string]int64{"ghcr.io": 64 << 10})
+		assert.True(t, limits.Limited())
+
+		content := bytes.Repeat([]byte("x"), 96<<10)
+
+		start := time.Now()
+		_, err := io.Copy(io.Discard, limits.Reader(context.Background(), bytes.NewReader(content), "docker.io"))
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+		start = time.Now()
+		_, err = io.Copy(io.Discard, limits.Reader(context.Background(), bytes.NewReader(content), "ghcr.io"))
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	})
+
+	t.Run("Throughput By Registry", func(t *testing.T) {
+		limits := bandwidth.NewLimits(0, nil)
+		assert.False(t, limits.Limited())
+
+		require.NoError(t, limits.Wait(context.Background(), 1000, "index.docker.io", "ghcr.io"))
+		require.NoError(t, limits.Wait(context.Background(), 500, "docker.io"))
+
+		rates := limits.Throughput()
+		assert.Greater(t, rates[bandwidth.Total], 0.0)
+		assert.Greater(t, rates["docker.io"], rates["ghcr.io"])
+		assert.NotContains(t, rates, "index.docker.io")
+
+		// Idle registries are still reported, at zero
+		rates = limits.Throughput()
+		assert.Contains(t, rates, "ghcr.io")
+		assert.Zero(t, rates["ghcr.io"])
+	})
+
+	t.Run("Nil Limits", func(t *testing.T) {
+		var limits *bandwidth.Limits
+		reader := bytes.NewReader([]byte("content"))
+		assert.Same(t, reader, limits.Reader(context.Background(), reader, "docker.io"))
+		assert.NoError(t, limits.Wait(context.Background(), 1<<30))
+		assert.Nil(t, limits.Throughput())
+	})
+}
+
+// TestRegistryEngineBandwidth tests that registry copies are limited and measured
+func TestRegistryEngineBandwidth(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+
+	layer := bytes.Repeat([]byte("layer"), 20<<10)
+	src.AddImage("library/nginx", "latest", layer)
+
+	limits := bandwidth.NewLimits(0, map[string]int64{src.Host(): 64 << 10})
+	engine := newTestEngine(nil)
+	engine.SetBandwidth(limits)
+
+	start := time.Now()
+	_, err := engine.Transfer(context.Background(),
+		&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+		&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	rates := limits.Throughput()
+	assert.Greater(t, rates[src.Host()], 0.0)
+	assert.Greater(t, rates[dst.Host()], 0.0)
+}
+
+// TestSyncerV2SharesBandwidth tests that registry copies are charged to the
+// limits of the Docker client
+func TestSyncerV2SharesBandwidth(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+	src.AddImage("library/nginx", "latest", []byte("layer"))
+
+	client := mocks.NewMockDockerClient()
+	client.Limits = bandwidth.NewLimits(10<<20, nil)
+	cfg := &config.Config{
+		Repository:  dst.Host(),
+		Namespace:   "mirror",
+		Content:     `{"hubsync": ["` + src.Host() + `/library/nginx:latest"]}`,
+		MaxContent:  10,
+		OutputPath:  filepath.Join(t.TempDir(), "output.log"),
+		Concurrency: 1,
+		Timeout:     10 * time.Second,
+		Transport:   transfer.TransportRegistry,
+		Insecure:    true,
+	}
+
+	syncer := sync.NewSyncerV2(cfg, client, mocks.NewMockRegistryClient())
+	require.NoError(t, syncer.Run(context.Background()))
+	assert.Equal(t, 1, syncer.GetProcessedImageCount())
+
+	// The syncer samples the rates when it finishes, the registries stay listed
+	assert.Contains(t, client.Limits.Throughput(), src.Host())
+}
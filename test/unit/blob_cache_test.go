@@ -0,0 +1,167 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/pkg/cache"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// storeBlob writes data to the cache through a blob writer
+func storeBlob(t *testing.T, c *cache.BlobCache, data []byte) string {
+	t.Helper()
+
+	digest := oci.ComputeDigest(data)
+	writer, err := c.Writer(digest, int64(len(data)))
+	require.NoError(t, err)
+	require.NotNil(t, writer)
+	_, err = io.Copy(writer, bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NoError(t, writer.Commit())
+	return digest
+}
+
+// TestBlobCache tests the on-disk blob cache
+func TestBlobCache(t *testing.T) {
+	t.Run("Hit And Miss", func(t *testing.T) {
+		c, err := cache.NewBlobCache(t.TempDir(), 0)
+		require.NoError(t, err)
+
+		_, _, ok := c.Open(oci.ComputeDigest([]byte("missing")))
+		assert.False(t, ok)
+
+		digest := storeBlob(t, c, []byte("layer"))
+		content, size, ok := c.Open(digest)
+		require.True(t, ok)
+		defer content.Close()
+
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		assert.Equal(t, "layer", string(data))
+		assert.Equal(t, int64(5), size)
+
+		stats := c.Stats()
+		assert.Equal(t, int64(1), stats.Hits)
+		assert.Equal(t, int64(1), stats.Misses)
+	})
+
+	t.Run("Reject Corrupt Content", func(t *testing.T) {
+		c, err := cache.NewBlobCache(t.TempDir(), 0)
+		require.NoError(t, err)
+
+		digest := oci.ComputeDigest([]byte("expected"))
+		writer, err := c.Writer(digest, 8)
+		require.NoError(t, err)
+		_, _ = writer.Write([]byte("tampered"))
+
+		assert.Error(t, writer.Commit())
+		_, _, ok := c.Open(digest)
+		assert.False(t, ok)
+	})
+
+	t.Run("Evict Least Recently Used", func(t *testing.T) {
+		c, err := cache.NewBlobCache(t.TempDir(), 10)
+		require.NoError(t, err)
+
+		first := storeBlob(t, c, []byte("aaaa"))
+		second := storeBlob(t, c, []byte("bbbb"))
+
+		// Touch the first blob so the second one is the oldest
+		content, _, ok := c.Open(first)
+		require.True(t, ok)
+		content.Close()
+
+		third := storeBlob(t, c, []byte("cccc"))
+
+		_, _, ok = c.Open(second)
+		assert.False(t, ok)
+		for _, digest := range []string{first, third} {
+			content, _, ok := c.Open(digest)
+			require.True(t, ok)
+			content.Close()
+		}
+		assert.Equal(t, int64(8), c.Stats().Size)
+	})
+
+	t.Run("Skip Blobs Larger Than Cache", func(t *testing.T) {
+		c, err := cache.NewBlobCache(t.TempDir(), 4)
+		require.NoError(t, err)
+
+		writer, err := c.Writer(oci.ComputeDigest([]byte("too large")), 9)
+		require.NoError(t, err)
+		assert.Nil(t, writer)
+	})
+
+	t.Run("Persist Across Runs", func(t *testing.T) {
+		dir := t.TempDir()
+		c, err := cache.NewBlobCache(dir, 0)
+		require.NoError(t, err)
+		digest := storeBlob(t, c, []byte("layer"))
+
+		reopened, err := cache.NewBlobCache(dir, 0)
+		require.NoError(t, err)
+		content, _, ok := reopened.Open(digest)
+		require.True(t, ok)
+		content.Close()
+		assert.Equal(t, 1, reopened.Stats().Entries)
+	})
+
+	t.Run("Remove Only Stale Temp Files", func(t *testing.T) {
+		dir := t.TempDir()
+		tempDir := filepath.Join(dir, "blobs", "sha256")
+		require.NoError(t, os.MkdirAll(tempDir, 0o755))
+		fresh := filepath.Join(tempDir, ".tmp-fresh")
+		stale := filepath.Join(tempDir, ".tmp-stale")
+		require.NoError(t, os.WriteFile(fresh, []byte("writing"), 0o644))
+		require.NoError(t, os.WriteFile(stale, []byte("interrupted"), 0o644))
+		old := time.Now().Add(-2 * time.Hour)
+		require.NoError(t, os.Chtimes(stale, old, old))
+
+		c, err := cache.NewBlobCache(dir, 0)
+		require.NoError(t, err)
+		assert.Zero(t, c.Stats().Entries)
+		assert.FileExists(t, fresh)
+		assert.NoFileExists(t, stale)
+	})
+}
+
+// TestRegistryEngineBlobCache tests that repeated transfers read blobs from the cache
+func TestRegistryEngineBlobCache(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+
+	src.AddImage("library/nginx", "latest", []byte("layer-one"), []byte("layer-two"))
+
+	blobCache, err := cache.NewBlobCache(t.TempDir(), 0)
+	require.NoError(t, err)
+	engine := transfer.NewRegistryEngine(oci.NewClient(oci.ClientConfig{PlainHTTP: true}), blobCache)
+
+	for _, target := range []string{"mirror-a/nginx:latest", "mirror-b/nginx:latest"} {
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/" + target},
+		)
+		require.NoError(t, err)
+	}
+
+	// Config and both layers are fetched once, the second target is served from disk
+	assert.Equal(t, 3, src.BlobGets)
+	assert.True(t, dst.HasBlob("mirror-b/nginx", oci.ComputeDigest([]byte("layer-two"))))
+
+	stats := blobCache.Stats()
+	assert.Equal(t, int64(3), stats.Hits)
+	assert.Equal(t, int64(3), stats.Misses)
+}
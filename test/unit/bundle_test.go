@@ -0,0 +1,117 @@
+package unit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/archive"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// newBundleConfig returns a registry transport config for bundle tests
+func newBundleConfig(repository, content, outputPath string) *config.Config {
+	return &config.Config{
+		Repository:  repository,
+		Namespace:   "mirror",
+		Content:     content,
+		MaxContent:  10,
+		OutputPath:  outputPath,
+		Concurrency: 1,
+		Timeout:     10 * time.Second,
+		Transport:   transfer.TransportRegistry,
+		Insecure:    true,
+	}
+}
+
+// TestDeltaBundles tests exporting a base bundle and a delta and importing them together
+func TestDeltaBundles(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+
+	nginx := src.AddMultiArchImage("library/nginx", "latest", "linux/amd64", "linux/arm64")
+	alpine := src.AddImage("library/alpine", "3.18", []byte("alpine-layer"))
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base")
+	delta := filepath.Join(dir, "delta")
+	outputPath := filepath.Join(dir, "output.log")
+
+	// Week one ships everything
+	content := `{"hubsync": ["` + src.Host() + `/library/nginx:latest", "` + src.Host() + `/library/alpine:3.18"]}`
+	cfg := newBundleConfig("oci:"+base, content, outputPath)
+	cfg.Bundle = true
+	require.NoError(t, sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient()).Run(context.Background()))
+
+	baseRecord, err := archive.ReadBundleRecord(base)
+	require.NoError(t, err)
+	assert.Equal(t, baseRecord.Blobs, baseRecord.Shipped)
+
+	// Week two adds an image and ships only what is new
+	redis := src.AddImage("library/redis", "7", []byte("redis-layer"))
+	content = `{"hubsync": ["` + src.Host() + `/library/nginx:latest", "` + src.Host() + `/library/alpine:3.18", "` +
+		src.Host() + `/library/redis:7"]}`
+	cfg = newBundleConfig("oci:"+delta, content, outputPath)
+	cfg.BundleBase = []string{filepath.Join(base, archive.BundleRecordFile)}
+	require.NoError(t, sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient()).Run(context.Background()))
+
+	deltaLayout, err := archive.ReadLayout(delta)
+	require.NoError(t, err)
+	assert.Len(t, deltaLayout.Images(), 3)
+	assert.True(t, deltaLayout.HasBlob(oci.ComputeDigest([]byte("redis-layer"))))
+	assert.False(t, deltaLayout.HasBlob(oci.ComputeDigest([]byte("alpine-layer"))))
+	assert.False(t, deltaLayout.HasBlob(oci.ComputeDigest([]byte("layer-linux/amd64"))))
+
+	// Manifests always travel, so the delta can name every image
+	_, _, err = deltaLayout.GetManifest(nginx)
+	require.NoError(t, err)
+
+	deltaRecord, err := archive.ReadBundleRecord(delta)
+	require.NoError(t, err)
+	assert.Subset(t, deltaRecord.Shipped, baseRecord.Shipped)
+	assert.Subset(t, deltaRecord.Shipped, deltaRecord.Blobs)
+
+	t.Run("Import Delta Without Base Fails", func(t *testing.T) {
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		engine := newTestEngine(nil)
+		defer engine.Close()
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: "oci:" + delta + ":mirror/alpine:3.18"},
+			&docker.ImageReference{FullName: dst.Host() + "/inside/alpine:3.18"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "bundle is incomplete")
+		assert.Equal(t, 0, dst.BlobUploads)
+	})
+
+	t.Run("Import Delta With Base", func(t *testing.T) {
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		cfg := newBundleConfig(dst.Host(), `{"hubsync": ["oci:`+delta+`"]}`, outputPath)
+		cfg.Namespace = "inside"
+		cfg.BundleBase = []string{base}
+		syncer := sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient())
+		require.NoError(t, syncer.Run(context.Background()))
+		assert.Equal(t, 3, syncer.GetProcessedImageCount())
+
+		for _, image := range []struct{ repo, tag, digest string }{
+			{"inside/nginx", "latest", nginx},
+			{"inside/alpine", "3.18", alpine},
+			{"inside/redis", "7", redis},
+		} {
+			stored, ok := dst.Manifest(image.repo, image.tag)
+			require.True(t, ok, image.repo)
+			assert.Equal(t, image.digest, oci.ComputeDigest(stored.Data), image.repo)
+		}
+	})
+}
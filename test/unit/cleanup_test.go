@@ -0,0 +1,115 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// TestDaemonEngineCleanup tests removing local images after a push
+func TestDaemonEngineCleanup(t *testing.T) {
+	source := &docker.ImageReference{FullName: "nginx:latest"}
+	target := &docker.ImageReference{FullName: "registry.example.com/mirror/nginx:latest"}
+
+	t.Run("Removes Tags After Push", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+		engine := transfer.NewDaemonEngine(client, nil)
+		engine.SetCleanup(true)
+
+		report, err := engine.Transfer(context.Background(), source, target)
+		require.NoError(t, err)
+		assert.Equal(t, []string{target.FullName, source.FullName}, client.RemovedImages)
+		assert.Contains(t, report.Logs, "Removed local image "+source.FullName)
+	})
+
+	t.Run("Keeps Images On Failure", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+		client.PushErrors[target.FullName] = errors.New("denied")
+		engine := transfer.NewDaemonEngine(client, nil)
+		engine.SetCleanup(true)
+
+		_, err := engine.Transfer(context.Background(), source, target)
+		require.Error(t, err)
+		assert.Empty(t, client.RemovedImages)
+	})
+
+	t.Run("Failed Removal Keeps The Push", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+		client.RemoveErrors[target.FullName] = errors.New("image is in use")
+		engine := transfer.NewDaemonEngine(client, nil)
+		engine.SetCleanup(true)
+
+		report, err := engine.Transfer(context.Background(), source, target)
+		require.NoError(t, err)
+		assert.Equal(t, []string{source.FullName}, client.RemovedImages)
+		assert.Contains(t, report.Logs, "Failed to remove local image "+target.FullName+": image is in use")
+	})
+
+	t.Run("Disabled By Default", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+
+		_, err := transfer.NewDaemonEngine(client, nil).Transfer(context.Background(), source, target)
+		require.NoError(t, err)
+		assert.Empty(t, client.RemovedImages)
+	})
+}
+
+// TestSyncerV2Cleanup tests cleanup and pruning during a daemon run
+func TestSyncerV2Cleanup(t *testing.T) {
+	newConfig := func(outputPath string) *config.Config {
+		return &config.Config{
+			Repository:    "docker.io",
+			Namespace:     "testns",
+			Content:       `{"hubsync": ["nginx:latest"]}`,
+			MaxContent:    10,
+			OutputPath:    outputPath,
+			Concurrency:   1,
+			Timeout:       10 * time.Second,
+			Cleanup:       true,
+			PruneDangling: true,
+		}
+	}
+
+	t.Run("Cleans Up And Prunes", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+		client.PruneReport = docker.PruneReport{ImagesDeleted: 3, SpaceReclaimed: 4096}
+		outputPath := filepath.Join(t.TempDir(), "output.log")
+
+		require.NoError(t, sync.NewSyncerV2(newConfig(outputPath), client, mocks.NewMockRegistryClient()).Run(context.Background()))
+		assert.Equal(t, []string{"docker.io/testns/nginx:latest", "nginx:latest"}, client.RemovedImages)
+		assert.Equal(t, 1, client.PruneCalls)
+
+		data, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "# Pruned dangling images: 3 (4096 bytes reclaimed)")
+	})
+
+	t.Run("Dry Run Leaves The Daemon Alone", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+		cfg := newConfig(filepath.Join(t.TempDir(), "output.log"))
+		cfg.DryRun = true
+
+		require.NoError(t, sync.NewSyncerV2(cfg, client, mocks.NewMockRegistryClient()).Run(context.Background()))
+		assert.Empty(t, client.RemovedImages)
+		assert.Zero(t, client.PruneCalls)
+	})
+
+	t.Run("Failed Prune Keeps The Run", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+		client.PruneError = errors.New("prune already running")
+
+		require.NoError(t, sync.NewSyncerV2(newConfig(filepath.Join(t.TempDir(), "output.log")), client, mocks.NewMockRegistryClient()).Run(context.Background()))
+		assert.Equal(t, 1, client.PruneCalls)
+	})
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/registry"
 )
 
 // TestConfigEnvironmentVars tests the environment variable handling in configuration
@@ -150,4 +151,145 @@ func TestConfigValidation(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "content is required")
 	})
+
+	t.Run("Invalid Platform", func(t *testing.T) {
+		cfg := &config.Config{
+			Username:    "test-user",
+			Password:    "test-pass",
+			Content:     `{"hubsync": ["nginx:latest"]}`,
+			LogLevel:    "info",
+			Concurrency: 1,
+			Platforms:   []string{"linux/amd64", "arm64"},
+		}
+
+		err := cfg.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid platform")
+	})
+
+	t.Run("Invalid Registry Bandwidth", func(t *testing.T) {
+		cfg := &config.Config{
+			Username:          "test-user",
+			Password:          "test-pass",
+			Content:           `{"hubsync": ["nginx:latest"]}`,
+			LogLevel:          "info",
+			Concurrency:       1,
+			RegistryBandwidth: []string{"docker.io"},
+		}
+
+		err := cfg.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "must be host=rate")
+	})
+
+	t.Run("Invalid Preflight Action", func(t *testing.T) {
+		cfg := &config.Config{
+			Username:    "test-user",
+			Password:    "test-pass",
+			Content:     `{"hubsync": ["nginx:latest"]}`,
+			LogLevel:    "info",
+			Concurrency: 1,
+			Preflight:   "warn",
+		}
+
+		err := cfg.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid preflight action")
+	})
+
+	t.Run("Cloud Provider Without Password", func(t *testing.T) {
+		for _, cfg := range []*config.Config{
+			{Repository: "123456789012.dkr.ecr.us-east-1.amazonaws.com"},
+			{Repository: "us-docker.pkg.dev/mirror-project/images"},
+			{Repository: "mirror.azurecr.io", AzureAccessToken: "aad-token"},
+			{Repository: "registry.example.com", RegistryProvider: "ecr"},
+			{Repository: "harbor.example.com/mirror", RegistryProvider: "harbor", HarborRobotFile: "robot.json"},
+			{Repository: "harbor.example.com/mirror", HarborRobotFile: "robot.json"},
+		} {
+			cfg.Content = `{"hubsync": ["nginx:latest"]}`
+			cfg.LogLevel = "info"
+			cfg.Concurrency = 1
+			assert.NoError(t, cfg.Validate(), cfg.Repository)
+		}
+	})
+
+	t.Run("Target Provider", func(t *testing.T) {
+		assert.Equal(t, registry.Harbor, (&config.Config{Repository: "harbor.example.com", HarborPublic: true}).TargetProvider())
+		assert.Equal(t, registry.Custom, (&config.Config{Repository: "harbor.example.com"}).TargetProvider())
+		assert.Equal(t, registry.GHCR, (&config.Config{Repository: "ghcr.io/org", HarborRobotFile: "robot.json"}).TargetProvider())
+		assert.Equal(t, registry.Custom, (&config.Config{Repository: "harbor.example.com", RegistryProvider: "custom", HarborPublic: true}).TargetProvider())
+	})
+
+	t.Run("ACR Without Token Or Password", func(t *testing.T) {
+		cfg := &config.Config{
+			Repository:  "mirror.azurecr.io",
+			Content:     `{"hubsync": ["nginx:latest"]}`,
+			LogLevel:    "info",
+			Concurrency: 1,
+		}
+
+		err := cfg.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "username is required")
+	})
+
+	t.Run("Invalid Registry Provider", func(t *testing.T) {
+		cfg := &config.Config{
+			Username:         "test-user",
+			Password:         "test-pass",
+			RegistryProvider: "quay",
+			Content:          `{"hubsync": ["nginx:latest"]}`,
+			LogLevel:         "info",
+			Concurrency:      1,
+		}
+
+		err := cfg.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid registry provider")
+	})
+}
+
+// TestParseByteSize tests parsing of human readable sizes
+func TestParseByteSize(t *testing.T) {
+	testCases := map[string]int64{
+		"1024":  1024,
+		"512KB": 512 << 10,
+		"20MiB": 20 << 20,
+		"1.5G":  3 << 29,
+		"2 tb":  2 << 40,
+	}
+	for input, expected := range testCases {
+		size, err := config.ParseByteSize(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, size, input)
+	}
+
+	_, err := config.ParseByteSize("lots")
+	assert.Error(t, err)
+	_, err = config.ParseByteSize("-1MB")
+	assert.Error(t, err)
+}
+
+// TestParseRegistryBandwidth tests parsing of per-registry rate limits
+func TestParseRegistryBandwidth(t *testing.T) {
+	rates, err := config.ParseRegistryBandwidth([]string{"docker.io=10MB", " ghcr.io = 512KB"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"docker.io": 10 << 20, "ghcr.io": 512 << 10}, rates)
+
+	_, err = config.ParseRegistryBandwidth([]string{"=10MB"})
+	assert.Error(t, err)
+	_, err = config.ParseRegistryBandwidth([]string{"ghcr.io=fast"})
+	assert.Error(t, err)
+}
+
+// TestParseRegistryOptions tests parsing of provider-specific registry settings
+func TestParseRegistryOptions(t *testing.T) {
+	options, err := config.ParseRegistryOptions([]string{"tenant=team-a", " endpoint = https://auth.corp.example ", "token="})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "team-a", "endpoint": "https://auth.corp.example", "token": ""}, options)
+
+	_, err = config.ParseRegistryOptions([]string{"tenant"})
+	assert.Error(t, err)
+	_, err = config.ParseRegistryOptions([]string{"=team-a"})
+	assert.Error(t, err)
 }
@@ -0,0 +1,267 @@
+package unit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/compression"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// gzipped compresses data with gzip
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// unzstd decompresses zstd data
+func unzstd(t *testing.T, data []byte) []byte {
+	zr, err := zstd.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	return out
+}
+
+// zstded compresses data with zstd
+func zstded(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// gunzip decompresses gzip data
+func gunzip(t *testing.T, data []byte) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	out, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	return out
+}
+
+// TestRecompress tests converting between gzip and zstd
+func TestRecompress(t *testing.T) {
+	random := make([]byte, 300<<10)
+	seed := uint32(1)
+	for i := range random {
+		seed = seed*1664525 + 1013904223
+		random[i] = byte(seed >> 24)
+	}
+	contents := map[string][]byte{
+		"Empty":      {},
+		"Repetitive": []byte(strings.Repeat("tar content ", 100000)),
+		"Random":     random,
+	}
+
+	t.Run("Gzip To Zstd", func(t *testing.T) {
+		for name, content := range contents {
+			var buf bytes.Buffer
+			require.NoError(t, compression.Recompress(&buf, bytes.NewReader(gzipped(t, content)), compression.Gzip, compression.Zstd), name)
+			assert.Equal(t, content, unzstd(t, buf.Bytes()), name)
+		}
+	})
+
+	t.Run("Zstd To Gzip", func(t *testing.T) {
+		for name, content := range contents {
+			var buf bytes.Buffer
+			require.NoError(t, compression.Recompress(&buf, bytes.NewReader(zstded(t, content)), compression.Zstd, compression.Gzip), name)
+			assert.Equal(t, content, gunzip(t, buf.Bytes()), name)
+		}
+	})
+
+	t.Run("Round Trip", func(t *testing.T) {
+		content := contents["Repetitive"]
+		var zstdData, gzipData bytes.Buffer
+		require.NoError(t, compression.Recompress(&zstdData, bytes.NewReader(gzipped(t, content)), compression.Gzip, compression.Zstd))
+		assert.Less(t, zstdData.Len(), len(content)/10)
+		require.NoError(t, compression.Recompress(&gzipData, &zstdData, compression.Zstd, compression.Gzip))
+		assert.Equal(t, content, gunzip(t, gzipData.Bytes()))
+	})
+
+	t.Run("Invalid Stream", func(t *testing.T) {
+		assert.Error(t, compression.Recompress(io.Discard, bytes.NewReader([]byte("not gzip")), compression.Gzip, compression.Zstd))
+		assert.Error(t, compression.Recompress(io.Discard, bytes.NewReader([]byte("not zstd")), compression.Zstd, compression.Gzip))
+	})
+}
+
+// TestRegistryEngineConvertLayers tests recompressing layers while copying
+func TestRegistryEngineConvertLayers(t *testing.T) {
+	layer := []byte(strings.Repeat("nginx layer ", 5000))
+
+	t.Run("Gzip To Zstd", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		gzLayer := gzipped(t, layer)
+		digest := src.AddImage("library/nginx", "latest", gzLayer)
+
+		engine := newTestEngine(nil)
+		engine.SetConversion(compression.Zstd)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+		require.NoError(t, err)
+		assert.True(t, report.ChecksumOK)
+		assert.NotEqual(t, digest, report.TargetDigest)
+
+		require.Len(t, report.Conversions, 1)
+		conversion := report.Conversions[0]
+		assert.Equal(t, oci.ComputeDigest(gzLayer), conversion.SourceDigest)
+		assert.Equal(t, compression.MediaTypeOCILayerZstd, conversion.MediaType)
+
+		stored, ok := dst.Manifest("mirror/nginx", "latest")
+		require.True(t, ok)
+		assert.Equal(t, report.TargetDigest, oci.ComputeDigest(stored.Data))
+		manifest, err := oci.ParseManifest(stored.Data)
+		require.NoError(t, err)
+		require.Len(t, manifest.Layers, 1)
+		assert.Equal(t, conversion.TargetDigest, manifest.Layers[0].Digest)
+		assert.Equal(t, compression.MediaTypeOCILayerZstd, manifest.Layers[0].MediaType)
+
+		converted, ok := dst.Blob(conversion.TargetDigest)
+		require.True(t, ok)
+		assert.Equal(t, layer, unzstd(t, converted))
+		assert.False(t, dst.HasBlob("mirror/nginx", conversion.SourceDigest))
+	})
+
+	t.Run("Index Points At Converted Manifests", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		index := oci.Index{SchemaVersion: 2, MediaType: oci.MediaTypeDockerManifestList}
+		for _, arch := range []string{"amd64", "arm64"} {
+			digest := src.AddImage("library/nginx", "", gzipped(t, []byte(arch+" layer")))
+			m, _ := src.Manifest("library/nginx", digest)
+			index.Manifests = append(index.Manifests, oci.Descriptor{
+				MediaType: oci.MediaTypeOCIManifest,
+				Digest:    digest,
+				Size:      int64(len(m.Data)),
+				Platform:  &oci.Platform{OS: "linux", Architecture: arch},
+			})
+		}
+		data, _ := json.Marshal(index)
+		src.AddManifest("library/nginx", "latest", oci.MediaTypeDockerManifestList, data)
+
+		engine := newTestEngine(nil)
+		engine.SetConversion(compression.Zstd)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+		require.NoError(t, err)
+		assert.True(t, report.ChecksumOK)
+		assert.Len(t, report.Conversions, 2)
+
+		stored, ok := dst.Manifest("mirror/nginx", "latest")
+		require.True(t, ok)
+		pushed, err := oci.ParseIndex(stored.Data)
+		require.NoError(t, err)
+		assert.Equal(t, oci.MediaTypeOCIIndex, pushed.MediaType)
+		for i, child := range pushed.Manifests {
+			assert.NotEqual(t, index.Manifests[i].Digest, child.Digest)
+			assert.Equal(t, "linux", child.Platform.OS)
+			_, ok := dst.Manifest("mirror/nginx", child.Digest)
+			assert.True(t, ok)
+		}
+	})
+
+	t.Run("Corrupt Source Layer", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		gzLayer := gzipped(t, layer)
+		src.AddImage("library/nginx", "latest", gzLayer)
+		src.ReplaceBlob(oci.ComputeDigest(gzLayer), gzipped(t, []byte("tampered layer")))
+
+		engine := newTestEngine(nil)
+		engine.SetConversion(compression.Zstd)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+		require.Error(t, err)
+		assert.True(t, errors.IsVerificationError(err))
+		assert.Empty(t, report.Conversions)
+		_, ok := dst.Manifest("mirror/nginx", "latest")
+		assert.False(t, ok)
+	})
+
+	t.Run("Matching Layers Are Left Alone", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		digest := src.AddImage("library/nginx", "latest", gzipped(t, layer))
+
+		engine := newTestEngine(nil)
+		engine.SetConversion(compression.Gzip)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+		require.NoError(t, err)
+		assert.Empty(t, report.Conversions)
+		assert.Equal(t, digest, report.TargetDigest)
+	})
+}
+
+// TestSyncerV2ConvertLayers tests that the digest mapping is written to the output
+func TestSyncerV2ConvertLayers(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+
+	gzLayer := gzipped(t, []byte("alpine layer"))
+	src.AddImage("library/alpine", "3.18", gzLayer)
+
+	outputPath := filepath.Join(t.TempDir(), "output.log")
+	cfg := &config.Config{
+		Repository:    dst.Host(),
+		Namespace:     "mirror",
+		Content:       `{"hubsync": ["` + src.Host() + `/library/alpine:3.18"]}`,
+		MaxContent:    10,
+		OutputPath:    outputPath,
+		Concurrency:   1,
+		Timeout:       10 * time.Second,
+		Transport:     transfer.TransportRegistry,
+		Insecure:      true,
+		ConvertLayers: compression.Zstd,
+	}
+	require.NoError(t, sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient()).Run(context.Background()))
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "#   converted "+oci.ComputeDigest(gzLayer)+" -> sha256:")
+	assert.Contains(t, string(data), "("+compression.MediaTypeOCILayerZstd+")")
+}
@@ -0,0 +1,162 @@
+package unit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/registry"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// newECRStubs starts an ECR API stub and a registry accepting its tokens
+func newECRStubs(t *testing.T) (*mocks.ECRServer, *mocks.RegistryServer) {
+	api := mocks.NewECRServer("AKIDEXAMPLE", "us-east-1", "ecr-token")
+	t.Cleanup(api.Close)
+
+	server := mocks.NewRegistryServer()
+	t.Cleanup(server.Close)
+	server.Username = "AWS"
+	server.Password = "ecr-token"
+	server.BasicAuth = true
+	server.AddImage("mirror/nginx", "latest", []byte("layer"))
+
+	// Keep the host environment out of the credential lookup
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "missing"))
+	return api, server
+}
+
+// TestECRRegistry tests logging in to ECR and creating repositories
+func TestECRRegistry(t *testing.T) {
+	ctx := context.Background()
+	staticKeys := registry.AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}
+
+	t.Run("Static Keys", func(t *testing.T) {
+		api, server := newECRStubs(t)
+		client := registry.NewECRRegistry(registry.RegistryConfig{URL: server.URL},
+			registry.ECROptions{Region: "us-east-1", Endpoint: api.URL, Credentials: staticKeys})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+		tags, err := client.GetImageTags(ctx, "mirror/nginx")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"latest"}, tags)
+
+		// The 12 hour token is reused
+		assert.Equal(t, 1, api.TokenRequests)
+	})
+
+	t.Run("Refreshes Expiring Token", func(t *testing.T) {
+		api, server := newECRStubs(t)
+		api.TokenTTL = 10 * time.Minute
+		client := registry.NewECRRegistry(registry.RegistryConfig{URL: server.URL},
+			registry.ECROptions{Region: "us-east-1", Endpoint: api.URL, Credentials: staticKeys})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+		requests := api.TokenRequests
+		_, err := client.GetImageManifest(ctx, "mirror/nginx", "latest")
+		require.NoError(t, err)
+		assert.Greater(t, api.TokenRequests, requests)
+	})
+
+	t.Run("Environment Keys", func(t *testing.T) {
+		api, server := newECRStubs(t)
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		client := registry.NewECRRegistry(registry.RegistryConfig{URL: server.URL},
+			registry.ECROptions{Region: "us-east-1", Endpoint: api.URL})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+	})
+
+	t.Run("Shared Credentials File", func(t *testing.T) {
+		api, server := newECRStubs(t)
+		file := filepath.Join(t.TempDir(), "credentials")
+		require.NoError(t, os.WriteFile(file, []byte(
+			"[default]\naws_access_key_id = AKIDOTHER\naws_secret_access_key = other\n\n"+
+				"[mirror]\naws_access_key_id = AKIDEXAMPLE\naws_secret_access_key = secret\n"), 0o600))
+
+		client := registry.NewECRRegistry(registry.RegistryConfig{URL: server.URL},
+			registry.ECROptions{Region: "us-east-1", Endpoint: api.URL, Profile: "mirror", CredentialsFile: file})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+	})
+
+	t.Run("Rejected Keys", func(t *testing.T) {
+		api, server := newECRStubs(t)
+		client := registry.NewECRRegistry(registry.RegistryConfig{URL: server.URL},
+			registry.ECROptions{Region: "us-east-1", Endpoint: api.URL,
+				Credentials: registry.AWSCredentials{AccessKeyID: "AKIDOTHER", SecretAccessKey: "secret"}})
+		defer client.Close()
+
+		err := client.Auth(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+
+		// The registry only sees missing credentials, the login tells why
+		_, _, err = client.Login(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+		assert.Contains(t, err.Error(), "UnrecognizedClientException")
+	})
+
+	t.Run("No Credentials", func(t *testing.T) {
+		api, server := newECRStubs(t)
+		client := registry.NewECRRegistry(registry.RegistryConfig{URL: server.URL},
+			registry.ECROptions{Region: "us-east-1", Endpoint: api.URL})
+		defer client.Close()
+
+		err := client.Auth(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+		assert.Zero(t, api.TokenRequests)
+	})
+
+	t.Run("Creates Missing Repositories", func(t *testing.T) {
+		api, server := newECRStubs(t)
+		api.Repositories["mirror/redis"] = true
+		client := registry.NewECRRegistry(registry.RegistryConfig{URL: server.URL},
+			registry.ECROptions{Region: "us-east-1", Endpoint: api.URL, Credentials: staticKeys})
+		defer client.Close()
+
+		require.NoError(t, client.EnsureRepository(ctx, &docker.ImageReference{FullName: server.Host() + "/mirror/nginx:latest"}))
+		require.NoError(t, client.EnsureRepository(ctx, &docker.ImageReference{FullName: server.Host() + "/mirror/redis:7"}))
+		require.NoError(t, client.EnsureRepository(ctx, &docker.ImageReference{FullName: "ghcr.io/org/app:v1"}))
+		assert.Equal(t, []string{"mirror/nginx"}, api.Created)
+	})
+}
+
+// TestSyncerV2CreatesRepositories tests that target repositories are created before pushing
+func TestSyncerV2CreatesRepositories(t *testing.T) {
+	api, server := newECRStubs(t)
+	client := registry.NewECRRegistry(registry.RegistryConfig{URL: server.URL},
+		registry.ECROptions{Region: "us-east-1", Endpoint: api.URL,
+			Credentials: registry.AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}})
+	defer client.Close()
+
+	cfg := &config.Config{
+		Repository:  server.Host(),
+		Namespace:   "mirror",
+		Content:     `{"hubsync": ["nginx:latest", "nginx:alpine", "redis:7"]}`,
+		MaxContent:  10,
+		OutputPath:  filepath.Join(t.TempDir(), "output.log"),
+		Concurrency: 1,
+		Timeout:     10 * time.Second,
+	}
+
+	require.NoError(t, sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), client).Run(context.Background()))
+	assert.ElementsMatch(t, []string{"mirror/nginx", "mirror/redis"}, api.Created)
+}
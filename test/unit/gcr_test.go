@@ -0,0 +1,220 @@
+package unit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/registry"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// newServiceAccountKey returns a service account JSON key and its private key
+func newServiceAccountKey(t *testing.T, tokenURI string) ([]byte, *rsa.PrivateKey) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	key, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "mirror-project",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "hubsync@mirror-project.iam.gserviceaccount.com",
+		"token_uri":      tokenURI,
+	})
+	require.NoError(t, err)
+	return key, privateKey
+}
+
+// newGCRStubs starts a token endpoint and a registry accepting its tokens,
+// and returns a key of the service account allowed to sign in
+func newGCRStubs(t *testing.T) (*mocks.GoogleTokenServer, *mocks.RegistryServer, []byte) {
+	tokens := mocks.NewGoogleTokenServer("hubsync@mirror-project.iam.gserviceaccount.com", nil, "ya29.test-token")
+	t.Cleanup(tokens.Close)
+	key, privateKey := newServiceAccountKey(t, tokens.TokenURL())
+	tokens.PublicKey = &privateKey.PublicKey
+
+	server := mocks.NewRegistryServer()
+	t.Cleanup(server.Close)
+	server.Username = "oauth2accesstoken"
+	server.Password = "ya29.test-token"
+	server.AddImage("mirror-project/nginx", "latest", []byte("layer"))
+
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	return tokens, server, key
+}
+
+// TestGCRRegistry tests signing in to GCR and Artifact Registry with a service account
+func TestGCRRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Key File", func(t *testing.T) {
+		tokens, server, key := newGCRStubs(t)
+		keyFile := filepath.Join(t.TempDir(), "key.json")
+		require.NoError(t, os.WriteFile(keyFile, key, 0o600))
+
+		client := registry.NewGCRRegistry(registry.RegistryConfig{URL: server.URL}, registry.GCROptions{KeyFile: keyFile})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+		tags, err := client.GetImageTags(ctx, "mirror-project/nginx")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"latest"}, tags)
+		assert.Equal(t, 1, tokens.TokenRequests)
+
+		username, password, err := client.Login(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "oauth2accesstoken", username)
+		assert.Equal(t, "ya29.test-token", password)
+	})
+
+	t.Run("Application Default Credentials", func(t *testing.T) {
+		_, server, key := newGCRStubs(t)
+		keyFile := filepath.Join(t.TempDir(), "key.json")
+		require.NoError(t, os.WriteFile(keyFile, key, 0o600))
+		t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", keyFile)
+
+		client := registry.NewGCRRegistry(registry.RegistryConfig{URL: server.URL}, registry.GCROptions{})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+	})
+
+	t.Run("Configured Token URL", func(t *testing.T) {
+		tokens, server, _ := newGCRStubs(t)
+		key, privateKey := newServiceAccountKey(t, "https://oauth2.googleapis.com/token")
+		tokens.PublicKey = &privateKey.PublicKey
+
+		client := registry.NewGCRRegistry(registry.RegistryConfig{URL: server.URL},
+			registry.GCROptions{Key: key, TokenURL: tokens.TokenURL()})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+	})
+
+	t.Run("Refreshes Expiring Token", func(t *testing.T) {
+		tokens, server, key := newGCRStubs(t)
+		tokens.ExpiresIn = 60
+
+		client := registry.NewGCRRegistry(registry.RegistryConfig{URL: server.URL}, registry.GCROptions{Key: key})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+		requests := tokens.TokenRequests
+		_, err := client.GetImageManifest(ctx, "mirror-project/nginx", "latest")
+		require.NoError(t, err)
+		assert.Greater(t, tokens.TokenRequests, requests)
+	})
+
+	t.Run("Unknown Service Account", func(t *testing.T) {
+		tokens, server, _ := newGCRStubs(t)
+		other, _ := newServiceAccountKey(t, tokens.TokenURL())
+
+		client := registry.NewGCRRegistry(registry.RegistryConfig{URL: server.URL}, registry.GCROptions{Key: other})
+		defer client.Close()
+
+		err := client.Auth(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+
+		// The registry only sees missing credentials, the login tells why
+		_, _, err = client.Login(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+		assert.Contains(t, err.Error(), "invalid_grant")
+	})
+
+	t.Run("No Key", func(t *testing.T) {
+		_, server, _ := newGCRStubs(t)
+		client := registry.NewGCRRegistry(registry.RegistryConfig{URL: server.URL}, registry.GCROptions{})
+		defer client.Close()
+
+		err := client.Auth(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+
+		_, _, err = client.Login(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsConfigError(err))
+	})
+
+	t.Run("Artifact Registry Layout", func(t *testing.T) {
+		client := registry.NewGCRRegistry(registry.RegistryConfig{URL: "us-docker.pkg.dev/mirror-project/images"}, registry.GCROptions{})
+		defer client.Close()
+		assert.Equal(t, "us-docker.pkg.dev", client.Host())
+		assert.True(t, registry.IsArtifactRegistryHost(client.Host()))
+
+		require.NoError(t, client.EnsureRepository(ctx, &docker.ImageReference{FullName: "us-docker.pkg.dev/mirror-project/images/nginx:latest"}))
+
+		err := client.EnsureRepository(ctx, &docker.ImageReference{FullName: "us-docker.pkg.dev/mirror-project/nginx:latest"})
+		require.Error(t, err)
+		assert.True(t, errors.IsValidationError(err))
+		assert.Contains(t, err.Error(), "PROJECT/REPOSITORY")
+
+		gcr := registry.NewGCRRegistry(registry.RegistryConfig{URL: "gcr.io"}, registry.GCROptions{})
+		defer gcr.Close()
+		require.NoError(t, gcr.EnsureRepository(ctx, &docker.ImageReference{FullName: "gcr.io/mirror-project/nginx:latest"}))
+		require.Error(t, gcr.EnsureRepository(ctx, &docker.ImageReference{FullName: "gcr.io/nginx:latest"}))
+	})
+}
+
+// TestSyncerV2PushesWithAccessToken tests that pushes log in with the provider's token
+func TestSyncerV2PushesWithAccessToken(t *testing.T) {
+	newConfig := func(repository string) *config.Config {
+		return &config.Config{
+			Repository:  repository,
+			Content:     `{"hubsync": ["nginx:latest"]}`,
+			MaxContent:  10,
+			OutputPath:  filepath.Join(t.TempDir(), "output.log"),
+			Concurrency: 1,
+			Timeout:     10 * time.Second,
+			Insecure:    true,
+		}
+	}
+
+	t.Run("Daemon", func(t *testing.T) {
+		_, server, key := newGCRStubs(t)
+		client := registry.NewGCRRegistry(registry.RegistryConfig{URL: server.URL}, registry.GCROptions{Key: key})
+		defer client.Close()
+
+		dockerClient := mocks.NewMockDockerClient()
+		dockerClient.Login = client.Login
+		require.NoError(t, sync.NewSyncerV2(newConfig(server.Host()+"/mirror-project/images"), dockerClient, client).Run(context.Background()))
+		assert.Equal(t, server.Host()+"/mirror-project/images/nginx:latest", dockerClient.TaggedImages["nginx:latest"])
+		assert.Equal(t, []string{"oauth2accesstoken"}, dockerClient.PushUsers)
+	})
+
+	t.Run("Registry", func(t *testing.T) {
+		_, server, key := newGCRStubs(t)
+		source := mocks.NewRegistryServer()
+		defer source.Close()
+		source.AddImage("library/nginx", "latest", []byte("layer"))
+
+		client := registry.NewGCRRegistry(registry.RegistryConfig{URL: server.URL}, registry.GCROptions{Key: key})
+		defer client.Close()
+
+		cfg := newConfig(server.Host() + "/mirror-project/images")
+		cfg.Transport = transfer.TransportRegistry
+		cfg.Content = `{"hubsync": ["` + source.Host() + `/library/nginx:latest"]}`
+
+		require.NoError(t, sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), client).Run(context.Background()))
+		_, ok := server.Manifest("mirror-project/images/nginx", "latest")
+		assert.True(t, ok)
+	})
+}
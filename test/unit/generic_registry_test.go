@@ -0,0 +1,120 @@
+package unit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/registry"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// TestGenericRegistry tests the distribution API registry client
+func TestGenericRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Bearer Challenge", func(t *testing.T) {
+		server := mocks.NewRegistryServer()
+		defer server.Close()
+		server.Username = "user"
+		server.Password = "secret"
+		digest := server.AddImage("mirror/nginx", "latest", []byte("layer"))
+
+		client := registry.NewGenericRegistry(registry.RegistryConfig{URL: server.URL, Username: "user", Password: "secret"})
+		defer client.Close()
+
+		require.NoError(t, client.Auth(ctx))
+
+		manifest, err := client.GetImageManifest(ctx, "mirror/nginx", "latest")
+		require.NoError(t, err)
+		assert.NotEmpty(t, manifest)
+
+		_, err = client.GetImageManifest(ctx, "mirror/nginx", digest)
+		require.NoError(t, err)
+
+		exists, err := client.ValidateImage(ctx, &docker.ImageReference{FullName: server.Host() + "/mirror/nginx:latest"})
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = client.ValidateImage(ctx, &docker.ImageReference{FullName: server.Host() + "/mirror/nginx:missing"})
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		// One token for the ping and one for the repository, reused afterwards
+		assert.Equal(t, 2, server.TokenIssued)
+		assert.Equal(t, []string{"", "repository:mirror/nginx:pull"}, server.TokenScopes)
+	})
+
+	t.Run("Basic Challenge", func(t *testing.T) {
+		server := mocks.NewRegistryServer()
+		defer server.Close()
+		server.Username = "user"
+		server.Password = "secret"
+		server.BasicAuth = true
+		server.AddImage("mirror/nginx", "latest", []byte("layer"))
+
+		client := registry.NewGenericRegistry(registry.RegistryConfig{URL: server.URL, Username: "user", Password: "secret"})
+		defer client.Close()
+
+		tags, err := client.GetImageTags(ctx, "mirror/nginx")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"latest"}, tags)
+		assert.Zero(t, server.TokenIssued)
+	})
+
+	t.Run("Wrong Credentials", func(t *testing.T) {
+		server := mocks.NewRegistryServer()
+		defer server.Close()
+		server.Username = "user"
+		server.Password = "secret"
+
+		client := registry.NewGenericRegistry(registry.RegistryConfig{URL: server.URL, Username: "user", Password: "wrong"})
+		defer client.Close()
+
+		err := client.Auth(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+	})
+
+	t.Run("Paginated Lists", func(t *testing.T) {
+		server := mocks.NewRegistryServer()
+		defer server.Close()
+		server.PageSize = 2
+		for _, repo := range []string{"mirror/nginx", "mirror/redis", "mirror/alpine", "other/app"} {
+			server.AddImage(repo, "latest", []byte(repo))
+		}
+		for _, tag := range []string{"1.25", "1.26", "1.27", "alpine"} {
+			server.AddImage("mirror/nginx", tag, []byte(tag))
+		}
+
+		client := registry.NewGenericRegistry(registry.RegistryConfig{URL: server.URL})
+		defer client.Close()
+
+		images, err := client.ListImages(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mirror/alpine", "mirror/nginx", "mirror/redis", "other/app"}, images)
+
+		images, err = client.ListImages(ctx, "mirror")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mirror/alpine", "mirror/nginx", "mirror/redis"}, images)
+
+		tags, err := client.GetImageTags(ctx, "mirror/nginx")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1.25", "1.26", "1.27", "alpine", "latest"}, tags)
+	})
+
+	t.Run("Unknown Repository", func(t *testing.T) {
+		server := mocks.NewRegistryServer()
+		defer server.Close()
+
+		client := registry.NewGenericRegistry(registry.RegistryConfig{URL: server.URL})
+		defer client.Close()
+
+		_, err := client.GetImageTags(ctx, "mirror/missing")
+		require.Error(t, err)
+		assert.True(t, errors.IsOperationError(err))
+	})
+}
@@ -0,0 +1,203 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/registry"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// newHarborStub starts a Harbor stub for the administrator admin
+func newHarborStub(t *testing.T) *mocks.HarborServer {
+	server := mocks.NewHarborServer("admin", "Harbor12345")
+	t.Cleanup(server.Close)
+	server.Projects["library"] = &mocks.HarborProject{Public: true}
+	server.Registry.AddImage("library/nginx", "latest", []byte("layer"))
+	return server
+}
+
+// writeRobotFile writes a robot account file as exported from Harbor
+func writeRobotFile(t *testing.T, name, secret string, expiresAt int64) string {
+	data, err := json.Marshal(map[string]interface{}{
+		"id":         1,
+		"name":       name,
+		"secret":     secret,
+		"expires_at": expiresAt,
+	})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "robot.json")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+// TestHarborRegistry tests creating Harbor projects and signing in with robot accounts
+func TestHarborRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Creates Missing Projects", func(t *testing.T) {
+		server := newHarborStub(t)
+		client, err := registry.NewHarborRegistry(registry.RegistryConfig{URL: server.URL, Username: "admin", Password: "Harbor12345"},
+			registry.HarborOptions{Public: true, StorageLimit: 10 << 30})
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.NoError(t, client.EnsureRepository(ctx, &docker.ImageReference{FullName: server.Host() + "/mirror/nginx:latest"}))
+		require.NoError(t, client.EnsureRepository(ctx, &docker.ImageReference{FullName: server.Host() + "/mirror/redis:7"}))
+		require.NoError(t, client.EnsureRepository(ctx, &docker.ImageReference{FullName: server.Host() + "/library/nginx:latest"}))
+		require.NoError(t, client.EnsureRepository(ctx, &docker.ImageReference{FullName: "ghcr.io/org/app:v1"}))
+
+		assert.Equal(t, []string{"mirror"}, server.Created)
+		assert.Equal(t, &mocks.HarborProject{Public: true, StorageLimit: 10 << 30}, server.Projects["mirror"])
+		assert.Equal(t, &mocks.HarborProject{Public: true}, server.Projects["library"])
+
+		// Checked projects are not looked up again
+		assert.Equal(t, 2, server.ProjectLookups)
+	})
+
+	t.Run("Private Projects By Default", func(t *testing.T) {
+		server := newHarborStub(t)
+		client, err := registry.NewHarborRegistry(registry.RegistryConfig{URL: server.URL, Username: "admin", Password: "Harbor12345"},
+			registry.HarborOptions{})
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.NoError(t, client.EnsureRepository(ctx, &docker.ImageReference{FullName: server.Host() + "/mirror/nginx:latest"}))
+		assert.Equal(t, &mocks.HarborProject{}, server.Projects["mirror"])
+	})
+
+	t.Run("Image Without Project", func(t *testing.T) {
+		server := newHarborStub(t)
+		client, err := registry.NewHarborRegistry(registry.RegistryConfig{URL: server.URL, Username: "admin", Password: "Harbor12345"},
+			registry.HarborOptions{})
+		require.NoError(t, err)
+		defer client.Close()
+
+		err = client.EnsureRepository(ctx, &docker.ImageReference{FullName: server.Host() + "/nginx:latest"})
+		require.Error(t, err)
+		assert.True(t, errors.IsValidationError(err))
+		assert.Contains(t, err.Error(), "names no Harbor project")
+	})
+
+	t.Run("Robot Account File", func(t *testing.T) {
+		server := newHarborStub(t)
+		server.RobotName = "robot$mirror+hubsync"
+		server.RobotSecret = "robot-secret"
+		robotFile := writeRobotFile(t, server.RobotName, server.RobotSecret, time.Now().Add(time.Hour).Unix())
+
+		client, err := registry.NewHarborRegistry(registry.RegistryConfig{URL: server.URL}, registry.HarborOptions{RobotFile: robotFile})
+		require.NoError(t, err)
+		defer client.Close()
+
+		tags, err := client.GetImageTags(ctx, "library/nginx")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"latest"}, tags)
+
+		username, password, err := client.Login(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "robot$mirror+hubsync", username)
+		assert.Equal(t, "robot-secret", password)
+		assert.True(t, registry.IsRobotAccount(username))
+	})
+
+	t.Run("Robot Account May Not Create Projects", func(t *testing.T) {
+		server := newHarborStub(t)
+		server.RobotName = "robot$library+hubsync"
+		server.RobotSecret = "robot-secret"
+
+		client, err := registry.NewHarborRegistry(registry.RegistryConfig{URL: server.URL, Username: server.RobotName, Password: server.RobotSecret},
+			registry.HarborOptions{})
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.NoError(t, client.EnsureRepository(ctx, &docker.ImageReference{FullName: server.Host() + "/library/nginx:latest"}))
+
+		err = client.EnsureRepository(ctx, &docker.ImageReference{FullName: server.Host() + "/mirror/nginx:latest"})
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+		assert.Contains(t, err.Error(), "system robot account")
+		assert.Empty(t, server.Created)
+	})
+
+	t.Run("Expired Robot Account", func(t *testing.T) {
+		robotFile := writeRobotFile(t, "robot$mirror+hubsync", "robot-secret", time.Now().Add(-time.Hour).Unix())
+
+		_, err := registry.NewHarborRegistry(registry.RegistryConfig{URL: "harbor.example.com"}, registry.HarborOptions{RobotFile: robotFile})
+		require.Error(t, err)
+		assert.True(t, errors.IsAuthError(err))
+		assert.Contains(t, err.Error(), "expired")
+	})
+
+	t.Run("Invalid Robot Account File", func(t *testing.T) {
+		robotFile := filepath.Join(t.TempDir(), "robot.json")
+		require.NoError(t, os.WriteFile(robotFile, []byte("robot$mirror+hubsync"), 0600))
+
+		_, err := registry.NewHarborRegistry(registry.RegistryConfig{URL: "harbor.example.com"}, registry.HarborOptions{RobotFile: robotFile})
+		require.Error(t, err)
+		assert.True(t, errors.IsConfigError(err))
+	})
+
+	t.Run("Classifies Quota Errors", func(t *testing.T) {
+		client, err := registry.NewHarborRegistry(registry.RegistryConfig{URL: "harbor.example.com"}, registry.HarborOptions{})
+		require.NoError(t, err)
+		defer client.Close()
+
+		quota := client.ClassifyError(fmt.Errorf("denied: Quota exceeded when processing the request of adding 3.0 KiB of storage resource"))
+		assert.True(t, errors.IsQuotaError(quota))
+		assert.Contains(t, quota.Error(), "Quota exceeded when processing")
+
+		other := fmt.Errorf("manifest unknown")
+		assert.Same(t, other, client.ClassifyError(other))
+		assert.Nil(t, client.ClassifyError(nil))
+	})
+}
+
+// TestSyncerV2ReportsQuotaErrors tests that pushes refused over a Harbor quota are reported as such
+func TestSyncerV2ReportsQuotaErrors(t *testing.T) {
+	server := newHarborStub(t)
+	server.Projects["mirror"] = &mocks.HarborProject{StorageLimit: 10 << 20}
+	server.FullProjects["mirror"] = true
+
+	source := mocks.NewRegistryServer()
+	defer source.Close()
+	source.AddImage("library/nginx", "latest", []byte("layer"))
+
+	client, err := registry.NewHarborRegistry(registry.RegistryConfig{URL: server.URL, Username: "admin", Password: "Harbor12345", Insecure: true},
+		registry.HarborOptions{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	cfg := &config.Config{
+		Repository:  server.Host(),
+		Namespace:   "mirror",
+		Content:     `{"hubsync": ["` + source.Host() + `/library/nginx:latest"]}`,
+		MaxContent:  10,
+		OutputPath:  filepath.Join(t.TempDir(), "output.log"),
+		Concurrency: 1,
+		Timeout:     10 * time.Second,
+		Insecure:    true,
+		Transport:   transfer.TransportRegistry,
+	}
+
+	require.NoError(t, sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), client).Run(context.Background()))
+
+	_, ok := server.Registry.Manifest("mirror/nginx", "latest")
+	assert.False(t, ok)
+
+	output, err := os.ReadFile(cfg.OutputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "# Storage quota exceeded: 1 images were refused by the target registry")
+}
@@ -0,0 +1,218 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// sizedManifest returns an image manifest whose config and layers have the given sizes
+func sizedManifest(config int64, layers map[string]int64) []byte {
+	layerJSON := ""
+	for digest, size := range layers {
+		if layerJSON != "" {
+			layerJSON += ","
+		}
+		layerJSON += fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"%s","size":%d}`, digest, size)
+	}
+	return []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:config-%d","size":%d},"layers":[%s]}`,
+		config, config, layerJSON))
+}
+
+// TestSyncerV2Preflight tests the pre-flight size check of a batch
+func TestSyncerV2Preflight(t *testing.T) {
+	newConfig := func(content, outputPath string) *config.Config {
+		return &config.Config{
+			Repository:  "registry.example.com",
+			Namespace:   "mirror",
+			Content:     content,
+			MaxContent:  10,
+			OutputPath:  outputPath,
+			Concurrency: 1,
+			Timeout:     10 * time.Second,
+		}
+	}
+	newRegistry := func() *mocks.MockRegistryClient {
+		registry := mocks.NewMockRegistryClient()
+		registry.ImageManifests["library/nginx:latest"] = sizedManifest(1024, map[string]int64{"sha256:base": 30720, "sha256:nginx": 9216})
+		registry.ImageManifests["library/redis:latest"] = sizedManifest(2048, map[string]int64{"sha256:base": 30720, "sha256:redis": 8192})
+		return registry
+	}
+
+	t.Run("Refuses Oversized Batch", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+		cfg := newConfig(`{"hubsync": ["nginx:latest", "redis:latest"]}`, filepath.Join(t.TempDir(), "output.log"))
+		cfg.MaxTotalSize = 40000
+
+		err := sync.NewSyncerV2(cfg, client, newRegistry()).Run(context.Background())
+		require.Error(t, err)
+		assert.True(t, errors.IsValidationError(err))
+		assert.Contains(t, err.Error(), "exceeds the size budget")
+		assert.Empty(t, client.PulledImages)
+	})
+
+	t.Run("Trims To The Budget", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+		outputPath := filepath.Join(t.TempDir(), "output.log")
+		cfg := newConfig(`{"hubsync": ["nginx:latest", "redis:latest"]}`, outputPath)
+		cfg.Preflight = sync.PreflightTrim
+		cfg.MaxTotalSize = 45 << 10
+
+		require.NoError(t, sync.NewSyncerV2(cfg, client, newRegistry()).Run(context.Background()))
+		assert.Contains(t, client.PulledImages, "nginx:latest")
+		assert.NotContains(t, client.PulledImages, "redis:latest")
+
+		data, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "# Estimated transfer size: 50KB, limit 45KB (size budget)")
+		assert.Contains(t, string(data), "# Trimmed by the size check: redis:latest (10KB)")
+	})
+
+	t.Run("Shared Layers Count Once", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+		cfg := newConfig(`{"hubsync": ["nginx:latest", "redis:latest"]}`, filepath.Join(t.TempDir(), "output.log"))
+		cfg.MaxTotalSize = 50 << 10
+
+		// 40KB for nginx and 10KB for redis, whose base layer is already counted
+		require.NoError(t, sync.NewSyncerV2(cfg, client, newRegistry()).Run(context.Background()))
+		assert.Contains(t, client.PulledImages, "redis:latest")
+	})
+
+	t.Run("Trimmed Images Keep Their Shared Layers", func(t *testing.T) {
+		registry := newRegistry()
+		registry.ImageManifests["library/httpd:latest"] = sizedManifest(1024, map[string]int64{"sha256:base": 30720, "sha256:httpd": 30720})
+		registry.ImageManifests["library/alpine:latest"] = sizedManifest(512, map[string]int64{"sha256:alpine": 4096})
+
+		client := mocks.NewMockDockerClient()
+		cfg := newConfig(`{"hubsync": ["httpd:latest", "redis:latest", "alpine:latest"]}`, filepath.Join(t.TempDir(), "output.log"))
+		cfg.Preflight = sync.PreflightTrim
+		cfg.MaxTotalSize = 35 << 10
+
+		// httpd doesn't fit, so redis needs the base layer it shares with it
+		require.NoError(t, sync.NewSyncerV2(cfg, client, registry).Run(context.Background()))
+		assert.NotContains(t, client.PulledImages, "httpd:latest")
+		assert.NotContains(t, client.PulledImages, "redis:latest")
+		assert.Contains(t, client.PulledImages, "alpine:latest")
+	})
+
+	t.Run("Daemon Platform Of An Index", func(t *testing.T) {
+		registry := mocks.NewMockRegistryClient()
+		registry.ImageManifests["library/nginx:latest"] = []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+			`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:amd64","size":500,"platform":{"os":"linux","architecture":"amd64"}},` +
+			`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:arm64","size":500,"platform":{"os":"linux","architecture":"arm64","variant":"v8"}}]}`)
+		registry.ImageManifests["library/nginx:sha256:amd64"] = sizedManifest(1<<10, map[string]int64{"sha256:amd64-layer": 90 << 10})
+		registry.ImageManifests["library/nginx:sha256:arm64"] = sizedManifest(1<<10, map[string]int64{"sha256:arm64-layer": 9 << 10})
+
+		// The daemon, not hubsync, decides which platform is pulled
+		client := mocks.NewMockDockerClient()
+		client.Daemon.Platform = oci.DaemonPlatform("linux", "aarch64")
+
+		outputPath := filepath.Join(t.TempDir(), "output.log")
+		cfg := newConfig(`{"hubsync": ["nginx:latest"]}`, outputPath)
+		cfg.MaxTotalSize = 20 << 10
+
+		require.NoError(t, sync.NewSyncerV2(cfg, client, registry).Run(context.Background()))
+		data, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "# Estimated transfer size: 10KB")
+	})
+
+	t.Run("Unknown Daemon Platform", func(t *testing.T) {
+		registry := mocks.NewMockRegistryClient()
+		registry.ImageManifests["library/nginx:latest"] = []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+			`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:amd64","size":500,"platform":{"os":"linux","architecture":"amd64"}}]}`)
+		registry.ImageManifests["library/nginx:sha256:amd64"] = sizedManifest(1000, map[string]int64{"sha256:amd64-layer": 90000})
+
+		client := mocks.NewMockDockerClient()
+		client.DaemonError = fmt.Errorf("daemon unreachable")
+
+		outputPath := filepath.Join(t.TempDir(), "output.log")
+		cfg := newConfig(`{"hubsync": ["nginx:latest"]}`, outputPath)
+		cfg.MaxTotalSize = 20000
+
+		require.NoError(t, sync.NewSyncerV2(cfg, client, registry).Run(context.Background()))
+		data, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "(1 images of unknown size)")
+	})
+
+	t.Run("Unknown Sizes Are Kept", func(t *testing.T) {
+		source := mocks.NewRegistryServer()
+		defer source.Close()
+
+		client := mocks.NewMockDockerClient()
+		outputPath := filepath.Join(t.TempDir(), "output.log")
+		cfg := newConfig(`{"hubsync": ["`+source.Host()+`/org/tool:v1"]}`, outputPath)
+		cfg.Preflight = sync.PreflightTrim
+		cfg.MaxTotalSize = 1000
+		cfg.Insecure = true
+
+		require.NoError(t, sync.NewSyncerV2(cfg, client, newRegistry()).Run(context.Background()))
+		assert.Contains(t, client.PulledImages, source.Host()+"/org/tool:v1")
+
+		data, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "(1 images of unknown size)")
+	})
+
+	t.Run("Reads Manifests Of Other Registries", func(t *testing.T) {
+		source := mocks.NewRegistryServer()
+		defer source.Close()
+		source.AddImage("org/tool", "v1", make([]byte, 60<<10))
+
+		cfg := newConfig(`{"hubsync": ["`+source.Host()+`/org/tool:v1"]}`, filepath.Join(t.TempDir(), "output.log"))
+		cfg.MaxTotalSize = 50 << 10
+		cfg.Insecure = true
+
+		err := sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), newRegistry()).Run(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeds the size budget")
+	})
+
+	t.Run("Free Space Of The Cache", func(t *testing.T) {
+		cfg := newConfig(`{"hubsync": ["nginx:latest"]}`, filepath.Join(t.TempDir(), "output.log"))
+		cfg.Transport = transfer.TransportRegistry
+		cfg.CacheDir = t.TempDir()
+		cfg.Preflight = sync.PreflightRefuse
+		cfg.DryRun = true
+
+		require.NoError(t, sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), newRegistry()).Run(context.Background()))
+	})
+
+	t.Run("Disabled By Default", func(t *testing.T) {
+		client := mocks.NewMockDockerClient()
+		cfg := newConfig(`{"hubsync": ["nginx:latest"]}`, filepath.Join(t.TempDir(), "output.log"))
+
+		require.NoError(t, sync.NewSyncerV2(cfg, client, mocks.NewMockRegistryClient()).Run(context.Background()))
+		assert.Contains(t, client.PulledImages, "nginx:latest")
+	})
+}
+
+// TestDaemonPlatform tests mapping the machine architecture a daemon reports to an image platform
+func TestDaemonPlatform(t *testing.T) {
+	tests := map[string]oci.Platform{
+		"x86_64":  {OS: "linux", Architecture: "amd64"},
+		"aarch64": {OS: "linux", Architecture: "arm64"},
+		"armv7l":  {OS: "linux", Architecture: "arm", Variant: "v7"},
+		"armv6l":  {OS: "linux", Architecture: "arm", Variant: "v6"},
+		"i686":    {OS: "linux", Architecture: "386"},
+		"s390x":   {OS: "linux", Architecture: "s390x"},
+		"ppc64le": {OS: "linux", Architecture: "ppc64le"},
+	}
+	for machine, platform := range tests {
+		assert.Equal(t, platform, oci.DaemonPlatform("linux", machine), machine)
+	}
+}
@@ -0,0 +1,120 @@
+package unit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/pkg/bandwidth"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+const pullStream = `{"status":"Pulling from library/nginx","id":"latest"}
+{"status":"Already exists","progressDetail":{},"id":"a2abf6c4d29d"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"a9edb18cadd1"}
+{"status":"Downloading","progressDetail":{"current":1000,"total":4000},"progress":"[====>   ]","id":"a9edb18cadd1"}
+{"status":"Downloading","progressDetail":{"current":3000,"total":4000},"progress":"[======> ]","id":"a9edb18cadd1"}
+{"status":"Verifying Checksum","progressDetail":{},"id":"a9edb18cadd1"}
+{"status":"Download complete","progressDetail":{},"id":"a9edb18cadd1"}
+{"status":"Extracting","progressDetail":{"current":4000,"total":4000},"id":"a9edb18cadd1"}
+{"status":"Pull complete","progressDetail":{},"id":"a9edb18cadd1"}
+{"status":"Digest: sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"}
+{"status":"Status: Downloaded newer image for nginx:latest"}
+`
+
+const pushStream = `{"status":"The push refers to repository [registry.example.com/mirror/nginx]"}
+{"status":"Preparing","progressDetail":{},"id":"d874fd2bc83b"}
+{"status":"Preparing","progressDetail":{},"id":"32ce5f6a5106"}
+{"status":"Layer already exists","progressDetail":{},"id":"32ce5f6a5106"}
+{"status":"Pushing","progressDetail":{"current":2048,"total":6000},"progress":"[==>   ]","id":"d874fd2bc83b"}
+{"status":"Pushing","progressDetail":{"current":6000,"total":6000},"progress":"[======]","id":"d874fd2bc83b"}
+{"status":"Pushed","progressDetail":{},"id":"d874fd2bc83b"}
+{"status":"latest: digest: sha256:9a0c2f4e6f0e1b0a8c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b size: 1570"}
+{"progressDetail":{},"aux":{"Tag":"latest","Digest":"sha256:9a0c2f4e6f0e1b0a8c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b","Size":1570}}
+`
+
+// TestReadProgress tests decoding of daemon pull and push output streams
+func TestReadProgress(t *testing.T) {
+	t.Run("Pull", func(t *testing.T) {
+		progress, err := docker.ReadProgress(context.Background(), strings.NewReader(pullStream), "nginx:latest", "docker.io", nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31", progress.Digest)
+		require.Len(t, progress.Layers, 2)
+		assert.True(t, progress.Layers[0].Skipped())
+		assert.Equal(t, "Pull complete", progress.Layers[1].Status)
+
+		// Extraction doesn't count, the download completes the layer
+		assert.Equal(t, int64(4000), progress.Size())
+		assert.Equal(t, int64(4000), progress.BytesMoved())
+		assert.Equal(t, 1, progress.SkippedLayers())
+	})
+
+	t.Run("Push", func(t *testing.T) {
+		progress, err := docker.ReadProgress(context.Background(), strings.NewReader(pushStream), "registry.example.com/mirror/nginx:latest", "registry.example.com", nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, "sha256:9a0c2f4e6f0e1b0a8c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b", progress.Digest)
+		require.Len(t, progress.Layers, 2)
+		assert.Equal(t, int64(6000), progress.BytesMoved())
+		assert.Equal(t, 1, progress.SkippedLayers())
+	})
+
+	t.Run("Error Detail", func(t *testing.T) {
+		stream := `{"status":"Pulling from library/nginx","id":"missing"}
+{"errorDetail":{"message":"manifest for nginx:missing not found: manifest unknown"},"error":"manifest for nginx:missing not found: manifest unknown"}
+`
+		_, err := docker.ReadProgress(context.Background(), strings.NewReader(stream), "nginx:missing", "docker.io", nil)
+		require.Error(t, err)
+		assert.True(t, errors.IsOperationError(err))
+		assert.Contains(t, err.Error(), "manifest unknown")
+	})
+
+	t.Run("Broken Stream", func(t *testing.T) {
+		_, err := docker.ReadProgress(context.Background(), strings.NewReader(`{"status":`), "nginx:latest", "docker.io", nil)
+		require.Error(t, err)
+		assert.True(t, errors.IsIOError(err))
+	})
+
+	t.Run("Charges Bandwidth", func(t *testing.T) {
+		limits := bandwidth.NewLimits(0, nil)
+		_, err := docker.ReadProgress(context.Background(), strings.NewReader(pullStream), "nginx:latest", "docker.io", limits)
+		require.NoError(t, err)
+		assert.Greater(t, limits.Throughput()["docker.io"], 0.0)
+	})
+}
+
+// TestDaemonEngineProgress tests that daemon transfers report sizes and digests
+func TestDaemonEngineProgress(t *testing.T) {
+	client := mocks.NewMockDockerClient()
+	client.PullProgress["nginx:latest"] = &docker.Progress{
+		Digest: "sha256:source",
+		Layers: []*docker.LayerProgress{
+			{ID: "a2abf6c4d29d", Status: "Already exists"},
+			{ID: "a9edb18cadd1", Status: "Pull complete", Moved: 4000, Size: 4000},
+		},
+	}
+	client.PushProgress["registry.example.com/mirror/nginx:latest"] = &docker.Progress{
+		Digest: "sha256:target",
+		Layers: []*docker.LayerProgress{
+			{ID: "d874fd2bc83b", Status: "Pushed", Moved: 6000, Size: 6000},
+			{ID: "32ce5f6a5106", Status: "Layer already exists"},
+		},
+	}
+
+	report, err := transfer.NewDaemonEngine(client, nil).Transfer(context.Background(),
+		&docker.ImageReference{FullName: "nginx:latest"},
+		&docker.ImageReference{FullName: "registry.example.com/mirror/nginx:latest"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "sha256:source", report.SourceDigest)
+	assert.Equal(t, "sha256:target", report.TargetDigest)
+	assert.Equal(t, int64(4000), report.ImageSize)
+	assert.Equal(t, int64(6000), report.BytesMoved)
+	assert.Contains(t, report.Logs, "Layer 32ce5f6a5106: Layer already exists (0 of 0 bytes)")
+}
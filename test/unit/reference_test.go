@@ -0,0 +1,64 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/pkg/oci"
+)
+
+// TestParseReference tests normalization of image references
+func TestParseReference(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected oci.Reference
+	}{
+		{
+			name:     "Docker Hub short name",
+			input:    "nginx",
+			expected: oci.Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "latest"},
+		},
+		{
+			name:     "Docker Hub user image with tag",
+			input:    "yugasun/alpine:v1",
+			expected: oci.Reference{Registry: "docker.io", Repository: "yugasun/alpine", Tag: "v1"},
+		},
+		{
+			name:     "Registry with nested path",
+			input:    "ghcr.io/org/team/app:1.0",
+			expected: oci.Reference{Registry: "ghcr.io", Repository: "org/team/app", Tag: "1.0"},
+		},
+		{
+			name:     "Registry with port",
+			input:    "localhost:5000/app",
+			expected: oci.Reference{Registry: "localhost:5000", Repository: "app", Tag: "latest"},
+		},
+		{
+			name:  "Digest reference",
+			input: "quay.io/org/app@sha256:abc",
+			expected: oci.Reference{Registry: "quay.io", Repository: "org/app",
+				Digest: "sha256:abc"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ref, err := oci.ParseReference(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, ref)
+		})
+	}
+
+	t.Run("Docker Hub API host", func(t *testing.T) {
+		ref, err := oci.ParseReference("nginx:latest")
+		require.NoError(t, err)
+		assert.Equal(t, "registry-1.docker.io", ref.APIHost())
+	})
+
+	t.Run("Empty reference", func(t *testing.T) {
+		_, err := oci.ParseReference("")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,205 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+const sbomType = "application/spdx+json"
+
+// TestRegistryEngineCopyReferrers tests copying cosign tags and OCI referrers
+func TestRegistryEngineCopyReferrers(t *testing.T) {
+	t.Run("Cosign Tags And Referrers API", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+		src.ReferrersAPI = true
+		dst.ReferrersAPI = true
+
+		digest := src.AddImage("library/nginx", "latest", []byte("nginx-layer"))
+		signature := src.AddImage("library/nginx", oci.CosignTag(digest, "sig"), []byte("signature"))
+		sbom := src.AddArtifact("library/nginx", "", digest, sbomType, []byte(`{"spdxVersion":"SPDX-2.3"}`))
+
+		engine := newTestEngine(nil)
+		engine.SetReferrers(true)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+		require.NoError(t, err)
+
+		require.Len(t, report.Artifacts, 2)
+		assert.Equal(t, transfer.Artifact{
+			Kind:      transfer.ArtifactSignature,
+			Reference: oci.CosignTag(digest, "sig"),
+			Digest:    signature,
+		}, report.Artifacts[0])
+		assert.Equal(t, transfer.Artifact{
+			Kind:         transfer.ArtifactReferrer,
+			Reference:    sbom,
+			Digest:       sbom,
+			ArtifactType: sbomType,
+		}, report.Artifacts[1])
+
+		stored, ok := dst.Manifest("mirror/nginx", oci.CosignTag(digest, "sig"))
+		require.True(t, ok)
+		assert.Equal(t, signature, oci.ComputeDigest(stored.Data))
+		_, ok = dst.Manifest("mirror/nginx", sbom)
+		assert.True(t, ok)
+		assert.True(t, dst.HasBlob("mirror/nginx", oci.ComputeDigest([]byte(`{"spdxVersion":"SPDX-2.3"}`))))
+
+		// The target lists referrers itself, no fallback tag is needed
+		_, ok = dst.Manifest("mirror/nginx", oci.ReferrersTag(digest))
+		assert.False(t, ok)
+	})
+
+	t.Run("Tag Schema Fallback", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		digest := src.AddImage("library/nginx", "latest", []byte("nginx-layer"))
+		sbom := src.AddArtifact("library/nginx", "", digest, sbomType, []byte("sbom"))
+		m, _ := src.Manifest("library/nginx", sbom)
+		fallback, _ := json.Marshal(oci.Index{
+			SchemaVersion: 2,
+			MediaType:     oci.MediaTypeOCIIndex,
+			Manifests: []oci.Descriptor{{
+				MediaType:    oci.MediaTypeOCIManifest,
+				Digest:       sbom,
+				Size:         int64(len(m.Data)),
+				ArtifactType: sbomType,
+			}},
+		})
+		src.AddManifest("library/nginx", oci.ReferrersTag(digest), oci.MediaTypeOCIIndex, fallback)
+
+		engine := newTestEngine(nil)
+		engine.SetReferrers(true)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+		require.NoError(t, err)
+		require.Len(t, report.Artifacts, 1)
+		assert.Equal(t, sbomType, report.Artifacts[0].ArtifactType)
+
+		stored, ok := dst.Manifest("mirror/nginx", oci.ReferrersTag(digest))
+		require.True(t, ok)
+		index, err := oci.ParseIndex(stored.Data)
+		require.NoError(t, err)
+		require.Len(t, index.Manifests, 1)
+		assert.Equal(t, sbom, index.Manifests[0].Digest)
+	})
+
+	t.Run("Denied Referrers Are Skipped", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+		src.DenyReferrers = true
+
+		digest := src.AddImage("library/nginx", "latest", []byte("nginx-layer"))
+		src.AddImage("library/nginx", oci.CosignTag(digest, "sig"), []byte("signature"))
+
+		engine := newTestEngine(nil)
+		engine.SetReferrers(true)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+		require.NoError(t, err)
+
+		// What was copied before the failure is kept
+		_, ok := dst.Manifest("mirror/nginx", "latest")
+		assert.True(t, ok)
+		require.Len(t, report.Artifacts, 1)
+		assert.Equal(t, transfer.ArtifactSignature, report.Artifacts[0].Kind)
+		assert.Contains(t, strings.Join(report.Logs, "\n"), "Referrer copy failed, keeping the image without them")
+	})
+
+	t.Run("Required Referrers Fail The Image", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+		src.DenyReferrers = true
+
+		src.AddImage("library/nginx", "latest", []byte("nginx-layer"))
+
+		engine := newTestEngine(nil)
+		engine.SetRequireReferrers(true)
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to list referrers")
+	})
+
+	t.Run("Disabled By Default", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		digest := src.AddImage("library/nginx", "latest", []byte("nginx-layer"))
+		src.AddImage("library/nginx", oci.CosignTag(digest, "sig"), []byte("signature"))
+
+		report, err := newTestEngine(nil).Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"})
+		require.NoError(t, err)
+		assert.Empty(t, report.Artifacts)
+		_, ok := dst.Manifest("mirror/nginx", oci.CosignTag(digest, "sig"))
+		assert.False(t, ok)
+	})
+}
+
+// TestSyncerV2CopyReferrers tests that copied artifacts are listed in the output
+func TestSyncerV2CopyReferrers(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+	src.ReferrersAPI = true
+
+	digest := src.AddImage("library/nginx", "latest", []byte("nginx-layer"))
+	src.AddImage("library/nginx", oci.CosignTag(digest, "att"), []byte("attestation"))
+	sbom := src.AddArtifact("library/nginx", "", digest, sbomType, []byte("sbom"))
+
+	outputPath := filepath.Join(t.TempDir(), "output.log")
+	cfg := &config.Config{
+		Repository:    dst.Host(),
+		Namespace:     "mirror",
+		Content:       `{"hubsync": ["` + src.Host() + `/library/nginx:latest"]}`,
+		MaxContent:    10,
+		OutputPath:    outputPath,
+		Concurrency:   1,
+		Timeout:       10 * time.Second,
+		Transport:     transfer.TransportRegistry,
+		Insecure:      true,
+		CopyReferrers: true,
+	}
+	require.NoError(t, sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient()).Run(context.Background()))
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "#   attestation "+oci.CosignTag(digest, "att"))
+	assert.Contains(t, string(data), "#   referrer "+sbom+" ("+sbomType+")")
+
+	// The target has no referrers API, so the fallback tag lists the SBOM
+	_, ok := dst.Manifest("mirror/nginx", oci.ReferrersTag(digest))
+	assert.True(t, ok)
+}
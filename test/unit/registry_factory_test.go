@@ -0,0 +1,86 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/registry"
+)
+
+// TestRegistryFactory tests picking the registry implementation from config and URL
+func TestRegistryFactory(t *testing.T) {
+	t.Run("Detects Provider From Host", func(t *testing.T) {
+		tests := map[string]registry.Provider{
+			"":                       registry.DockerHub,
+			"docker.io":              registry.DockerHub,
+			"index.docker.io/mirror": registry.DockerHub,
+			"123456789012.dkr.ecr.us-east-1.amazonaws.com":     registry.ECR,
+			"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn": registry.ECR,
+			"gcr.io":                         registry.GCR,
+			"eu.gcr.io/mirror-project":       registry.GCR,
+			"us-docker.pkg.dev/project/repo": registry.GCR,
+			"mirror.azurecr.io":              registry.ACR,
+			"https://Mirror.AzureCR.io":      registry.ACR,
+			"ghcr.io/org":                    registry.GHCR,
+			"harbor.example.com/library":     registry.Custom,
+			"http://localhost:5000":          registry.Custom,
+			"registry.example.com":           registry.Custom,
+		}
+		for url, provider := range tests {
+			assert.Equal(t, provider, registry.Detect(url), url)
+		}
+	})
+
+	t.Run("Creates Provider Client", func(t *testing.T) {
+		tests := []struct {
+			config registry.RegistryConfig
+			client interface{}
+		}{
+			{registry.RegistryConfig{URL: ""}, &registry.DockerHubRegistry{}},
+			{registry.RegistryConfig{URL: "123456789012.dkr.ecr.us-east-1.amazonaws.com"}, &registry.ECRRegistry{}},
+			{registry.RegistryConfig{URL: "us-docker.pkg.dev/project/repo"}, &registry.GCRRegistry{}},
+			{registry.RegistryConfig{URL: "mirror.azurecr.io"}, &registry.ACRRegistry{}},
+			{registry.RegistryConfig{URL: "ghcr.io/org"}, &registry.GenericRegistry{}},
+			{registry.RegistryConfig{URL: "harbor.example.com/library"}, &registry.GenericRegistry{}},
+			{registry.RegistryConfig{URL: "harbor.example.com/library", Provider: registry.Harbor}, &registry.HarborRegistry{}},
+			{registry.RegistryConfig{URL: "registry.example.com"}, &registry.GenericRegistry{}},
+			{registry.RegistryConfig{URL: "registry.example.com", Provider: registry.ACR}, &registry.ACRRegistry{}},
+		}
+		for _, tt := range tests {
+			client, err := registry.NewRegistry(tt.config, registry.ProviderOptions{})
+			require.NoError(t, err)
+			assert.IsType(t, tt.client, client, tt.config.URL)
+			client.Close()
+		}
+	})
+
+	t.Run("Unknown Provider", func(t *testing.T) {
+		_, err := registry.NewRegistry(registry.RegistryConfig{Provider: "quay"}, registry.ProviderOptions{})
+		require.Error(t, err)
+		assert.True(t, errors.IsConfigError(err))
+		assert.Contains(t, err.Error(), "must be one of")
+	})
+
+	t.Run("Registers In-House Provider", func(t *testing.T) {
+		var created registry.RegistryConfig
+		var tenant string
+		registry.Register("inhouse", func(config registry.RegistryConfig, options registry.ProviderOptions) (registry.RegistryInterface, error) {
+			created = config
+			tenant = options.Extra["tenant"]
+			return registry.NewGenericRegistry(config), nil
+		}, func(host string) bool { return host == "registry.corp.example" })
+
+		assert.True(t, registry.IsRegistered("inhouse"))
+		assert.Contains(t, registry.Providers(), "inhouse")
+		assert.Equal(t, registry.Provider("inhouse"), registry.Detect("registry.corp.example/team"))
+
+		client, err := registry.NewRegistry(registry.RegistryConfig{URL: "registry.corp.example/team"},
+			registry.ProviderOptions{Extra: map[string]string{"tenant": "team-a"}})
+		require.NoError(t, err)
+		defer client.Close()
+		assert.Equal(t, registry.Provider("inhouse"), created.Provider)
+		assert.Equal(t, "team-a", tenant)
+	})
+}
@@ -11,7 +11,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/registry"
 	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
 	"github.com/yugasun/hubsync/test/mocks"
 )
 
@@ -361,4 +364,174 @@ func TestSyncerCustomImageNames(t *testing.T) {
 		assert.Contains(t, content, "docker pull")
 		assert.Contains(t, content, "docker.io/testns/custom-nginx:latest")
 	})
+
+	t.Run("Digest Pinned Source", func(t *testing.T) {
+		mockDockerClient := mocks.NewMockDockerClient()
+		mockRegistryClient := mocks.NewMockRegistryClient()
+
+		digest := "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+		cfg := &config.Config{
+			Username:    "testuser",
+			Password:    "testpass",
+			Repository:  "docker.io",
+			Namespace:   "testns",
+			Content:     `{"hubsync": ["nginx:1.25@` + digest + `"]}`,
+			MaxContent:  10,
+			OutputPath:  outputPath,
+			Concurrency: 1,
+			Timeout:     10 * time.Second,
+		}
+
+		syncer := sync.NewSyncerV2(cfg, mockDockerClient, mockRegistryClient)
+		require.NoError(t, syncer.Run(context.Background()))
+
+		assert.True(t, mockDockerClient.PulledImages["nginx:1.25@"+digest])
+		assert.True(t, mockDockerClient.PushedImages["docker.io/testns/nginx:1.25"])
+	})
+}
+
+// TestSyncerV2ValidateTarget tests that up-to-date targets are skipped unless forced
+func TestSyncerV2ValidateTarget(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "output.log")
+	digest := "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+
+	newConfig := func(concurrency int, force bool) *config.Config {
+		return &config.Config{
+			Username:    "testuser",
+			Password:    "testpass",
+			Repository:  "docker.io",
+			Namespace:   "testns",
+			Content:     `{"hubsync": ["nginx:latest", "alpine:3.18"]}`,
+			MaxContent:  10,
+			OutputPath:  outputPath,
+			Concurrency: concurrency,
+			Timeout:     10 * time.Second,
+			Force:       force,
+		}
+	}
+
+	newRegistryClient := func() *mocks.MockRegistryClient {
+		mockRegistryClient := mocks.NewMockRegistryClient()
+		mockRegistryClient.ImageDigests["nginx:latest"] = digest
+		mockRegistryClient.ImageDigests["docker.io/testns/nginx:latest"] = digest
+		mockRegistryClient.ImageDigests["alpine:3.18"] = digest
+		mockRegistryClient.ImageDigests["docker.io/testns/alpine:3.18"] = "sha256:outdated"
+		return mockRegistryClient
+	}
+
+	for _, concurrency := range []int{1, 2} {
+		t.Run(fmt.Sprintf("Skip Up To Date Target With Concurrency %d", concurrency), func(t *testing.T) {
+			mockDockerClient := mocks.NewMockDockerClient()
+			syncer := sync.NewSyncerV2(newConfig(concurrency, false), mockDockerClient, newRegistryClient())
+
+			require.NoError(t, syncer.Run(context.Background()))
+			assert.Equal(t, 1, syncer.GetProcessedImageCount())
+			assert.False(t, mockDockerClient.PulledImages["nginx:latest"])
+			assert.True(t, mockDockerClient.PulledImages["alpine:3.18"])
+
+			data, err := os.ReadFile(outputPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(data), "1 successful, 0 failed, 1 skipped")
+			assert.Contains(t, string(data), "docker pull docker.io/testns/nginx:latest # (up to date with nginx:latest, skipped)")
+		})
+	}
+
+	t.Run("Force Transfers Up To Date Target", func(t *testing.T) {
+		mockDockerClient := mocks.NewMockDockerClient()
+		syncer := sync.NewSyncerV2(newConfig(1, true), mockDockerClient, newRegistryClient())
+
+		require.NoError(t, syncer.Run(context.Background()))
+		assert.Equal(t, 2, syncer.GetProcessedImageCount())
+		assert.True(t, mockDockerClient.PulledImages["nginx:latest"])
+	})
+
+	t.Run("Resolution Error Transfers Anyway", func(t *testing.T) {
+		mockDockerClient := mocks.NewMockDockerClient()
+		mockRegistryClient := newRegistryClient()
+		mockRegistryClient.DigestErrors["docker.io/testns/nginx:latest"] = fmt.Errorf("registry unavailable")
+		syncer := sync.NewSyncerV2(newConfig(1, false), mockDockerClient, mockRegistryClient)
+
+		require.NoError(t, syncer.Run(context.Background()))
+		assert.True(t, mockDockerClient.PulledImages["nginx:latest"])
+	})
+
+	// The daemon pushed the manifest of its own platform of the index
+	newIndexRegistries := func(t *testing.T) (*mocks.RegistryServer, *mocks.RegistryServer) {
+		src := mocks.NewRegistryServer()
+		t.Cleanup(src.Close)
+		dst := mocks.NewRegistryServer()
+		t.Cleanup(dst.Close)
+
+		src.AddMultiArchImage("library/alpine", "3.18", "linux/amd64", "linux/arm64")
+		amd64 := src.AddImage("library/alpine", "", []byte("layer-linux/amd64"))
+		stored, ok := src.Manifest("library/alpine", amd64)
+		require.True(t, ok)
+		dst.AddManifest("testns/alpine", "3.18", oci.MediaTypeOCIManifest, stored.Data)
+		return src, dst
+	}
+	newIndexConfig := func(src, dst *mocks.RegistryServer) *config.Config {
+		return &config.Config{
+			Repository:  dst.Host(),
+			Namespace:   "testns",
+			Content:     `{"hubsync": ["` + src.Host() + `/library/alpine:3.18"]}`,
+			MaxContent:  10,
+			OutputPath:  outputPath,
+			Concurrency: 1,
+			Timeout:     10 * time.Second,
+			Insecure:    true,
+		}
+	}
+
+	t.Run("Daemon Platform Of An Index", func(t *testing.T) {
+		src, dst := newIndexRegistries(t)
+		mockDockerClient := mocks.NewMockDockerClient()
+		registryClient := registry.NewGenericRegistry(registry.RegistryConfig{URL: dst.Host(), Insecure: true})
+		defer registryClient.Close()
+
+		syncer := sync.NewSyncerV2(newIndexConfig(src, dst), mockDockerClient, registryClient)
+		require.NoError(t, syncer.Run(context.Background()))
+		assert.Empty(t, mockDockerClient.PulledImages)
+
+		data, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "0 successful, 0 failed, 1 skipped")
+	})
+
+	t.Run("Other Daemon Platform Of An Index", func(t *testing.T) {
+		src, dst := newIndexRegistries(t)
+		mockDockerClient := mocks.NewMockDockerClient()
+		mockDockerClient.Daemon.Platform = oci.Platform{OS: "linux", Architecture: "arm64"}
+		registryClient := registry.NewGenericRegistry(registry.RegistryConfig{URL: dst.Host(), Insecure: true})
+		defer registryClient.Close()
+
+		syncer := sync.NewSyncerV2(newIndexConfig(src, dst), mockDockerClient, registryClient)
+		require.NoError(t, syncer.Run(context.Background()))
+		assert.Equal(t, 1, syncer.GetProcessedImageCount())
+		assert.True(t, mockDockerClient.PulledImages[src.Host()+"/library/alpine:3.18"])
+	})
+
+	t.Run("Converted Layers Are Not Validated", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		digest := src.AddImage("library/nginx", "latest", gzipped(t, []byte("layer")))
+		stored, ok := src.Manifest("library/nginx", digest)
+		require.True(t, ok)
+		dst.AddManifest("testns/nginx", "latest", oci.MediaTypeOCIManifest, stored.Data)
+
+		cfg := newIndexConfig(src, dst)
+		cfg.Content = `{"hubsync": ["` + src.Host() + `/library/nginx:latest"]}`
+		cfg.Transport = transfer.TransportRegistry
+		cfg.ConvertLayers = "zstd"
+
+		syncer := sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient())
+		require.NoError(t, syncer.Run(context.Background()))
+		assert.Equal(t, 1, syncer.GetProcessedImageCount())
+
+		converted, ok := dst.Manifest("testns/nginx", "latest")
+		require.True(t, ok)
+		assert.NotEqual(t, digest, oci.ComputeDigest(converted.Data))
+	})
 }
@@ -0,0 +1,682 @@
+package unit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yugasun/hubsync/internal/config"
+	"github.com/yugasun/hubsync/pkg/docker"
+	"github.com/yugasun/hubsync/pkg/errors"
+	"github.com/yugasun/hubsync/pkg/oci"
+	"github.com/yugasun/hubsync/pkg/registry"
+	"github.com/yugasun/hubsync/pkg/sync"
+	"github.com/yugasun/hubsync/pkg/transfer"
+	"github.com/yugasun/hubsync/test/mocks"
+)
+
+// newTestEngine creates a registry engine that talks plain HTTP to mock registries
+func newTestEngine(creds oci.CredentialFunc) *transfer.RegistryEngine {
+	return transfer.NewRegistryEngine(oci.NewClient(oci.ClientConfig{
+		PlainHTTP:   true,
+		Credentials: creds,
+	}), nil)
+}
+
+// TestRegistryEngineTransfer tests daemonless copies between registries
+func TestRegistryEngineTransfer(t *testing.T) {
+	t.Run("Copy Single Platform Image", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		digest := src.AddImage("library/nginx", "latest", []byte("layer-one"), []byte("layer-two"))
+
+		engine := newTestEngine(nil)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/testns/nginx:latest"},
+		)
+
+		require.NoError(t, err)
+		assert.Equal(t, report.ImageSize, report.BytesMoved)
+		assert.Greater(t, report.BytesMoved, int64(0))
+		assert.Equal(t, 3, dst.BlobUploads)
+
+		stored, ok := dst.Manifest("testns/nginx", "latest")
+		require.True(t, ok)
+		assert.Equal(t, digest, oci.ComputeDigest(stored.Data))
+		assert.Equal(t, oci.MediaTypeOCIManifest, stored.MediaType)
+	})
+
+	t.Run("Token Authentication", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+		dst.Username = "testuser"
+		dst.Password = "testpass"
+
+		src.AddImage("library/alpine", "3.18", []byte("alpine-layer"))
+
+		engine := newTestEngine(oci.StaticCredentials(
+			oci.Credentials{Username: "testuser", Password: "testpass"}, dst.Host()))
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/alpine:3.18"},
+			&docker.ImageReference{FullName: dst.Host() + "/testns/alpine:3.18"},
+		)
+
+		require.NoError(t, err)
+		assert.Equal(t, 1, dst.TokenIssued, "token should be cached per scope")
+		_, ok := dst.Manifest("testns/alpine", "3.18")
+		assert.True(t, ok)
+	})
+
+	t.Run("Wrong Credentials", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+		dst.Username = "testuser"
+		dst.Password = "testpass"
+
+		src.AddImage("library/alpine", "3.18", []byte("alpine-layer"))
+
+		engine := newTestEngine(oci.StaticCredentials(
+			oci.Credentials{Username: "testuser", Password: "wrong"}, dst.Host()))
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/alpine:3.18"},
+			&docker.ImageReference{FullName: dst.Host() + "/testns/alpine:3.18"},
+		)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "token request")
+	})
+
+	t.Run("Copy Multi-Platform Index", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		indexDigest := src.AddMultiArchImage("library/busybox", "latest", "linux/amd64", "linux/arm64/v8")
+
+		engine := newTestEngine(nil)
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/busybox:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/testns/busybox:latest"},
+		)
+
+		require.NoError(t, err)
+		stored, ok := dst.Manifest("testns/busybox", "latest")
+		require.True(t, ok)
+		assert.Equal(t, oci.MediaTypeOCIIndex, stored.MediaType)
+		assert.Equal(t, indexDigest, oci.ComputeDigest(stored.Data))
+
+		index, err := oci.ParseIndex(stored.Data)
+		require.NoError(t, err)
+		require.Len(t, index.Manifests, 2)
+		for _, child := range index.Manifests {
+			childManifest, ok := dst.Manifest("testns/busybox", child.Digest)
+			require.True(t, ok, "missing child manifest for %s", child.Platform)
+
+			image, err := oci.ParseManifest(childManifest.Data)
+			require.NoError(t, err)
+			for _, layer := range image.Layers {
+				assert.True(t, dst.HasBlob("testns/busybox", layer.Digest))
+			}
+		}
+	})
+
+	t.Run("Missing Source Image", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		engine := newTestEngine(nil)
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/missing:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/testns/missing:latest"},
+		)
+
+		require.Error(t, err)
+		assert.True(t, oci.IsNotFound(err))
+	})
+}
+
+// TestSyncerV2RegistryTransport tests a full run with the registry transport
+func TestSyncerV2RegistryTransport(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+
+	src.AddImage("library/nginx", "latest", []byte("nginx-layer"))
+	src.AddImage("library/alpine", "3.18", []byte("alpine-layer"))
+
+	outputPath := filepath.Join(t.TempDir(), "output.log")
+	cfg := &config.Config{
+		Username:    "testuser",
+		Password:    "testpass",
+		Repository:  dst.Host(),
+		Namespace:   "testns",
+		Content:     `{"hubsync": ["` + src.Host() + `/library/nginx:latest", "` + src.Host() + `/library/alpine:3.18"]}`,
+		MaxContent:  10,
+		OutputPath:  outputPath,
+		Concurrency: 2,
+		Timeout:     10 * time.Second,
+		Transport:   transfer.TransportRegistry,
+		Insecure:    true,
+	}
+
+	// The docker client must not be used by the registry transport
+	mockDockerClient := mocks.NewMockDockerClient()
+	syncer := sync.NewSyncerV2(cfg, mockDockerClient, mocks.NewMockRegistryClient())
+
+	require.NoError(t, syncer.Run(context.Background()))
+	assert.Equal(t, 2, syncer.GetProcessedImageCount())
+	assert.Empty(t, mockDockerClient.PulledImages)
+
+	_, ok := dst.Manifest("testns/nginx", "latest")
+	assert.True(t, ok)
+	_, ok = dst.Manifest("testns/alpine", "3.18")
+	assert.True(t, ok)
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "docker pull "+dst.Host()+"/testns/nginx:latest")
+	assert.Contains(t, string(data), "digest verified")
+	assert.Contains(t, string(data), "# Digest verification: 2 verified, 0 mismatched")
+}
+
+// TestRegistryEngineSkipExistingBlobs tests that blobs already in the target are not uploaded again
+func TestRegistryEngineSkipExistingBlobs(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+
+	baseLayer := []byte("shared-base-layer")
+	src.AddImage("library/app", "v1", baseLayer, []byte("app-v1"))
+	src.AddImage("library/app", "v2", baseLayer, []byte("app-v2"))
+
+	engine := newTestEngine(nil)
+	first, err := engine.Transfer(context.Background(),
+		&docker.ImageReference{FullName: src.Host() + "/library/app:v1"},
+		&docker.ImageReference{FullName: dst.Host() + "/testns/app:v1"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), first.BytesSkipped)
+	uploadsAfterFirst := dst.BlobUploads
+
+	second, err := engine.Transfer(context.Background(),
+		&docker.ImageReference{FullName: src.Host() + "/library/app:v2"},
+		&docker.ImageReference{FullName: dst.Host() + "/testns/app:v2"},
+	)
+	require.NoError(t, err)
+
+	// Only the new config and the new top layer are uploaded
+	assert.Equal(t, 2, dst.BlobUploads-uploadsAfterFirst)
+	assert.Equal(t, int64(len(baseLayer)), second.BytesSkipped)
+	assert.Equal(t, second.ImageSize, second.BytesMoved+second.BytesSkipped)
+}
+
+// TestRegistryEngineCrossRepositoryMount tests blob mounting within a single registry
+func TestRegistryEngineCrossRepositoryMount(t *testing.T) {
+	t.Run("Mount Blobs", func(t *testing.T) {
+		reg := mocks.NewRegistryServer()
+		defer reg.Close()
+
+		reg.AddImage("team-a/app", "v1", []byte("layer-one"), []byte("layer-two"))
+
+		engine := newTestEngine(nil)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: reg.Host() + "/team-a/app:v1"},
+			&docker.ImageReference{FullName: reg.Host() + "/mirror/app:v1"},
+		)
+
+		require.NoError(t, err)
+		assert.Equal(t, 3, report.BlobsMounted)
+		assert.Equal(t, 3, reg.BlobMounts)
+		assert.Equal(t, 0, reg.BlobUploads)
+		assert.Equal(t, int64(0), report.BytesMoved)
+		_, ok := reg.Manifest("mirror/app", "v1")
+		assert.True(t, ok)
+	})
+
+	t.Run("Fallback To Upload When Refused", func(t *testing.T) {
+		reg := mocks.NewRegistryServer()
+		defer reg.Close()
+		reg.RefuseMounts = true
+
+		reg.AddImage("team-a/app", "v1", []byte("layer-one"))
+
+		engine := newTestEngine(nil)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: reg.Host() + "/team-a/app:v1"},
+			&docker.ImageReference{FullName: reg.Host() + "/mirror/app:v1"},
+		)
+
+		require.NoError(t, err)
+		assert.Equal(t, 0, report.BlobsMounted)
+		assert.Equal(t, 2, reg.BlobUploads)
+		assert.True(t, reg.HasBlob("mirror/app", oci.ComputeDigest([]byte("layer-one"))))
+	})
+}
+
+// TestSyncerV2MountedBlobStatistics tests that mounted blobs are counted in the run statistics
+func TestSyncerV2MountedBlobStatistics(t *testing.T) {
+	reg := mocks.NewRegistryServer()
+	defer reg.Close()
+
+	reg.AddImage("team-a/app", "v1", []byte("layer-one"))
+
+	outputPath := filepath.Join(t.TempDir(), "output.log")
+	cfg := &config.Config{
+		Repository:  reg.Host(),
+		Namespace:   "mirror",
+		Content:     `{"hubsync": ["` + reg.Host() + `/team-a/app:v1"]}`,
+		MaxContent:  10,
+		OutputPath:  outputPath,
+		Concurrency: 1,
+		Timeout:     10 * time.Second,
+		Transport:   transfer.TransportRegistry,
+		Insecure:    true,
+	}
+
+	syncer := sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient())
+	require.NoError(t, syncer.Run(context.Background()))
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# Mounted blobs: 2")
+}
+
+// TestRegistryEnginePlatformFilter tests copying a subset of a multi-platform image
+func TestRegistryEnginePlatformFilter(t *testing.T) {
+	t.Run("Reduced Index", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		indexDigest := src.AddMultiArchImage("library/busybox", "latest",
+			"linux/amd64", "linux/arm64/v8", "linux/s390x", "windows/amd64")
+
+		engine := newTestEngine(nil)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{
+				FullName:  src.Host() + "/library/busybox:latest",
+				Platforms: []string{"linux/amd64", "linux/arm64"},
+			},
+			&docker.ImageReference{FullName: dst.Host() + "/testns/busybox:latest"},
+		)
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"linux/s390x", "windows/amd64"}, report.FilteredPlatforms)
+
+		stored, ok := dst.Manifest("testns/busybox", "latest")
+		require.True(t, ok)
+		assert.NotEqual(t, indexDigest, oci.ComputeDigest(stored.Data))
+
+		index, err := oci.ParseIndex(stored.Data)
+		require.NoError(t, err)
+		require.Len(t, index.Manifests, 2)
+		assert.Equal(t, "linux/amd64", index.Manifests[0].Platform.String())
+		assert.Equal(t, "linux/arm64/v8", index.Manifests[1].Platform.String())
+		assert.False(t, dst.HasBlob("testns/busybox", oci.ComputeDigest([]byte("layer-linux/s390x"))))
+	})
+
+	t.Run("No Matching Platform", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		src.AddMultiArchImage("library/busybox", "latest", "linux/amd64")
+
+		engine := newTestEngine(nil)
+		_, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{
+				FullName:  src.Host() + "/library/busybox:latest",
+				Platforms: []string{"linux/riscv64"},
+			},
+			&docker.ImageReference{FullName: dst.Host() + "/testns/busybox:latest"},
+		)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "linux/riscv64")
+		assert.Equal(t, 0, dst.ManifestPuts)
+	})
+}
+
+// TestSyncerV2PlatformFilter tests the global platform filter and its per-image override
+func TestSyncerV2PlatformFilter(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+
+	src.AddMultiArchImage("library/nginx", "latest", "linux/amd64", "linux/arm64", "linux/ppc64le")
+	src.AddMultiArchImage("library/alpine", "3.18", "linux/amd64", "linux/arm64", "linux/ppc64le")
+
+	outputPath := filepath.Join(t.TempDir(), "output.log")
+	cfg := &config.Config{
+		Repository: dst.Host(),
+		Namespace:  "testns",
+		Content: `{"hubsync": ["` + src.Host() + `/library/nginx:latest", ` +
+			`{"image": "` + src.Host() + `/library/alpine:3.18", "platforms": ["linux/ppc64le"]}]}`,
+		MaxContent:  10,
+		OutputPath:  outputPath,
+		Concurrency: 1,
+		Timeout:     10 * time.Second,
+		Transport:   transfer.TransportRegistry,
+		Insecure:    true,
+		Platforms:   []string{"linux/amd64", "linux/arm64"},
+	}
+
+	syncer := sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient())
+	require.NoError(t, syncer.Run(context.Background()))
+	assert.Equal(t, 2, syncer.GetProcessedImageCount())
+
+	stored, ok := dst.Manifest("testns/nginx", "latest")
+	require.True(t, ok)
+	index, err := oci.ParseIndex(stored.Data)
+	require.NoError(t, err)
+	assert.Len(t, index.Manifests, 2)
+
+	stored, ok = dst.Manifest("testns/alpine", "3.18")
+	require.True(t, ok)
+	index, err = oci.ParseIndex(stored.Data)
+	require.NoError(t, err)
+	require.Len(t, index.Manifests, 1)
+	assert.Equal(t, "linux/ppc64le", index.Manifests[0].Platform.String())
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# Platforms filtered out: linux/ppc64le")
+	assert.Contains(t, string(data), "# Platforms filtered out: linux/amd64, linux/arm64")
+}
+
+// TestSyncerV2DigestPinning tests that digest-pinned sources are copied exactly
+func TestSyncerV2DigestPinning(t *testing.T) {
+	src := mocks.NewRegistryServer()
+	defer src.Close()
+	dst := mocks.NewRegistryServer()
+	defer dst.Close()
+
+	// The tag has moved on since the digest was pinned
+	pinned := src.AddImage("library/nginx", "1.25", []byte("nginx-old"))
+	src.AddImage("library/nginx", "1.25", []byte("nginx-new"))
+	alpine := src.AddMultiArchImage("library/alpine", "3.18", "linux/amd64", "linux/arm64")
+
+	outputPath := filepath.Join(t.TempDir(), "output.log")
+	cfg := &config.Config{
+		Repository: dst.Host(),
+		Namespace:  "testns",
+		Content: `{"hubsync": ["` + src.Host() + `/library/nginx:1.25@` + pinned + `", "` +
+			src.Host() + `/library/alpine@` + alpine + `"]}`,
+		MaxContent:  10,
+		OutputPath:  outputPath,
+		Concurrency: 1,
+		Timeout:     10 * time.Second,
+		Transport:   transfer.TransportRegistry,
+		Insecure:    true,
+	}
+
+	syncer := sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient())
+	require.NoError(t, syncer.Run(context.Background()))
+	assert.Equal(t, 2, syncer.GetProcessedImageCount())
+
+	stored, ok := dst.Manifest("testns/nginx", "1.25")
+	require.True(t, ok)
+	assert.Equal(t, pinned, oci.ComputeDigest(stored.Data))
+
+	// Digest-only sources are tagged latest in the target
+	stored, ok = dst.Manifest("testns/alpine", "latest")
+	require.True(t, ok)
+	assert.Equal(t, alpine, oci.ComputeDigest(stored.Data))
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "docker pull "+dst.Host()+"/testns/nginx:1.25")
+	assert.Contains(t, string(data), "docker pull "+dst.Host()+"/testns/nginx@"+pinned)
+	assert.Contains(t, string(data), "docker pull "+dst.Host()+"/testns/alpine:latest")
+	assert.Contains(t, string(data), "docker pull "+dst.Host()+"/testns/alpine@"+alpine)
+}
+
+// TestRegistryEngineVerifyDigest tests the post-push digest verification
+func TestRegistryEngineVerifyDigest(t *testing.T) {
+	t.Run("Matching Digest", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+
+		src.AddMultiArchImage("library/busybox", "latest", "linux/amd64", "linux/arm64")
+
+		engine := newTestEngine(nil)
+		report, err := engine.Transfer(context.Background(),
+			&docker.ImageReference{FullName: src.Host() + "/library/busybox:latest"},
+			&docker.ImageReference{FullName: dst.Host() + "/testns/busybox:latest"},
+		)
+
+		require.NoError(t, err)
+		assert.True(t, report.ChecksumOK)
+	})
+
+	t.Run("Mismatched Digest", func(t *testing.T) {
+		src := mocks.NewRegistryServer()
+		defer src.Close()
+		dst := mocks.NewRegistryServer()
+		defer dst.Close()
+		dst.RewriteTaggedManifests = true
+
+		src.AddImage("library/nginx", "latest", []byte("nginx"))
+
+		outputPath := filepath.Join(t.TempDir(), "output.log")
+		cfg := &config.Config{
+			Repository:  dst.Host(),
+			Namespace:   "testns",
+			Content:     `{"hubsync": ["` + src.Host() + `/library/nginx:latest"]}`,
+			MaxContent:  10,
+			OutputPath:  outputPath,
+			Concurrency: 1,
+			Timeout:     10 * time.Second,
+			Transport:   transfer.TransportRegistry,
+			Insecure:    true,
+		}
+
+		syncer := sync.NewSyncerV2(cfg, mocks.NewMockDockerClient(), mocks.NewMockRegistryClient())
+		require.NoError(t, syncer.Run(context.Background()))
+		assert.Equal(t, 0, syncer.GetProcessedImageCount())
+
+		data, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "# Digest verification: 0 verified, 1 mismatched")
+		assert.Contains(t, string(data), "does not match source digest")
+	})
+}
+
+// TestDaemonEngineVerifyDigest tests reading daemon pushes back from the target registry
+func TestDaemonEngineVerifyDigest(t *testing.T) {
+	source := &docker.ImageReference{FullName: "nginx:latest"}
+	target := &docker.ImageReference{FullName: "registry.example.com/mirror/nginx:latest"}
+
+	newClients := func(pushed string) (*mocks.MockDockerClient, *mocks.MockRegistryClient) {
+		dockerClient := mocks.NewMockDockerClient()
+		dockerClient.PushProgress[target.FullName] = &docker.Progress{Digest: pushed}
+		return dockerClient, mocks.NewMockRegistryClient()
+	}
+
+	t.Run("Matching Digest", func(t *testing.T) {
+		dockerClient, registryClient := newClients("sha256:pushed")
+		registryClient.ImageDigests[target.FullName] = "sha256:pushed"
+
+		report, err := transfer.NewDaemonEngine(dockerClient, registryClient).Transfer(context.Background(), source, target)
+		require.NoError(t, err)
+		assert.True(t, report.ChecksumOK)
+		assert.Contains(t, report.Logs, "Verified target digest sha256:pushed")
+	})
+
+	t.Run("Mismatched Digest", func(t *testing.T) {
+		dockerClient, registryClient := newClients("sha256:pushed")
+		registryClient.ImageDigests[target.FullName] = "sha256:other"
+
+		report, err := transfer.NewDaemonEngine(dockerClient, registryClient).Transfer(context.Background(), source, target)
+		require.Error(t, err)
+		assert.True(t, errors.IsVerificationError(err))
+		assert.Contains(t, err.Error(), "does not match pushed digest")
+		assert.False(t, report.ChecksumOK)
+	})
+
+	t.Run("Missing Target", func(t *testing.T) {
+		dockerClient, registryClient := newClients("sha256:pushed")
+
+		_, err := transfer.NewDaemonEngine(dockerClient, registryClient).Transfer(context.Background(), source, target)
+		require.Error(t, err)
+		assert.True(t, errors.IsVerificationError(err))
+	})
+
+	t.Run("Push Without Digest", func(t *testing.T) {
+		dockerClient, registryClient := newClients("")
+
+		report, err := transfer.NewDaemonEngine(dockerClient, registryClient).Transfer(context.Background(), source, target)
+		require.NoError(t, err)
+		assert.False(t, report.ChecksumOK)
+		assert.Contains(t, report.Logs, "Target digest not verified, neither the source nor the push reported a digest")
+	})
+
+	t.Run("Source Platform Digest", func(t *testing.T) {
+		src, dst, indexDigest := newPlatformRegistries(t, "linux/amd64")
+		source := &docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"}
+		target := &docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"}
+
+		dockerClient := mocks.NewMockDockerClient()
+		dockerClient.PullProgress[source.FullName] = &docker.Progress{Digest: indexDigest}
+		registryClient := registry.NewGenericRegistry(registry.RegistryConfig{URL: dst.Host(), Insecure: true})
+		defer registryClient.Close()
+
+		report, err := transfer.NewDaemonEngine(dockerClient, registryClient).Transfer(context.Background(), source, target)
+		require.NoError(t, err)
+		assert.True(t, report.ChecksumOK)
+		assert.Equal(t, indexDigest, report.SourceDigest)
+	})
+
+	t.Run("Target Differs From Source Platform", func(t *testing.T) {
+		src, dst, indexDigest := newPlatformRegistries(t, "linux/arm64")
+		source := &docker.ImageReference{FullName: src.Host() + "/library/nginx:latest"}
+		target := &docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"}
+
+		dockerClient := mocks.NewMockDockerClient()
+		dockerClient.PullProgress[source.FullName] = &docker.Progress{Digest: indexDigest}
+		registryClient := registry.NewGenericRegistry(registry.RegistryConfig{URL: dst.Host(), Insecure: true})
+		defer registryClient.Close()
+
+		report, err := transfer.NewDaemonEngine(dockerClient, registryClient).Transfer(context.Background(), source, target)
+		require.Error(t, err)
+		assert.True(t, errors.IsVerificationError(err))
+		assert.Contains(t, err.Error(), "does not match source digest")
+		assert.False(t, report.ChecksumOK)
+
+		domainErr, ok := err.(*errors.DomainError)
+		require.True(t, ok)
+		assert.NotEqual(t, indexDigest, domainErr.Details["expected"])
+		assert.NotEqual(t, domainErr.Details["expected"], domainErr.Details["actual"])
+	})
+}
+
+// newPlatformRegistries serves a multi-platform source and a target holding
+// the manifest of one of its platforms, and returns the index digest
+func newPlatformRegistries(t *testing.T, pushedPlatform string) (*mocks.RegistryServer, *mocks.RegistryServer, string) {
+	src := mocks.NewRegistryServer()
+	t.Cleanup(src.Close)
+	dst := mocks.NewRegistryServer()
+	t.Cleanup(dst.Close)
+
+	indexDigest := src.AddMultiArchImage("library/nginx", "latest", "linux/amd64", "linux/arm64")
+	index, ok := src.Manifest("library/nginx", indexDigest)
+	require.True(t, ok)
+	parsed, err := oci.ParseIndex(index.Data)
+	require.NoError(t, err)
+	for _, child := range parsed.Manifests {
+		if child.Platform.String() == pushedPlatform {
+			stored, ok := src.Manifest("library/nginx", child.Digest)
+			require.True(t, ok)
+			dst.AddManifest("mirror/nginx", "latest", stored.MediaType, stored.Data)
+		}
+	}
+	return src, dst, indexDigest
+}
+
+// TestDaemonEnginePinnedDigest tests that daemon pushes of a pinned source are
+// verified against the pinned manifest
+func TestDaemonEnginePinnedDigest(t *testing.T) {
+	pinned := func(src *mocks.RegistryServer, digest string) *docker.ImageReference {
+		return &docker.ImageReference{FullName: src.Host() + "/library/nginx@" + digest, Digest: digest}
+	}
+	platformDigest := func(t *testing.T, dst *mocks.RegistryServer) string {
+		stored, ok := dst.Manifest("mirror/nginx", "latest")
+		require.True(t, ok)
+		return oci.ComputeDigest(stored.Data)
+	}
+
+	t.Run("Platform Of A Pinned Index", func(t *testing.T) {
+		src, dst, indexDigest := newPlatformRegistries(t, "linux/amd64")
+		source := pinned(src, indexDigest)
+		target := &docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"}
+
+		dockerClient := mocks.NewMockDockerClient()
+		dockerClient.PushProgress[target.FullName] = &docker.Progress{Digest: platformDigest(t, dst)}
+		registryClient := registry.NewGenericRegistry(registry.RegistryConfig{URL: dst.Host(), Insecure: true})
+		defer registryClient.Close()
+
+		report, err := transfer.NewDaemonEngine(dockerClient, registryClient).Transfer(context.Background(), source, target)
+		require.NoError(t, err)
+		assert.Equal(t, indexDigest, report.SourceDigest)
+		assert.True(t, report.ChecksumOK)
+	})
+
+	t.Run("Pushed Under Another Digest", func(t *testing.T) {
+		src, dst, indexDigest := newPlatformRegistries(t, "linux/amd64")
+		source := pinned(src, indexDigest)
+		target := &docker.ImageReference{FullName: dst.Host() + "/mirror/nginx:latest"}
+
+		dockerClient := mocks.NewMockDockerClient()
+		dockerClient.PushProgress[target.FullName] = &docker.Progress{Digest: "sha256:reserialized"}
+		registryClient := registry.NewGenericRegistry(registry.RegistryConfig{URL: dst.Host(), Insecure: true})
+		defer registryClient.Close()
+
+		report, err := transfer.NewDaemonEngine(dockerClient, registryClient).Transfer(context.Background(), source, target)
+		require.Error(t, err)
+		assert.True(t, errors.IsVerificationError(err))
+		assert.False(t, report.ChecksumOK)
+
+		domainErr, ok := err.(*errors.DomainError)
+		require.True(t, ok)
+		assert.Equal(t, platformDigest(t, dst), domainErr.Details["expected"])
+		assert.Equal(t, "sha256:reserialized", domainErr.Details["actual"])
+	})
+
+	t.Run("Unverifiable Pin", func(t *testing.T) {
+		source := &docker.ImageReference{FullName: "nginx:latest@sha256:index", Digest: "sha256:index"}
+		target := &docker.ImageReference{FullName: "registry.example.com/mirror/nginx:latest"}
+
+		dockerClient := mocks.NewMockDockerClient()
+		dockerClient.PushProgress[target.FullName] = &docker.Progress{Digest: "sha256:amd64"}
+		registryClient := mocks.NewMockRegistryClient()
+		registryClient.ImageDigests[target.FullName] = "sha256:amd64"
+
+		report, err := transfer.NewDaemonEngine(dockerClient, registryClient).Transfer(context.Background(), source, target)
+		require.Error(t, err)
+		assert.True(t, errors.IsVerificationError(err))
+		assert.Contains(t, err.Error(), "use the registry transport")
+		assert.False(t, report.ChecksumOK)
+	})
+}